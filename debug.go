@@ -1,10 +0,0 @@
-//go:build debugcharts
-// +build debugcharts
-
-package main
-
-import (
-	_ "net/http/pprof"
-
-	_ "github.com/mkevac/debugcharts"
-)
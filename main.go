@@ -1,324 +1,214 @@
+// Command do-dynamic-dns-server runs the updater of pkg/ddns as a service.
 package main
 
 import (
 	"context"
-	"fmt"
-	"io"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
 	"net"
-	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
-	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/digitalocean/godo"
-	tld "github.com/jpillora/go-tld"
+	"github.com/matt0x6f/do-dynamic-dns-server/pkg/ddns"
 )
 
-const (
-	CheckIPURL = "https://checkip.amazonaws.com/"
-)
-
-var server *DDNSUpdater
+// version is reported by -version, set at build time with
+// -ldflags "-X main.version=...".
+var version = "dev"
 
 func main() {
-	cfg, err := LoadConfigFromEnv()
-	if err != nil {
-		log.Printf("failed to load config: %s", err)
-	}
+	ddns.Version = version
 
-	if cfg.Debug {
-		go func() {
-			runtime.SetBlockProfileRate(1)
-			runtime.SetMutexProfileFraction(1)
-			log.Printf("Debug mode enabled, server running at: http://localhost:6060/debug/pprof/")
-			log.Println(http.ListenAndServe("localhost:6060", nil))
-		}()
-	}
-
-	server := NewDDNSUpdater(cfg.Domains, cfg.Interval, cfg.DOToken)
-
-	done := make(chan os.Signal, 1)
-	signal.Notify(done, os.Interrupt)
+	if len(os.Args) > 1 && os.Args[1] == "export-history" {
+		err := ddns.ExportHistory(os.Stdout, os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, ddns.ErrVersion) {
+			return
+		}
 
-	go func() {
-		err := server.Run()
 		if err != nil {
-			log.Printf("error: %v\n", err)
-
-			os.Exit(1)
+			slog.Error("unable to export history", "error", err)
+			os.Exit(ddns.ExitFailure)
 		}
-	}()
-
-	log.Print("Server started")
 
-	<-done
+		return
+	}
 
-	log.Print("Signal received, stopping server")
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		err := ddns.Healthcheck(os.Stdout, os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) || errors.Is(err, ddns.ErrVersion) {
+			return
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		// extra handling here
-		cancel()
-	}()
+		if err != nil {
+			slog.Error("healthcheck failed", "error", err)
+			os.Exit(ddns.ExitFailure)
+		}
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server shutdown failed: %+v", err)
+		return
 	}
 
-	log.Print("Server exited properly")
-}
-
-func LoadConfigFromEnv() (*Config, error) {
-	cfg := new(Config)
+	cfg, err := ddns.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) || errors.Is(err, ddns.ErrVersion) {
+		return
+	}
 
-	cfg.DOToken = os.Getenv("DDNS_DO_API_TOKEN")
-	interval, err := time.ParseDuration(os.Getenv("DDNS_INTERVAL"))
 	if err != nil {
-		return nil, fmt.Errorf("unable to parse DDNS_INTERVAL: %w", err)
+		slog.Error("failed to load config", "error", err)
+		os.Exit(ddns.ExitConfig)
 	}
 
-	cfg.Interval = interval
-	domains := []string{}
-
-	rawDomains := os.Getenv("DDNS_DOMAINS")
-
-	parts := strings.Split(rawDomains, ",")
-	domains = append(domains, parts...)
-
-	if domains == nil {
-		return nil, fmt.Errorf("DDNS_DOMAINS is required")
+	// an invalid config is printed too, to see what was parsed
+	if cfg.PrintConfig {
+		if err := ddns.PrintConfig(os.Stdout, cfg); err != nil {
+			slog.Error("unable to print config", "error", err)
+			os.Exit(ddns.ExitFailure)
+		}
 	}
 
-	cfg.Domains = domains
-	cfg.Debug, _ = strconv.ParseBool(os.Getenv("DDNS_DEBUG"))
-
-	return cfg, nil
-}
-
-type Config struct {
-	DOToken string
-	// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
-	Interval time.Duration
-	// Comma separated list of domains to update.
-	Domains []string
-	Debug   bool
-}
-
-// NewDDNSUpdater creates a new DDNS updater
-func NewDDNSUpdater(domains []string, interval time.Duration, token string) *DDNSUpdater {
-	doClient := godo.NewFromToken(token)
-
-	domainTable := make(map[string]godo.DomainRecord, len(domains))
-
-	for _, domain := range domains {
-		// these records get filled during synchronization
-		domainTable[domain] = godo.DomainRecord{}
+	if err := cfg.Validate(); err != nil {
+		problems := strings.Split(err.Error(), "\n")
+		slog.Error("invalid config", "problems", len(problems), "error", strings.Join(problems, "; "))
+		os.Exit(ddns.ExitConfig)
 	}
 
-	return &DDNSUpdater{
-		httpClient: http.Client{Timeout: 2 * time.Second},
-		doClient:   doClient,
-		interval:   interval,
-		recordMap:  domainTable,
-		nextCheck:  time.Now(),
+	if cfg.PrintConfig {
+		return
 	}
-}
-
-type DDNSUpdater struct {
-	httpClient http.Client
-	doClient   *godo.Client
-	// domain: address
-	recordMap map[string]godo.DomainRecord
-	interval  time.Duration
-	lastSet   time.Time
-	nextCheck time.Time
-	currentIP net.IP
-	shutdown  bool
-	complete  bool
-}
 
-// Shutdown signals the Run method to shut down.
-func (d *DDNSUpdater) Shutdown(ctx context.Context) error {
-	// signal the run loop to exit
-	d.shutdown = true
+	slog.SetDefault(ddns.NewLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel, cfg.LogTimezone, cfg.TimeFormat))
 
-	// wait for the run loop to exit
-	for _ = range time.Tick(1 * time.Second) {
-		deadline, ok := ctx.Deadline()
-
-		if ok && (time.Now().After(deadline) || time.Now().Equal(deadline)) {
-			return fmt.Errorf("shutdown timeout reached")
-		}
-
-		if d.complete {
-			break
-		}
+	providers, err := ddns.NewProviders(cfg)
+	if err != nil {
+		slog.Error("unable to create provider", "error", err)
+		os.Exit(ddns.ExitConfig)
 	}
 
-	return nil
-}
-
-// syncRecords performs an initial synchronization of DigitalOcean DNS records to the local cache.
-func (d *DDNSUpdater) syncRecords() error {
-	log.Printf("Syncing %d records", len(d.recordMap))
-
-	for name, _ := range d.recordMap {
-		// this http:// thing is kind of hacky, but hostname.Parse() doesn't work without it
-		hostname, err := tld.Parse("http://" + name)
-		if err != nil {
-			log.Printf("unable to parse domain (%s): %s", name, err)
-
-			continue
-		}
-
-		domain := hostname.Domain + "." + hostname.TLD
-		subdomain := hostname.Subdomain
-		dnsName := subdomain + "." + domain
-		// fixes root domains (@)
-		dnsName = strings.TrimPrefix(dnsName, ".")
-
-		log.Printf("searching record domain=%s name=%s original=%s", domain, dnsName, name)
-
-		records, resp, err := d.doClient.Domains.RecordsByTypeAndName(context.TODO(), domain, "A", dnsName, nil)
+	if cfg.Debug {
+		// a taken address fails startup instead of silently running without it
+		ln, err := net.Listen("tcp", cfg.DebugAddr)
 		if err != nil {
-			log.Printf("unable to fetch records. domain=%s subdomain=%s name=%s: %s", domain, subdomain, dnsName, err)
-
-			continue
+			slog.Error("unable to start debug server", "addr", cfg.DebugAddr, "error", err)
+			os.Exit(ddns.ExitConfig)
 		}
 
-		defer resp.Body.Close()
+		runtime.SetBlockProfileRate(1)
+		runtime.SetMutexProfileFraction(1)
 
-		if len(records) == 0 {
-			log.Printf("no records found for domain=%s subdomain=%s name=%s", domain, subdomain, dnsName)
-
-			continue
-		}
+		reporter, _ := providers[ddns.ProviderDigitalOcean].(ddns.RateReporter)
 
-		record := records[0]
-		d.recordMap[name] = record
+		go func() {
+			slog.Info("debug mode enabled", "url", "http://"+ln.Addr().String()+"/debug/pprof/")
+			slog.Error("debug server stopped", "error", ddns.ServeDebug(ln, reporter))
+		}()
 	}
 
-	return nil
-}
-
-// Run should be run in a go routine. It runs in a loop.
-func (d *DDNSUpdater) Run() error {
-	err := d.syncRecords()
-	if err != nil {
-		return fmt.Errorf("unable to sync records: %s", err)
+	// an audit trail that can't be written fails startup, not the first change
+	if cfg.AuditFile != "" {
+		if err := ddns.CheckAuditFile(cfg.AuditFile); err != nil {
+			slog.Error("unable to open audit file", "path", cfg.AuditFile, "error", err)
+			os.Exit(ddns.ExitConfig)
+		}
 	}
 
-	// use a one second loop so we can capture shutdowns
-	for tick := range time.Tick(1 * time.Second) {
-		now := time.Now()
+	server := ddns.NewDDNSUpdater(cfg, providers)
 
-		if d.shutdown {
-			d.complete = true
-			break
+	if cfg.OneShot {
+		err := server.RunOnce()
+		if err != nil {
+			slog.Error("one-shot run failed", "error", err)
+			os.Exit(ddns.ExitCode(err))
 		}
 
-		if d.nextCheck.Before(now) || d.nextCheck.Equal(now) {
-			address, err := d.CheckIP()
-			if err != nil {
-				log.Printf("%s", err)
-			}
-
-			ip := net.ParseIP(strings.TrimSpace(address))
-
-			log.Printf("ip=%s ts=%s", ip.String(), tick.String())
-
-			if !d.currentIP.Equal(ip) {
-				d.updateRecords(ip, tick)
-			} else {
-				log.Printf("ip is unchanged")
-			}
-
-			d.nextCheck = now.Add(d.interval)
-
-			log.Printf("Next check at %s", d.nextCheck.Format(time.RFC3339))
-		}
+		return
 	}
 
-	return nil
-}
-
-func (d *DDNSUpdater) CheckIP() (string, error) {
-	req, err := http.NewRequestWithContext(context.TODO(), http.MethodGet, CheckIPURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("error while forming request: %v", err)
+	if cfg.HealthAddr != "" {
+		go func() {
+			slog.Info("health server running", "url", "http://"+cfg.HealthAddr+"/healthz")
+			slog.Error("health server stopped", "error", server.ServeHealth(cfg.HealthAddr))
+		}()
 	}
 
-	resp, err := d.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error while unpacking response: %v", err)
+	if cfg.StatusAddr != "" {
+		go func() {
+			slog.Info("status server running", "url", "http://"+cfg.StatusAddr+"/status")
+			slog.Error("status server stopped", "error", server.ServeStatus(cfg.StatusAddr))
+		}()
 	}
 
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error while reading response body: \"%v\"", err)
+	if cfg.MetricsAddr != "" {
+		go func() {
+			slog.Info("metrics server running", "url", "http://"+cfg.MetricsAddr+"/metrics")
+			slog.Error("metrics server stopped", "error", server.ServeMetrics(cfg.MetricsAddr))
+		}()
 	}
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return "", fmt.Errorf("error from server (%d) body: \"%s\"", resp.StatusCode, body)
-	}
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGTERM)
 
-	return strings.TrimSpace(string(body)), nil
-}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-// updateRecords updates records in digital ocean
-func (d *DDNSUpdater) updateRecords(ip net.IP, ts time.Time) {
-	oldIP := d.currentIP
-	d.currentIP = ip
+	go func() {
+		for range hup {
+			slog.Info("SIGHUP received, reloading config")
 
-	log.Printf("ip changed to %s from %s", ip.String(), oldIP.String())
+			cfg, err := ddns.LoadConfig(os.Args[1:])
+			if err == nil {
+				err = cfg.Validate()
+			}
 
-	for name, record := range d.recordMap {
-		if record.Data == d.currentIP.String() {
-			log.Printf("record consistent, skipping update")
+			if err == nil {
+				err = server.Reload(cfg)
+			}
 
-			continue
+			if err != nil {
+				slog.Error("unable to reload config, keeping the running config", "error", err)
+			}
 		}
+	}()
 
-		// this http:// thing is kind of hacky, but hostname.Parse() doesn't work without it
-		hostname, err := tld.Parse("http://" + name)
+	go func() {
+		err := server.Run()
 		if err != nil {
-			log.Printf("unable to parse domain (%s): %s", name, err)
+			slog.Error("server failed", "error", err)
 
-			continue
+			os.Exit(ddns.ExitCode(err))
 		}
+	}()
 
-		domain := hostname.Domain + "." + hostname.TLD
-
-		r, resp, err := d.doClient.Domains.EditRecord(context.TODO(), domain, record.ID, &godo.DomainRecordEditRequest{
-			Data: d.currentIP.String(),
-		})
-		if err != nil {
-			log.Printf("error while updating domain record: %v", err)
+	slog.Info("server started")
 
-			continue
-		}
+	// nil, so never ready, unless a max runtime is set
+	var deadline <-chan time.Time
+	if cfg.MaxRuntime > 0 {
+		deadline = time.After(cfg.MaxRuntime)
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("error while reading response body: \"%v\"", err)
-			continue
-		}
+	select {
+	case <-done:
+		slog.Info("signal received, stopping server", "grace_period", cfg.ShutdownTimeout)
+	case <-deadline:
+		slog.Info("max runtime reached, stopping server", "max_runtime", cfg.MaxRuntime, "grace_period", cfg.ShutdownTimeout)
+	}
 
-		if resp.StatusCode >= http.StatusBadRequest {
-			log.Printf("error from DO api (%d) body: \"%s\"", resp.StatusCode, body)
-			continue
-		}
+	start := time.Now()
 
-		log.Printf("updated record for domain=%s name=%s", domain, record.Name)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer func() {
+		// extra handling here
+		cancel()
+	}()
 
-		d.recordMap[domain] = *r
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("server shutdown timed out", "grace_period", cfg.ShutdownTimeout, "error", err)
+		os.Exit(ddns.ExitShutdownTimeout)
 	}
 
-	d.lastSet = ts
+	slog.Info("server exited properly", "elapsed", time.Since(start).Round(time.Millisecond), "grace_period", cfg.ShutdownTimeout)
 }
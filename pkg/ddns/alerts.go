@@ -0,0 +1,205 @@
+package ddns
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultFailureAlertThreshold is how many consecutive failures of a
+	// record raise an alert unless DDNS_FAILURE_ALERT_THRESHOLD is set.
+	DefaultFailureAlertThreshold = 3
+
+	// FailureEventFailing is sent once a record failed the threshold of times
+	// in a row, FailureEventRecovered on its next successful write.
+	FailureEventFailing   = "failing"
+	FailureEventRecovered = "recovered"
+
+	// BlocklistEventDetected is sent when the detected IP is one of
+	// DDNS_BLOCKLIST_IPS and its records are left alone.
+	BlocklistEventDetected = "ip_blocklisted"
+)
+
+// failureEvent is the body posted to the webhook when a record starts or
+// stops failing.
+type failureEvent struct {
+	Event      string `json:"event"`
+	Domain     string `json:"domain"`
+	RecordType string `json:"record_type"`
+	// the secondary provider of the domain, empty for its primary records
+	Provider  string    `json:"provider,omitempty"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// alerts of the record held back by DDNS_NOTIFY_THROTTLE since the last
+	// one sent
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// String summarizes e as a chat message.
+func (e failureEvent) String() string {
+	record := e.Domain + "/" + e.RecordType
+	if e.Provider != "" {
+		record += " at secondary provider " + e.Provider
+	}
+
+	var message string
+	if e.Event == FailureEventRecovered {
+		message = fmt.Sprintf("%s recovered after %d failed updates", record, e.Failures)
+	} else {
+		message = fmt.Sprintf("%s failed to update %d times in a row: %s", record, e.Failures, e.LastError)
+	}
+
+	return message + suppressedNote(e.Suppressed)
+}
+
+func (e failureEvent) alertKey() string {
+	return "record " + e.Domain + "/" + e.RecordType + " " + e.Provider
+}
+
+func (e failureEvent) alertTime() time.Time { return e.Timestamp }
+
+func (e failureEvent) withSuppressed(n int) alert {
+	e.Suppressed = n
+
+	return e
+}
+
+// blocklistEvent is the body posted to the webhook when a blocklisted IP is
+// detected.
+type blocklistEvent struct {
+	Event      string    `json:"event"`
+	RecordType string    `json:"record_type"`
+	IP         string    `json:"ip"`
+	Timestamp  time.Time `json:"timestamp"`
+	// alerts of the record type held back by DDNS_NOTIFY_THROTTLE since the
+	// last one sent
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// String summarizes e as a chat message.
+func (e blocklistEvent) String() string {
+	return fmt.Sprintf("detected %s address %s is blocklisted, records left alone", e.RecordType, e.IP) + suppressedNote(e.Suppressed)
+}
+
+func (e blocklistEvent) alertKey() string { return "blocklist " + e.RecordType }
+
+func (e blocklistEvent) alertTime() time.Time { return e.Timestamp }
+
+func (e blocklistEvent) withSuppressed(n int) alert {
+	e.Suppressed = n
+
+	return e
+}
+
+// suppressedNote summarizes n alerts held back by the throttle for a chat
+// message, empty when there were none.
+func suppressedNote(n int) string {
+	if n == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (%d similar alerts suppressed)", n)
+}
+
+// alertThreshold returns how many failures in a row of a record of key raise
+// an alert, 0 when failure alerts are off. A required domain's record alerts
+// on its first failure, after its immediate retry failed too.
+func (d *DDNSUpdater) alertThreshold(key recordKey) int {
+	if d.failureThreshold > 0 && d.specs[key.Name].Required {
+		return 1
+	}
+
+	return d.failureThreshold
+}
+
+// trackFailure counts a failed write of a record of key and alerts when the
+// count reaches the threshold. Only the first alert of a streak is sent.
+func (d *DDNSUpdater) trackFailure(key recordKey, err error) {
+	d.mu.Lock()
+	d.failures[key]++
+	count := d.failures[key]
+	d.mu.Unlock()
+
+	if threshold := d.alertThreshold(key); threshold <= 0 || count != threshold {
+		return
+	}
+
+	d.logger.Error("record keeps failing to update", "record", key.String(), "failures", count, "error", err)
+
+	d.notifyFailure(failureEvent{
+		Event:      FailureEventFailing,
+		Domain:     key.Name,
+		RecordType: key.Type,
+		Failures:   count,
+		LastError:  err.Error(),
+		Timestamp:  time.Now(),
+	})
+}
+
+// trackRecovery resets the failure count and last error of key after it holds
+// its data again, logs the recovery once, and reports it when an alert was
+// sent for the streak.
+func (d *DDNSUpdater) trackRecovery(key recordKey) {
+	d.mu.Lock()
+	count := d.failures[key]
+	lastError, failed := d.lastErrors[key]
+	delete(d.failures, key)
+	delete(d.lastErrors, key)
+	d.mu.Unlock()
+
+	if failed {
+		d.logger.Info("record recovered", "record", key.String(), "failures", count, "last_error", lastError)
+	}
+
+	if threshold := d.alertThreshold(key); threshold <= 0 || count < threshold {
+		return
+	}
+
+	d.notifyFailure(failureEvent{
+		Event:      FailureEventRecovered,
+		Domain:     key.Name,
+		RecordType: key.Type,
+		Failures:   count,
+		Timestamp:  time.Now(),
+	})
+}
+
+// flushAlerts sends the alerts DDNS_NOTIFY_THROTTLE held back whose throttle
+// is over at now. A delivery failure is only logged.
+func (d *DDNSUpdater) flushAlerts(now time.Time) {
+	if err := d.webhook.Flush(d.ctx, now); err != nil {
+		d.logger.Error("unable to notify webhook", "error", err)
+	}
+}
+
+// notifyFailure posts event to the webhook. A delivery failure is only logged.
+func (d *DDNSUpdater) notifyFailure(event failureEvent) {
+	if d.dryRun {
+		if d.webhook != nil {
+			d.logger.Info("dry run: would notify webhook", "event", event.Event, "domain", event.Domain, "type", event.RecordType)
+		}
+
+		return
+	}
+
+	if err := d.webhook.Notify(d.ctx, event); err != nil {
+		d.logger.Error("unable to notify webhook", "error", err)
+	}
+}
+
+// notifyBlocklist posts event to the webhook. A delivery failure is only
+// logged.
+func (d *DDNSUpdater) notifyBlocklist(event blocklistEvent) {
+	if d.dryRun {
+		if d.webhook != nil {
+			d.logger.Info("dry run: would notify webhook", "event", event.Event, "type", event.RecordType, "ip", event.IP)
+		}
+
+		return
+	}
+
+	if err := d.webhook.Notify(d.ctx, event); err != nil {
+		d.logger.Error("unable to notify webhook", "error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package ddns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultAuditMaxSize is the size in bytes past which DDNS_AUDIT_FILE is
+// rotated unless DDNS_AUDIT_MAX_SIZE is set.
+const DefaultAuditMaxSize = 10 << 20
+
+// Outcomes of an AuditEntry.
+const (
+	AuditUpdated    = "updated"
+	AuditCreated    = "created"
+	AuditRecreated  = "recreated"
+	AuditDeleted    = "deleted"
+	AuditRolledBack = "rolled_back"
+	AuditFailed     = "failed"
+)
+
+// AuditEntry is a single write to a record, one JSON line of DDNS_AUDIT_FILE.
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	Domain   string    `json:"domain"`
+	Type     string    `json:"type"`
+	Provider string    `json:"provider"`
+	RecordID string    `json:"record_id"`
+	// empty for created records
+	OldValue string `json:"old_value"`
+	// empty for deleted records
+	NewValue string `json:"new_value"`
+	Outcome  string `json:"outcome"`
+	// only set when Outcome is AuditFailed
+	Error string `json:"error,omitempty"`
+}
+
+// auditLog appends entries to a JSON lines file, synced after every entry.
+// The file is opened for every entry, so it may be moved away by an external
+// rotation at any time, and rotated to <path>.1 before an entry would grow it
+// past maxSize. A
+// nil *auditLog discards everything. It is safe for concurrent use.
+type auditLog struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+}
+
+// newAuditLog returns the audit log at path, nil when path is empty.
+func newAuditLog(path string, maxSize int64) *auditLog {
+	if path == "" {
+		return nil
+	}
+
+	return &auditLog{path: path, maxSize: maxSize}
+}
+
+// CheckAuditFile confirms entries can be appended to path, creating it
+// when missing, so an unwritable audit file fails startup rather than the
+// first write.
+func CheckAuditFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Write appends entry, rotating the file first when it outgrew maxSize.
+func (a *auditLog) Write(entry AuditEntry) error {
+	if a == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if info, err := os.Stat(a.path); err == nil && a.maxSize > 0 && info.Size()+int64(len(line)) > a.maxSize {
+		// a single backup is kept, older entries have to be archived by then
+		if err := os.Rename(a.path, a.path+".1"); err != nil {
+			return fmt.Errorf("unable to rotate audit file %s: %w", a.path, err)
+		}
+	}
+
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(line)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	return errors.Join(err, f.Close())
+}
+
+// audit records a write to the record with id of key at provider, from
+// oldValue to newValue, with outcome. A failed audit write is only logged. Dry
+// runs make no changes, so nothing is recorded.
+func (d *DDNSUpdater) audit(key recordKey, provider, outcome, id, oldValue, newValue string, writeErr error) {
+	if d.auditLog == nil || d.dryRun {
+		return
+	}
+
+	entry := AuditEntry{
+		Time:     time.Now(),
+		Domain:   key.Name,
+		Type:     key.Type,
+		Provider: provider,
+		RecordID: id,
+		OldValue: oldValue,
+		NewValue: newValue,
+		Outcome:  outcome,
+	}
+
+	if writeErr != nil {
+		entry.Error = writeErr.Error()
+	}
+
+	if err := d.auditLog.Write(entry); err != nil {
+		d.logger.Error("unable to write audit entry", "record", key.String(), "record_id", id, "outcome", outcome, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build bolt
+// +build bolt
+
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// stateBucket holds the last confirmed address of each record type, keyed by
+// the type, and the time it was confirmed under updatedKey.
+var (
+	stateBucket = []byte("state")
+	updatedKey  = []byte("updated")
+)
+
+func init() {
+	newBoltStateStore = func(path string) (StateStore, error) {
+		db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return nil, fmt.Errorf("unable to open state database %s: %w", path, err)
+		}
+
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(stateBucket)
+
+			return err
+		})
+		if err != nil {
+			db.Close()
+
+			return nil, fmt.Errorf("unable to open state database %s: %w", path, err)
+		}
+
+		return boltStateStore{db: db}, nil
+	}
+}
+
+// boltStateStore keeps the state in a bolt database, open for the lifetime of
+// the process.
+type boltStateStore struct {
+	db *bolt.DB
+}
+
+func (s boltStateStore) Load() (map[string]net.IP, error) {
+	ips := map[string]net.IP{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).ForEach(func(k, v []byte) error {
+			if string(k) == string(updatedKey) {
+				return nil
+			}
+
+			ip := net.ParseIP(string(v))
+			if ip == nil {
+				return fmt.Errorf("invalid %s address %q in state database %s", k, v, s.db.Path())
+			}
+
+			ips[string(k)] = ip
+
+			return nil
+		})
+	})
+	if err != nil {
+		return map[string]net.IP{}, err
+	}
+
+	return ips, nil
+}
+
+func (s boltStateStore) Save(ips map[string]net.IP, ts time.Time) error {
+	updated, err := json.Marshal(ts)
+	if err != nil {
+		return err
+	}
+
+	// replaced in a single transaction, so a crash keeps the previous state
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(stateBucket); err != nil {
+			return err
+		}
+
+		b, err := tx.CreateBucket(stateBucket)
+		if err != nil {
+			return err
+		}
+
+		for recType, ip := range ips {
+			if err := b.Put([]byte(recType), []byte(ip.String())); err != nil {
+				return err
+			}
+		}
+
+		return b.Put(updatedKey, updated)
+	})
+}
@@ -0,0 +1,48 @@
+//go:build bolt
+// +build bolt
+
+package ddns
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	s, err := newBoltStateStore(path)
+	if err != nil {
+		t.Fatalf("newBoltStateStore: %v", err)
+	}
+
+	ips := map[string]net.IP{"A": net.ParseIP("8.8.8.8"), "AAAA": net.ParseIP("2001:4860::8888")}
+	if err := s.Save(ips, time.Now()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// a save replaces every address, so a dropped type is gone
+	delete(ips, "AAAA")
+	if err := s.Save(ips, time.Now()); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	s.(boltStateStore).db.Close()
+
+	s, err = newBoltStateStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	t.Cleanup(func() { s.(boltStateStore).db.Close() })
+
+	saved, err := s.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if len(saved) != 1 || saved["A"].String() != "8.8.8.8" {
+		t.Errorf("loaded %v, want only A 8.8.8.8", saved)
+	}
+}
@@ -0,0 +1,152 @@
+package ddns
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultBreakerInterval is how long checks pause once the breaker opened
+	// unless DDNS_BREAKER_INTERVAL is set.
+	DefaultBreakerInterval = 15 * time.Minute
+
+	// Breaker states: closed checks on the normal cadence, open pauses checks
+	// after failed cycles, and half-open runs a single probe once the pause is
+	// over, closing again when it succeeds.
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+
+	// BreakerEventOpen is sent when the breaker opens, BreakerEventClosed when
+	// a later cycle succeeds.
+	BreakerEventOpen   = "breaker_open"
+	BreakerEventClosed = "breaker_closed"
+)
+
+// breakerEvent is the body posted to the webhook when the breaker opens or
+// closes.
+type breakerEvent struct {
+	Event string `json:"event"`
+	// cycles failed in a row
+	Failures  int    `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+	// when the probe runs, zero for BreakerEventClosed
+	Until     time.Time `json:"until,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// alerts of the breaker held back by DDNS_NOTIFY_THROTTLE since the last
+	// one sent
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// String summarizes e as a chat message.
+func (e breakerEvent) String() string {
+	if e.Event == BreakerEventClosed {
+		return fmt.Sprintf("checks recovered after %d failed cycles, resuming the normal interval", e.Failures) + suppressedNote(e.Suppressed)
+	}
+
+	return fmt.Sprintf("%d cycles failed in a row, pausing checks until %s: %s", e.Failures, e.Until.Format(time.RFC3339), e.LastError) + suppressedNote(e.Suppressed)
+}
+
+func (e breakerEvent) alertKey() string { return "breaker" }
+
+func (e breakerEvent) alertTime() time.Time { return e.Timestamp }
+
+func (e breakerEvent) withSuppressed(n int) alert {
+	e.Suppressed = n
+
+	return e
+}
+
+// probeBreaker moves an open breaker whose pause is over at now to half-open,
+// making the cycle about to run its probe.
+func (d *DDNSUpdater) probeBreaker(now time.Time) {
+	if d.breakerState != BreakerOpen || now.Before(d.breakerUntil) {
+		return
+	}
+
+	d.logger.Info("breaker half-open, probing with a single cycle", "failures", d.breakerFailures)
+
+	d.setBreakerState(BreakerHalfOpen)
+}
+
+// trackBreaker counts the cycles in a row that failed, given the error of the
+// last one. Once breakerThreshold is reached, or a probe fails, the breaker
+// opens: every domain waits breakerInterval for its next check, and the first
+// opening of a streak is alerted on. A successful cycle closes it again.
+func (d *DDNSUpdater) trackBreaker(err error, now time.Time) {
+	if d.breakerThreshold <= 0 {
+		return
+	}
+
+	if err == nil {
+		failures := d.breakerFailures
+		d.breakerFailures = 0
+
+		if d.breakerState == BreakerClosed {
+			return
+		}
+
+		d.logger.Info("breaker closed, resuming the normal interval", "failures", failures)
+
+		d.setBreakerState(BreakerClosed)
+		d.notifyBreaker(breakerEvent{Event: BreakerEventClosed, Failures: failures, Timestamp: now})
+
+		return
+	}
+
+	d.breakerFailures++
+
+	opened := d.breakerState == BreakerClosed
+	if opened && d.breakerFailures < d.breakerThreshold {
+		return
+	}
+
+	d.breakerUntil = now.Add(d.breakerInterval)
+
+	// the probe checks every domain at once
+	for name := range d.specs {
+		d.domainNext[name] = d.breakerUntil
+	}
+
+	d.updateNextCheck()
+	d.setBreakerState(BreakerOpen)
+
+	if !opened {
+		d.logger.Warn("breaker probe failed, pausing checks again", "failures", d.breakerFailures, "until", d.breakerUntil, "error", err)
+
+		return
+	}
+
+	d.logger.Error("cycles keep failing, breaker open, pausing checks", "failures", d.breakerFailures, "until", d.breakerUntil, "error", err)
+
+	d.notifyBreaker(breakerEvent{
+		Event:     BreakerEventOpen,
+		Failures:  d.breakerFailures,
+		LastError: err.Error(),
+		Until:     d.breakerUntil,
+		Timestamp: now,
+	})
+}
+
+// notifyBreaker posts event to the webhook. A delivery failure is only logged.
+func (d *DDNSUpdater) notifyBreaker(event breakerEvent) {
+	if d.dryRun {
+		if d.webhook != nil {
+			d.logger.Info("dry run: would notify webhook", "event", event.Event, "failures", event.Failures)
+		}
+
+		return
+	}
+
+	if err := d.webhook.Notify(d.ctx, event); err != nil {
+		d.logger.Error("unable to notify webhook", "error", err)
+	}
+}
+
+// setBreakerState switches the breaker to state. The status published by the
+// cycle that caused it is taken again to show it.
+func (d *DDNSUpdater) setBreakerState(state string) {
+	d.breakerState = state
+	d.metrics.BreakerState(state)
+	d.publishStatus()
+}
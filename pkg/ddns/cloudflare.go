@@ -0,0 +1,243 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const CloudflareAPIURL = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider manages records through the Cloudflare API.
+type cloudflareProvider struct {
+	httpClient *http.Client
+	token      string
+	baseURL    string
+	userAgent  string
+	// zone name: zone id
+	zoneIDs map[string]string
+	// guards zoneIDs, concurrent workers share the provider
+	mu sync.Mutex
+}
+
+// cloudflareRecord is a DNS record as returned by the Cloudflare API.
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content,omitempty"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+// cloudflareResponse is the envelope around every Cloudflare API result.
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func newCloudflareProvider(token, userAgent string, client *http.Client) *cloudflareProvider {
+	return &cloudflareProvider{
+		httpClient: client,
+		token:      strings.Trim(strings.TrimSpace(token), "'"),
+		baseURL:    CloudflareAPIURL,
+		userAgent:  userAgent,
+		zoneIDs:    map[string]string{},
+	}
+}
+
+func (p *cloudflareProvider) Validate(ctx context.Context) error {
+	return p.do(ctx, http.MethodGet, "/user/tokens/verify", nil, nil)
+}
+
+func (p *cloudflareProvider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{"type": {recType}, "name": {fqdn(domain, name)}}
+
+	var records []cloudflareRecord
+
+	err = p.do(ctx, http.MethodGet, "/zones/"+zoneID+"/dns_records?"+query.Encode(), nil, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no matching %s record for domain=%s name=%s", ErrRecordNotFound, recType, domain, name)
+	}
+
+	// order deterministically, the api doesn't guarantee an order
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	found := make([]Record, 0, len(records))
+	for _, r := range records {
+		found = append(found, r.toRecord(domain))
+	}
+
+	return found, nil
+}
+
+func (p *cloudflareProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return Record{}, err
+	}
+
+	var updated cloudflareRecord
+
+	// PATCH only changes the fields sent, so TTL, proxying, etc. are kept
+	err = p.do(ctx, http.MethodPatch, "/zones/"+zoneID+"/dns_records/"+id, cloudflareRecord{Content: data, TTL: ttl}, &updated)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return updated.toRecord(domain), nil
+}
+
+func (p *cloudflareProvider) CreateRecord(ctx context.Context, domain string, record Record) (Record, error) {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return Record{}, err
+	}
+
+	request := cloudflareRecord{
+		Type:    record.Type,
+		Name:    fqdn(domain, record.Name),
+		Content: record.Data,
+		TTL:     record.TTL,
+	}
+
+	var created cloudflareRecord
+
+	err = p.do(ctx, http.MethodPost, "/zones/"+zoneID+"/dns_records", request, &created)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return created.toRecord(domain), nil
+}
+
+func (p *cloudflareProvider) DeleteRecord(ctx context.Context, domain, id string) error {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	return p.do(ctx, http.MethodDelete, "/zones/"+zoneID+"/dns_records/"+id, nil, nil)
+}
+
+// zoneID looks up and caches the id of the zone named domain.
+func (p *cloudflareProvider) zoneID(ctx context.Context, domain string) (string, error) {
+	p.mu.Lock()
+	id, ok := p.zoneIDs[domain]
+	p.mu.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	var zones []struct {
+		ID string `json:"id"`
+	}
+
+	err := p.do(ctx, http.MethodGet, "/zones?"+url.Values{"name": {domain}}.Encode(), nil, &zones)
+	if err != nil {
+		return "", err
+	}
+
+	if len(zones) == 0 {
+		return "", fmt.Errorf("%w: domain %s is not managed by this Cloudflare account", ErrZoneNotFound, domain)
+	}
+
+	p.mu.Lock()
+	p.zoneIDs[domain] = zones[0].ID
+	p.mu.Unlock()
+
+	return zones[0].ID, nil
+}
+
+// do sends a request to the Cloudflare API and decodes its result into out,
+// unless out is nil.
+func (p *cloudflareProvider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		contents, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(contents)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error while building cloudflare request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", p.userAgent)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: error while calling cloudflare api: %v", ErrUnreachable, err)
+	}
+
+	defer resp.Body.Close()
+
+	contents, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIBodySize))
+	if err != nil {
+		return fmt.Errorf("error while reading response body: \"%v\"", err)
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: cloudflare api body: \"%s\"", ErrInvalidToken, contents)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: cloudflare api body: \"%s\"", ErrRecordNotFound, contents)
+	}
+
+	var envelope cloudflareResponse
+
+	err = json.Unmarshal(contents, &envelope)
+	if err != nil || resp.StatusCode >= http.StatusBadRequest || !envelope.Success {
+		return fmt.Errorf("error from cloudflare api (%d) body: \"%s\"", resp.StatusCode, contents)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// toRecord converts r to a Record with a name relative to zone.
+func (r cloudflareRecord) toRecord(zone string) Record {
+	name := strings.TrimSuffix(r.Name, "."+zone)
+	if r.Name == zone {
+		name = "@"
+	}
+
+	return Record{
+		ID:   r.ID,
+		Type: r.Type,
+		Name: name,
+		Data: r.Content,
+		TTL:  r.TTL,
+	}
+}
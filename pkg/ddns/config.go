@@ -0,0 +1,229 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// configFile holds the settings read from DDNS_CONFIG_FILE. Settings are named
+// like the secrets directory files, e.g. "interval" for DDNS_INTERVAL; domains
+// may be given as stanzas instead of a comma separated list.
+type configFile struct {
+	path    string
+	values  map[string]string
+	domains []DomainSpec
+	// name: credential set of the credentials section
+	credentials map[string]CredentialSet
+}
+
+// credentialStanza is a single entry of the credentials section in
+// DDNS_CONFIG_FILE.
+type credentialStanza struct {
+	Provider  string `json:"provider" yaml:"provider"`
+	Token     string `json:"token" yaml:"token"`
+	TokenFile string `json:"token_file" yaml:"token_file"`
+}
+
+// domainStanza is a single entry of the domains list in DDNS_CONFIG_FILE.
+type domainStanza struct {
+	Name      string   `json:"name" yaml:"name"`
+	Record    string   `json:"record" yaml:"record"`
+	Required  bool     `json:"required" yaml:"required"`
+	TTL       int      `json:"ttl" yaml:"ttl"`
+	Types     []string `json:"types" yaml:"types"`
+	Provider  string   `json:"provider" yaml:"provider"`
+	Secondary string   `json:"secondary" yaml:"secondary"`
+	Interval  string   `json:"interval" yaml:"interval"`
+	Value     string   `json:"value" yaml:"value"`
+	Apex      string   `json:"apex" yaml:"apex"`
+	Target    string   `json:"target" yaml:"target"`
+}
+
+// readConfigFile parses path as YAML when it ends in .yaml or .yml and as JSON
+// otherwise. An empty path yields an empty config.
+func readConfigFile(path string) (*configFile, error) {
+	file := &configFile{path: path, values: map[string]string{}}
+
+	if path == "" {
+		return file, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshal := json.Unmarshal
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		unmarshal = yaml.Unmarshal
+	}
+
+	var settings map[string]interface{}
+
+	err = unmarshal(contents, &settings)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, value := range settings {
+		if key == "domains" || key == "credentials" {
+			continue
+		}
+
+		switch v := value.(type) {
+		case []interface{}:
+			// lists are joined like their comma separated env var
+			parts := make([]string, 0, len(v))
+			for _, part := range v {
+				parts = append(parts, fmt.Sprint(part))
+			}
+
+			file.values[key] = strings.Join(parts, ",")
+		case map[string]interface{}, map[interface{}]interface{}:
+			return nil, fmt.Errorf("%s: %s must be a value or a list", path, key)
+		default:
+			file.values[key] = fmt.Sprint(v)
+		}
+	}
+
+	switch settings["domains"].(type) {
+	case nil:
+	case string:
+		file.values["domains"] = settings["domains"].(string)
+	default:
+		var parsed struct {
+			Domains []domainStanza `json:"domains" yaml:"domains"`
+		}
+
+		err = unmarshal(contents, &parsed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: domains: %w", path, err)
+		}
+
+		for i, stanza := range parsed.Domains {
+			spec, err := stanza.spec()
+			if err != nil {
+				return nil, fmt.Errorf("%s: domains[%d]: %w", path, i, err)
+			}
+
+			file.domains = append(file.domains, spec)
+		}
+	}
+
+	if settings["credentials"] != nil {
+		var parsed struct {
+			Credentials map[string]credentialStanza `json:"credentials" yaml:"credentials"`
+		}
+
+		err = unmarshal(contents, &parsed)
+		if err != nil {
+			return nil, fmt.Errorf("%s: credentials: %w", path, err)
+		}
+
+		file.credentials = map[string]CredentialSet{}
+
+		for name, stanza := range parsed.Credentials {
+			set, err := stanza.set()
+			if err != nil {
+				return nil, fmt.Errorf("%s: credentials.%s: %w", path, name, err)
+			}
+
+			file.credentials[strings.ToLower(name)] = set
+		}
+	}
+
+	return file, nil
+}
+
+// set converts the stanza to a CredentialSet, reading the token from its file
+// when one is given.
+func (s credentialStanza) set() (CredentialSet, error) {
+	set := CredentialSet{Provider: strings.ToLower(strings.TrimSpace(s.Provider)), Token: strings.TrimSpace(s.Token)}
+
+	if s.TokenFile != "" {
+		token, err := readTokenFile(s.TokenFile)
+		if err != nil {
+			return set, fmt.Errorf("token_file: %w", err)
+		}
+
+		set.Token = token
+	}
+
+	return set, nil
+}
+
+// spec validates the stanza and converts it to a DomainSpec.
+func (s domainStanza) spec() (DomainSpec, error) {
+	spec := DomainSpec{
+		Name:       s.Name,
+		RecordName: s.Record,
+		Required:   s.Required,
+		TTL:        s.TTL,
+		Provider:   strings.ToLower(s.Provider),
+		Secondary:  strings.ToLower(s.Secondary),
+		Value:      s.Value,
+		Apex:       s.Apex,
+		Target:     s.Target,
+	}
+
+	if spec.Name == "" {
+		return spec, fmt.Errorf("name is required")
+	}
+
+	if spec.TTL < 0 {
+		return spec, fmt.Errorf("ttl: expected a positive number of seconds, got %d", spec.TTL)
+	}
+
+	derived := false
+
+	for _, recType := range s.Types {
+		recType = strings.ToUpper(strings.TrimSpace(recType))
+		if !isIPType(recType) && recType != "TXT" && recType != "CNAME" {
+			return spec, fmt.Errorf("types: unsupported record type %q", recType)
+		}
+
+		derived = derived || !isIPType(recType)
+		spec.Types = append(spec.Types, recType)
+	}
+
+	switch {
+	case derived && s.Value == "":
+		return spec, fmt.Errorf("value: required for TXT and CNAME records")
+	case !derived && s.Value != "":
+		return spec, fmt.Errorf("value: only used by TXT and CNAME records")
+	case derived:
+		tmpl, err := parseValueTemplate(s.Value)
+		if err != nil {
+			return spec, fmt.Errorf("value: %w", err)
+		}
+
+		spec.valueTemplate = tmpl
+	}
+
+	if s.Interval != "" {
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil || interval <= 0 {
+			return spec, fmt.Errorf("interval: expected a positive duration, got %q", s.Interval)
+		}
+
+		spec.Interval = interval
+	}
+
+	if s.Target != "" {
+		targets, err := parseTargets(s.Target)
+		if err != nil {
+			return spec, fmt.Errorf("target: %w", err)
+		}
+
+		spec.targets = targets
+	}
+
+	// providers may also name a credential set, both are checked by Validate
+	return spec, nil
+}
@@ -0,0 +1,113 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+)
+
+// secretFields are the Config fields only printed redacted by -print-config.
+var secretFields = map[string]bool{
+	"DOToken":       true,
+	"CFToken":       true,
+	"WebhookSecret": true,
+	"APIToken":      true,
+	// the path of a Slack or Discord webhook is its credential
+	"WebhookURL": true,
+}
+
+// PrintConfig writes cfg as indented JSON to w, with secrets redacted.
+// Durations, addresses, URLs and patterns are printed the way they are
+// configured rather than as Go values.
+func PrintConfig(w io.Writer, cfg *Config) error {
+	v := reflect.ValueOf(*cfg)
+	fields := map[string]interface{}{}
+
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+
+		if secretFields[name] {
+			fields[name] = redact(v.Field(i).String())
+
+			continue
+		}
+
+		// every credential set carries a token
+		if sets, ok := v.Field(i).Interface().(map[string]CredentialSet); ok {
+			redacted := map[string]CredentialSet{}
+			for setName, set := range sets {
+				set.Token = redact(set.Token)
+				redacted[setName] = set
+			}
+
+			fields[name] = redacted
+
+			continue
+		}
+
+		fields[name] = dumpValue(v.Field(i))
+	}
+
+	out, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", out)
+
+	return err
+}
+
+// dumpValue converts v to a value that marshals readably: Stringers such as
+// time.Duration and net.IP as their string, structs as their exported fields.
+func dumpValue(v reflect.Value) interface{} {
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+
+	// a proxy url may carry a password
+	if u, ok := v.Interface().(*url.URL); ok {
+		return u.Redacted()
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		values := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, dumpValue(v.Index(i)))
+		}
+
+		return values
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fields[v.Type().Field(i).Name] = dumpValue(v.Field(i))
+			}
+		}
+
+		return fields
+	}
+
+	return v.Interface()
+}
+
+// redact hides all of secret but its last 4 characters, enough to tell which
+// one is configured.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	if len(secret) <= 8 {
+		return "***"
+	}
+
+	return "***" + secret[len(secret)-4:]
+}
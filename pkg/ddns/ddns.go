@@ -0,0 +1,3951 @@
+// Package ddns keeps DNS records pointed at the public address of the host it
+// runs on. It is the updater behind the do-dynamic-dns-server command, and can
+// be embedded in another program:
+//
+//	cfg, err := ddns.LoadConfig(nil) // from the DDNS_ environment
+//	if err != nil {
+//		return err
+//	}
+//	if err := cfg.Validate(); err != nil {
+//		return err
+//	}
+//	providers, err := ddns.NewProviders(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	updater := ddns.NewDDNSUpdater(cfg, providers)
+//	go updater.Run()
+//	defer updater.Shutdown(ctx)
+//
+// A Provider other than the built-in ones can be passed to NewDDNSUpdater,
+// reporting missing records and zones with ErrRecordNotFound and
+// ErrZoneNotFound.
+package ddns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	CheckIPURL              = "https://checkip.amazonaws.com/"
+	DefaultDOTimeout        = 10 * time.Second
+	DefaultZoneLockCooldown = 15 * time.Minute
+	DefaultHistorySize      = 10
+	DefaultTickGranularity  = 1 * time.Minute
+	// DefaultMinInterval is the shortest check interval accepted unless
+	// DDNS_MIN_INTERVAL is set, so a typo can't hammer the providers.
+	DefaultMinInterval = 30 * time.Second
+	// FriendlyInterval is the interval below which a warning is logged, as
+	// free ip providers may throttle more frequent checks.
+	FriendlyInterval = 1 * time.Minute
+	// DefaultHeartbeatInterval is how often DDNS_LOG_ON_CHANGE_ONLY logs that
+	// the checks are still running unless DDNS_HEARTBEAT_INTERVAL is set.
+	DefaultHeartbeatInterval = 1 * time.Hour
+	// DefaultCycleRetryBackoff is the wait before the first cycle retry; it
+	// doubles on every further retry.
+	DefaultCycleRetryBackoff = 2 * time.Second
+	// DefaultCheckIPTimeout bounds each request to the IP provider unless
+	// DDNS_CHECKIP_TIMEOUT is set.
+	DefaultCheckIPTimeout = 2 * time.Second
+	// DefaultCheckIPRetries is how often a request to an ip provider failing
+	// with a network error, 429 or 5xx is retried unless DDNS_CHECKIP_RETRIES
+	// is set. The first retry waits DefaultCheckIPRetryBackoff, doubling after.
+	DefaultCheckIPRetries      = 2
+	DefaultCheckIPRetryBackoff = 250 * time.Millisecond
+	// DefaultCheckIPMaxRedirects is how many redirects a request to an ip
+	// provider follows unless DDNS_CHECKIP_MAX_REDIRECTS is set.
+	DefaultCheckIPMaxRedirects = 10
+	// DefaultConsensusConcurrency is how many ip providers are asked at once
+	// to confirm a changed IP unless DDNS_CONSENSUS_CONCURRENCY is set, and
+	// DefaultConsensusTimeout bounds each of those lookups unless
+	// DDNS_CONSENSUS_TIMEOUT is set.
+	DefaultConsensusConcurrency = 3
+	DefaultConsensusTimeout     = 1 * time.Second
+	// MaxCheckIPBodySize caps the response of an ip provider, an address
+	// takes a few dozen bytes even wrapped in JSON.
+	MaxCheckIPBodySize = 4 << 10
+	// maxAPIBodySize caps the responses of the DNS provider APIs read here.
+	maxAPIBodySize        = 1 << 20
+	DefaultWebhookTimeout = 5 * time.Second
+	// DefaultOnChangeTimeout bounds DDNS_ON_CHANGE_CMD unless
+	// DDNS_ON_CHANGE_TIMEOUT is set.
+	DefaultOnChangeTimeout = 30 * time.Second
+	// DefaultShutdownTimeout is how long a check in progress gets to finish
+	// on shutdown unless DDNS_SHUTDOWN_TIMEOUT is set.
+	DefaultShutdownTimeout = 5 * time.Second
+	// DefaultSlowCycleWarn is how long a check may take before a warning is
+	// logged unless DDNS_SLOW_CYCLE_WARN is set.
+	DefaultSlowCycleWarn = 30 * time.Second
+	// DefaultAPIRetryBackoff is the wait before the first retry of a failed
+	// DNS provider api call; it doubles with every retry.
+	DefaultAPIRetryBackoff = 500 * time.Millisecond
+	// DORateLimitReserve is how many DO api requests are left unused before
+	// waiting for the rate limit to reset.
+	DORateLimitReserve = 10
+	// DefaultConcurrency is how many records are synced or updated at once,
+	// kept low to stay clear of provider rate limits.
+	DefaultConcurrency  = 5
+	DefaultStatsdPrefix = "ddns."
+
+	// DefaultIPProvider is used when DDNS_IP_PROVIDER is unset.
+	DefaultIPProvider = "aws"
+
+	// OutputJSON writes a CycleResult per cycle to stdout.
+	OutputJSON = "json"
+
+	// CheckIPFormatPlain reads the ip provider response as a bare address,
+	// CheckIPFormatJSON reads it from the DDNS_CHECKIP_JSON_FIELD of a JSON
+	// object and CheckIPFormatDual reads both families from the
+	// DDNS_CHECKIP_IPV4_FIELD and DDNS_CHECKIP_IPV6_FIELD of one.
+	CheckIPFormatPlain = "plain"
+	CheckIPFormatJSON  = "json"
+	CheckIPFormatDual  = "dual"
+	// DefaultCheckIPJSONField is the field read with CheckIPFormatJSON, as
+	// returned by e.g. https://api.ipify.org/?format=json.
+	DefaultCheckIPJSONField = "ip"
+	// DefaultCheckIPIPv4Field and DefaultCheckIPIPv6Field are the fields read
+	// with CheckIPFormatDual.
+	DefaultCheckIPIPv4Field = "ipv4"
+	DefaultCheckIPIPv6Field = "ipv6"
+
+	// StateBackendJSON keeps the last confirmed IPs in the JSON file at
+	// DDNS_STATE_FILE, StateBackendBolt in a bolt database there and
+	// StateBackendMemory only in memory.
+	StateBackendJSON   = "json"
+	StateBackendBolt   = "bolt"
+	StateBackendMemory = "memory"
+
+	// NotifyWebhook posts events to DDNS_WEBHOOK_URL as JSON, NotifySlack and
+	// NotifyDiscord as a message of a Slack or Discord incoming webhook.
+	NotifyWebhook = "webhook"
+	NotifySlack   = "slack"
+	NotifyDiscord = "discord"
+)
+
+// ipProviders maps preset names accepted by DDNS_IP_PROVIDER to their URLs.
+// Every preset returns the address as plain text.
+var ipProviders = map[string]string{
+	"aws":         CheckIPURL,
+	"icanhazip":   "https://icanhazip.com/",
+	"ifconfig.me": "https://ifconfig.me/ip",
+	"ipify":       "https://api.ipify.org/",
+}
+
+// resolveIPProvider returns the URL for a preset name, or provider itself when
+// it's a custom http(s) URL.
+func resolveIPProvider(provider string) (string, error) {
+	if u, ok := ipProviders[provider]; ok {
+		return u, nil
+	}
+
+	parsed, err := url.Parse(provider)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", fmt.Errorf("unknown ip provider %q, expected a preset or an http(s) URL", provider)
+	}
+
+	return provider, nil
+}
+
+// LoadConfig merges the command line flags in args, the secrets directory,
+// the environment and the optional DDNS_CONFIG_FILE into a Config. A setting
+// is taken from the first of them that has it: flags > secrets dir > env >
+// config file.
+func LoadConfig(args []string) (*Config, error) {
+	cfg := new(Config)
+
+	flags, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+
+	// the directory and file themselves can only come from flags or the environment
+	flagOrEnv := func(key string) string {
+		if value, ok := flags[key]; ok {
+			return value
+		}
+
+		return os.Getenv(key)
+	}
+
+	secrets, err := readSecretsDir(flagOrEnv("DDNS_SECRETS_DIR"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read DDNS_SECRETS_DIR: %w", err)
+	}
+
+	file, err := readConfigFile(flagOrEnv("DDNS_CONFIG_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read DDNS_CONFIG_FILE: %w", err)
+	}
+
+	// flags override values from the secrets directory, which override the
+	// environment, which overrides the config file
+	lookupenv := func(key string) (string, bool) {
+		if value, ok := flags[key]; ok {
+			return value, true
+		}
+
+		if value, ok := secrets[secretFileName(key)]; ok {
+			return value, true
+		}
+
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+
+		value, ok := file.values[secretFileName(key)]
+
+		return value, ok
+	}
+
+	// source names where the value of key came from, for validation errors
+	source := func(key string) string {
+		if _, ok := flags[key]; ok {
+			return "-" + flagName(key)
+		}
+
+		_, inSecrets := secrets[secretFileName(key)]
+		_, inEnv := os.LookupEnv(key)
+		_, inFile := file.values[secretFileName(key)]
+
+		if inFile && !inSecrets && !inEnv {
+			return fmt.Sprintf("%s in %s", secretFileName(key), file.path)
+		}
+
+		return key
+	}
+
+	getenv := func(key string) string {
+		value, _ := lookupenv(key)
+
+		return value
+	}
+
+	cfg.Provider = ProviderDigitalOcean
+	if raw := getenv("DDNS_PROVIDER"); raw != "" {
+		cfg.Provider = strings.ToLower(strings.TrimSpace(raw))
+	}
+
+	if !isProvider(cfg.Provider) {
+		return nil, fmt.Errorf("unable to parse %s: unknown provider %q", source("DDNS_PROVIDER"), cfg.Provider)
+	}
+
+	cfg.DOToken = getenv("DDNS_DO_API_TOKEN")
+	if path := getenv("DDNS_DO_API_TOKEN_FILE"); path != "" {
+		cfg.DOToken, err = readTokenFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", source("DDNS_DO_API_TOKEN_FILE"), err)
+		}
+	}
+
+	cfg.CFToken = getenv("DDNS_CF_API_TOKEN")
+	cfg.Credentials = file.credentials
+	cfg.MinInterval = DefaultMinInterval
+	if raw := getenv("DDNS_MIN_INTERVAL"); raw != "" {
+		cfg.MinInterval, err = time.ParseDuration(raw)
+		if err != nil || cfg.MinInterval <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_MIN_INTERVAL"), raw)
+		}
+	}
+
+	interval, err := time.ParseDuration(getenv("DDNS_INTERVAL"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_INTERVAL"), err)
+	}
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %s", source("DDNS_INTERVAL"), interval)
+	}
+
+	cfg.Interval = interval
+
+	if raw := getenv("DDNS_INTERVAL_JITTER"); raw != "" {
+		if strings.HasSuffix(raw, "%") {
+			var value float64
+
+			value, err = strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+			cfg.IntervalJitter = time.Duration(float64(cfg.Interval) * value / 100)
+		} else {
+			cfg.IntervalJitter, err = time.ParseDuration(raw)
+		}
+
+		if err != nil || cfg.IntervalJitter < 0 || cfg.IntervalJitter > cfg.Interval {
+			return nil, fmt.Errorf("unable to parse %s: expected a duration or percentage up to the interval, got %q", source("DDNS_INTERVAL_JITTER"), raw)
+		}
+	}
+
+	// DDNS_FORCE_SYNC_INTERVAL is an alias, the reconcile interval wins when both are set
+	for _, key := range []string{"DDNS_FORCE_SYNC_INTERVAL", "DDNS_RECONCILE_INTERVAL"} {
+		if raw := getenv(key); raw != "" {
+			cfg.ReconcileInterval, err = time.ParseDuration(raw)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %w", source(key), err)
+			}
+		}
+	}
+
+	domains := []DomainSpec{}
+	seen := map[string]bool{}
+
+	rawDomains, ok := lookupenv("DDNS_DOMAINS")
+	if !ok && file.domains != nil {
+		// domain stanzas from the config file
+		domains = file.domains
+
+		for _, spec := range domains {
+			seen[strings.ToLower(spec.Name)] = true
+		}
+	} else {
+		parts := strings.Split(rawDomains, ",")
+		for _, part := range parts {
+			// tolerates e.g. a trailing comma
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+
+			spec, err := ParseDomainSpec(part)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_DOMAINS"), err)
+			}
+
+			// a domain listed twice is managed with the options it was first listed with
+			if seen[strings.ToLower(spec.Name)] {
+				continue
+			}
+
+			seen[strings.ToLower(spec.Name)] = true
+			domains = append(domains, spec)
+		}
+	}
+
+	cfg.DomainsFile = getenv("DDNS_DOMAINS_FILE")
+	if cfg.DomainsFile != "" {
+		listed, err := readDomainsFile(cfg.DomainsFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", source("DDNS_DOMAINS_FILE"), err)
+		}
+
+		// merged after the other domains, which keep their options
+		for _, spec := range listed {
+			if !seen[strings.ToLower(spec.Name)] {
+				seen[strings.ToLower(spec.Name)] = true
+				domains = append(domains, spec)
+			}
+		}
+	}
+
+	cfg.Domains = domains
+
+	cfg.RecordTypes = []string{"A"}
+	if raw := getenv("DDNS_RECORD_TYPES"); raw != "" {
+		cfg.RecordTypes = nil
+
+		for _, part := range strings.Split(raw, ",") {
+			recType := strings.ToUpper(strings.TrimSpace(part))
+			if recType != "A" && recType != "AAAA" {
+				return nil, fmt.Errorf("unable to parse %s: unsupported record type %q", source("DDNS_RECORD_TYPES"), part)
+			}
+
+			cfg.RecordTypes = append(cfg.RecordTypes, recType)
+		}
+	}
+
+	cfg.DOTimeout = DefaultDOTimeout
+	if raw := getenv("DDNS_DO_TIMEOUT"); raw != "" {
+		cfg.DOTimeout, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_DO_TIMEOUT"), err)
+		}
+	}
+
+	if raw := getenv("DDNS_DO_API_URL"); raw != "" {
+		cfg.DOAPIURL, err = url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_DO_API_URL"), err)
+		}
+
+		if scheme := cfg.DOAPIURL.Scheme; scheme != "http" && scheme != "https" || cfg.DOAPIURL.Host == "" {
+			return nil, fmt.Errorf("unsupported %s %q, expected an http:// or https:// URL", source("DDNS_DO_API_URL"), raw)
+		}
+
+		// godo resolves its paths against the base url, which must end in a slash
+		if !strings.HasSuffix(cfg.DOAPIURL.Path, "/") {
+			cfg.DOAPIURL.Path += "/"
+		}
+	}
+
+	cfg.CheckIPTimeout = DefaultCheckIPTimeout
+	if raw := getenv("DDNS_CHECKIP_TIMEOUT"); raw != "" {
+		cfg.CheckIPTimeout, err = time.ParseDuration(raw)
+		if err != nil || cfg.CheckIPTimeout <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_CHECKIP_TIMEOUT"), raw)
+		}
+	}
+
+	cfg.CheckIPRetries = DefaultCheckIPRetries
+	if raw := getenv("DDNS_CHECKIP_RETRIES"); raw != "" {
+		cfg.CheckIPRetries, err = strconv.Atoi(raw)
+		if err != nil || cfg.CheckIPRetries < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a non-negative number, got %q", source("DDNS_CHECKIP_RETRIES"), raw)
+		}
+	}
+
+	cfg.CheckIPMaxRedirects = DefaultCheckIPMaxRedirects
+	if raw := getenv("DDNS_CHECKIP_MAX_REDIRECTS"); raw != "" {
+		cfg.CheckIPMaxRedirects, err = strconv.Atoi(raw)
+		if err != nil || cfg.CheckIPMaxRedirects < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a non-negative number, got %q", source("DDNS_CHECKIP_MAX_REDIRECTS"), raw)
+		}
+	}
+
+	cfg.ZoneLockCooldown = DefaultZoneLockCooldown
+	if raw := getenv("DDNS_ZONE_LOCK_COOLDOWN"); raw != "" {
+		cfg.ZoneLockCooldown, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_ZONE_LOCK_COOLDOWN"), err)
+		}
+	}
+
+	cfg.HistorySize = DefaultHistorySize
+	if raw := getenv("DDNS_HISTORY_SIZE"); raw != "" {
+		cfg.HistorySize, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_HISTORY_SIZE"), err)
+		}
+	}
+
+	cfg.HistoryFile = getenv("DDNS_HISTORY_FILE")
+	cfg.StateFile = getenv("DDNS_STATE_FILE")
+
+	cfg.StateBackend = StateBackendJSON
+	if raw := getenv("DDNS_STATE_BACKEND"); raw != "" {
+		cfg.StateBackend = strings.ToLower(raw)
+	}
+
+	if cfg.StateBackend != StateBackendJSON && cfg.StateBackend != StateBackendBolt && cfg.StateBackend != StateBackendMemory {
+		return nil, fmt.Errorf("unsupported %s %q, expected %q, %q or %q", source("DDNS_STATE_BACKEND"), cfg.StateBackend, StateBackendJSON, StateBackendBolt, StateBackendMemory)
+	}
+	cfg.AuditFile = getenv("DDNS_AUDIT_FILE")
+
+	cfg.AuditMaxSize = DefaultAuditMaxSize
+	if raw := getenv("DDNS_AUDIT_MAX_SIZE"); raw != "" {
+		cfg.AuditMaxSize, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || cfg.AuditMaxSize < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a non-negative number of bytes, got %q", source("DDNS_AUDIT_MAX_SIZE"), raw)
+		}
+	}
+	cfg.WebhookURL = getenv("DDNS_WEBHOOK_URL")
+	cfg.WebhookSecret = getenv("DDNS_WEBHOOK_SECRET")
+
+	cfg.Notify = NotifyWebhook
+	if raw := getenv("DDNS_NOTIFY"); raw != "" {
+		cfg.Notify = strings.ToLower(raw)
+	}
+
+	if cfg.Notify != NotifyWebhook && cfg.Notify != NotifySlack && cfg.Notify != NotifyDiscord {
+		return nil, fmt.Errorf("unsupported %s %q, expected %q, %q or %q", source("DDNS_NOTIFY"), cfg.Notify, NotifyWebhook, NotifySlack, NotifyDiscord)
+	}
+
+	cfg.WebhookTimeout = DefaultWebhookTimeout
+	if raw := getenv("DDNS_WEBHOOK_TIMEOUT"); raw != "" {
+		cfg.WebhookTimeout, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_WEBHOOK_TIMEOUT"), err)
+		}
+	}
+
+	if raw := getenv("DDNS_NOTIFY_THROTTLE"); raw != "" {
+		cfg.NotifyThrottle, err = time.ParseDuration(raw)
+		if err != nil || cfg.NotifyThrottle < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a duration of at least 0, got %q", source("DDNS_NOTIFY_THROTTLE"), raw)
+		}
+	}
+
+	cfg.OnChangeCmd = strings.TrimSpace(getenv("DDNS_ON_CHANGE_CMD"))
+
+	cfg.OnChangeTimeout = DefaultOnChangeTimeout
+	if raw := getenv("DDNS_ON_CHANGE_TIMEOUT"); raw != "" {
+		cfg.OnChangeTimeout, err = time.ParseDuration(raw)
+		if err != nil || cfg.OnChangeTimeout <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_ON_CHANGE_TIMEOUT"), raw)
+		}
+	}
+
+	cfg.UserAgent = "do-dynamic-dns-server/" + Version
+	if raw := getenv("DDNS_USER_AGENT"); raw != "" {
+		cfg.UserAgent = raw
+	}
+
+	if raw := getenv("DDNS_PROXY_URL"); raw != "" {
+		cfg.ProxyURL, err = url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_PROXY_URL"), err)
+		}
+
+		if scheme := cfg.ProxyURL.Scheme; scheme != "http" && scheme != "https" && scheme != "socks5" || cfg.ProxyURL.Host == "" {
+			return nil, fmt.Errorf("unsupported %s %q, expected an http://, https:// or socks5:// URL", source("DDNS_PROXY_URL"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_BIND_ADDRESS"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			ip := net.ParseIP(strings.TrimSpace(part))
+			if ip == nil || bindAddress(cfg.BindAddresses, familyNetwork(ip)) != nil {
+				return nil, fmt.Errorf("unable to parse %s: expected an IPv4 and/or an IPv6 address, got %q", source("DDNS_BIND_ADDRESS"), raw)
+			}
+
+			cfg.BindAddresses = append(cfg.BindAddresses, ip)
+		}
+	}
+
+	cfg.FailureAlertThreshold = DefaultFailureAlertThreshold
+	if raw := getenv("DDNS_FAILURE_ALERT_THRESHOLD"); raw != "" {
+		cfg.FailureAlertThreshold, err = strconv.Atoi(raw)
+		if err != nil || cfg.FailureAlertThreshold < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of failures, got %q", source("DDNS_FAILURE_ALERT_THRESHOLD"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_PANIC_EXIT_THRESHOLD"); raw != "" {
+		cfg.PanicExitThreshold, err = strconv.Atoi(raw)
+		if err != nil || cfg.PanicExitThreshold < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of cycles, got %q", source("DDNS_PANIC_EXIT_THRESHOLD"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_BREAKER_THRESHOLD"); raw != "" {
+		cfg.BreakerThreshold, err = strconv.Atoi(raw)
+		if err != nil || cfg.BreakerThreshold < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of cycles, got %q", source("DDNS_BREAKER_THRESHOLD"), raw)
+		}
+	}
+
+	cfg.BreakerInterval = DefaultBreakerInterval
+	if raw := getenv("DDNS_BREAKER_INTERVAL"); raw != "" {
+		cfg.BreakerInterval, err = time.ParseDuration(raw)
+		if err != nil || cfg.BreakerInterval <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_BREAKER_INTERVAL"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_IP_STABLE_FOR"); raw != "" {
+		cfg.IPStableFor, err = time.ParseDuration(raw)
+		if err != nil || cfg.IPStableFor < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a duration, got %q", source("DDNS_IP_STABLE_FOR"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_MAX_RUNTIME"); raw != "" {
+		cfg.MaxRuntime, err = time.ParseDuration(raw)
+		if err != nil || cfg.MaxRuntime <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_MAX_RUNTIME"), raw)
+		}
+	}
+
+	cfg.ShutdownTimeout = DefaultShutdownTimeout
+	if raw := getenv("DDNS_SHUTDOWN_TIMEOUT"); raw != "" {
+		cfg.ShutdownTimeout, err = time.ParseDuration(raw)
+		if err != nil || cfg.ShutdownTimeout <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_SHUTDOWN_TIMEOUT"), raw)
+		}
+	}
+
+	cfg.SlowCycleWarn = DefaultSlowCycleWarn
+	if raw := getenv("DDNS_SLOW_CYCLE_WARN"); raw != "" {
+		cfg.SlowCycleWarn, err = time.ParseDuration(raw)
+		if err != nil || cfg.SlowCycleWarn < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a duration, got %q", source("DDNS_SLOW_CYCLE_WARN"), raw)
+		}
+	}
+
+	cfg.TickGranularity = DefaultTickGranularity
+	if raw := getenv("DDNS_TICK_GRANULARITY"); raw != "" {
+		cfg.TickGranularity, err = time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_TICK_GRANULARITY"), err)
+		}
+
+		if cfg.TickGranularity <= 0 {
+			return nil, fmt.Errorf("%s must be positive", source("DDNS_TICK_GRANULARITY"))
+		}
+	}
+
+	if raw := getenv("DDNS_MANAGE_DATA_PATTERN"); raw != "" {
+		cfg.ManageDataPattern, err = newDataMatcher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_MANAGE_DATA_PATTERN"), err)
+		}
+	}
+
+	cfg.LogFormat = strings.ToLower(getenv("DDNS_LOG_FORMAT"))
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = LogFormatText
+	}
+
+	if cfg.LogFormat != LogFormatText && cfg.LogFormat != LogFormatJSON {
+		return nil, fmt.Errorf("unsupported %s %q, expected %q or %q", source("DDNS_LOG_FORMAT"), cfg.LogFormat, LogFormatText, LogFormatJSON)
+	}
+
+	if raw := getenv("DDNS_LOG_LEVEL"); raw != "" {
+		err = cfg.LogLevel.UnmarshalText([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_LOG_LEVEL"), err)
+		}
+	}
+
+	if raw := getenv("DDNS_LOG_TIMEZONE"); raw != "" {
+		cfg.LogTimezone, err = time.LoadLocation(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: expected a timezone like UTC or Europe/Berlin, got %q: %v", source("DDNS_LOG_TIMEZONE"), raw, err)
+		}
+	}
+
+	if raw := getenv("DDNS_TIME_FORMAT"); raw != "" {
+		cfg.TimeFormat = raw
+		if layout, ok := timeFormats[strings.ToLower(raw)]; ok {
+			cfg.TimeFormat = layout
+		}
+
+		// a layout without any reference time element formats as itself
+		if time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Format(cfg.TimeFormat) == cfg.TimeFormat {
+			return nil, fmt.Errorf("unable to parse %s: expected rfc3339, rfc1123, datetime, kitchen or a Go time layout, got %q", source("DDNS_TIME_FORMAT"), raw)
+		}
+	}
+
+	cfg.LogOnChangeOnly, _ = strconv.ParseBool(getenv("DDNS_LOG_ON_CHANGE_ONLY"))
+
+	cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	if raw := getenv("DDNS_HEARTBEAT_INTERVAL"); raw != "" {
+		cfg.HeartbeatInterval, err = time.ParseDuration(raw)
+		if err != nil || cfg.HeartbeatInterval <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_HEARTBEAT_INTERVAL"), raw)
+		}
+	}
+
+	cfg.Output = getenv("DDNS_OUTPUT")
+	if cfg.Output != "" && cfg.Output != OutputJSON {
+		return nil, fmt.Errorf("unsupported %s %q, expected %q", source("DDNS_OUTPUT"), cfg.Output, OutputJSON)
+	}
+
+	if raw := getenv("DDNS_CYCLE_RETRIES"); raw != "" {
+		cfg.CycleRetries, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_CYCLE_RETRIES"), err)
+		}
+	}
+
+	if raw := getenv("DDNS_MAX_RETRIES"); raw != "" {
+		cfg.MaxRetries, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_MAX_RETRIES"), err)
+		}
+	}
+
+	cfg.Watchdog = WatchdogOff
+	if raw := getenv("DDNS_WATCHDOG"); raw != "" {
+		cfg.Watchdog = raw
+	}
+
+	switch cfg.Watchdog {
+	case WatchdogOff, WatchdogLog, WatchdogExit:
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", source("DDNS_WATCHDOG"), cfg.Watchdog)
+	}
+
+	provider := DefaultIPProvider
+	if raw := getenv("DDNS_IP_PROVIDER"); raw != "" {
+		provider = raw
+	}
+
+	cfg.CheckIPURL, err = resolveIPProvider(provider)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_IP_PROVIDER"), err)
+	}
+
+	cfg.CheckIPURLs = []string{cfg.CheckIPURL}
+	if raw := getenv("DDNS_CHECKIP_URLS"); raw != "" {
+		cfg.CheckIPURLs = nil
+
+		for _, part := range strings.Split(raw, ",") {
+			u, err := resolveIPProvider(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_CHECKIP_URLS"), err)
+			}
+
+			cfg.CheckIPURLs = append(cfg.CheckIPURLs, u)
+		}
+
+		cfg.CheckIPURL = cfg.CheckIPURLs[0]
+	}
+
+	cfg.CheckIPFormat = CheckIPFormatPlain
+	if raw := getenv("DDNS_CHECKIP_FORMAT"); raw != "" {
+		cfg.CheckIPFormat = strings.ToLower(raw)
+	}
+
+	if cfg.CheckIPFormat != CheckIPFormatPlain && cfg.CheckIPFormat != CheckIPFormatJSON && cfg.CheckIPFormat != CheckIPFormatDual {
+		return nil, fmt.Errorf("unsupported %s %q, expected %q, %q or %q", source("DDNS_CHECKIP_FORMAT"), cfg.CheckIPFormat, CheckIPFormatPlain, CheckIPFormatJSON, CheckIPFormatDual)
+	}
+
+	cfg.CheckIPJSONField = DefaultCheckIPJSONField
+	if raw, ok := lookupenv("DDNS_CHECKIP_JSON_FIELD"); ok {
+		cfg.CheckIPJSONField = raw
+	}
+
+	if cfg.CheckIPJSONField == "" || strings.Contains("."+cfg.CheckIPJSONField+".", "..") {
+		return nil, fmt.Errorf("unable to parse %s: expected a field name or dot separated path, got %q", source("DDNS_CHECKIP_JSON_FIELD"), cfg.CheckIPJSONField)
+	}
+
+	cfg.CheckIPIPv4Field = DefaultCheckIPIPv4Field
+	if raw, ok := lookupenv("DDNS_CHECKIP_IPV4_FIELD"); ok {
+		cfg.CheckIPIPv4Field = raw
+	}
+
+	cfg.CheckIPIPv6Field = DefaultCheckIPIPv6Field
+	if raw, ok := lookupenv("DDNS_CHECKIP_IPV6_FIELD"); ok {
+		cfg.CheckIPIPv6Field = raw
+	}
+
+	for _, f := range []struct{ key, path string }{{"DDNS_CHECKIP_IPV4_FIELD", cfg.CheckIPIPv4Field}, {"DDNS_CHECKIP_IPV6_FIELD", cfg.CheckIPIPv6Field}} {
+		if f.path == "" || strings.Contains("."+f.path+".", "..") {
+			return nil, fmt.Errorf("unable to parse %s: expected a field name or dot separated path, got %q", source(f.key), f.path)
+		}
+	}
+
+	cfg.IPConsensus, _ = strconv.ParseBool(getenv("DDNS_IP_CONSENSUS"))
+
+	cfg.ConsensusConcurrency = DefaultConsensusConcurrency
+	if raw := getenv("DDNS_CONSENSUS_CONCURRENCY"); raw != "" {
+		cfg.ConsensusConcurrency, err = strconv.Atoi(raw)
+		if err != nil || cfg.ConsensusConcurrency < 1 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of at least 1, got %q", source("DDNS_CONSENSUS_CONCURRENCY"), raw)
+		}
+	}
+
+	cfg.ConsensusTimeout = DefaultConsensusTimeout
+	if raw := getenv("DDNS_CONSENSUS_TIMEOUT"); raw != "" {
+		cfg.ConsensusTimeout, err = time.ParseDuration(raw)
+		if err != nil || cfg.ConsensusTimeout <= 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a positive duration, got %q", source("DDNS_CONSENSUS_TIMEOUT"), raw)
+		}
+	}
+
+	cfg.IPSource = IPSourceHTTP
+	if raw := getenv("DDNS_IP_SOURCE"); raw != "" {
+		cfg.IPSource = strings.ToLower(raw)
+	}
+
+	switch cfg.IPSource {
+	case IPSourceHTTP, IPSourceDNS:
+	case IPSourceSTUN:
+		cfg.STUNServer = DefaultSTUNServer
+		if raw := getenv("DDNS_STUN_SERVER"); raw != "" {
+			cfg.STUNServer, err = parseSTUNServer(raw)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_STUN_SERVER"), err)
+			}
+		}
+	case IPSourceExternal, IPSourceNone:
+		cfg.IPSource = IPSourceExternal
+		cfg.IPFile = getenv("DDNS_IP_FILE")
+	case IPSourceFile:
+		cfg.IPFile = getenv("DDNS_IP_FILE")
+	case IPSourceInterface, IPSourceAuto:
+		cfg.Interface = getenv("DDNS_INTERFACE")
+
+		cfg.IPv6Address = IPv6AddressStable
+		if raw := getenv("DDNS_IPV6_ADDRESS"); raw != "" {
+			cfg.IPv6Address = strings.ToLower(raw)
+			if cfg.IPv6Address != IPv6AddressStable && cfg.IPv6Address != IPv6AddressPrivacy {
+				return nil, fmt.Errorf("unable to parse %s: expected %q or %q, got %q", source("DDNS_IPV6_ADDRESS"), IPv6AddressStable, IPv6AddressPrivacy, raw)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported %s %q, expected %q, %q, %q, %q, %q, %q or %q", source("DDNS_IP_SOURCE"), cfg.IPSource, IPSourceHTTP, IPSourceDNS, IPSourceSTUN, IPSourceInterface, IPSourceAuto, IPSourceExternal, IPSourceFile)
+	}
+
+	cfg.CheckReachability, _ = strconv.ParseBool(getenv("DDNS_CHECK_REACHABILITY"))
+	cfg.RecreateDeleted, _ = strconv.ParseBool(getenv("DDNS_RECREATE_DELETED"))
+	cfg.CreateMissing, _ = strconv.ParseBool(getenv("DDNS_CREATE_MISSING"))
+	cfg.RequireAllDomains, _ = strconv.ParseBool(getenv("DDNS_REQUIRE_ALL_DOMAINS"))
+	cfg.LazySync, _ = strconv.ParseBool(getenv("DDNS_LAZY_SYNC"))
+
+	cfg.VerifyAfterUpdate, _ = strconv.ParseBool(getenv("DDNS_VERIFY_AFTER_UPDATE"))
+	cfg.ReadBeforeUpdate, _ = strconv.ParseBool(getenv("DDNS_READ_BEFORE_UPDATE"))
+	cfg.AlwaysFetchBeforeUpdate, _ = strconv.ParseBool(getenv("DDNS_ALWAYS_FETCH_BEFORE_UPDATE"))
+	cfg.RollbackOnPartial, _ = strconv.ParseBool(getenv("DDNS_ROLLBACK_ON_PARTIAL"))
+	cfg.OneShot, _ = strconv.ParseBool(getenv("DDNS_ONE_SHOT"))
+	cfg.PrintConfig, _ = strconv.ParseBool(getenv("DDNS_PRINT_CONFIG"))
+
+	if raw := getenv("DDNS_TTL"); raw != "" {
+		cfg.TTL, err = strconv.Atoi(raw)
+		if err != nil || cfg.TTL < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of seconds, got %q", source("DDNS_TTL"), raw)
+		}
+	}
+
+	if raw := getenv("DDNS_MIN_TTL"); raw != "" {
+		cfg.MinTTL, err = strconv.Atoi(raw)
+		if err != nil || cfg.MinTTL < 0 {
+			return nil, fmt.Errorf("unable to parse %s: expected a number of seconds, got %q", source("DDNS_MIN_TTL"), raw)
+		}
+	}
+
+	cfg.SkipOverdue, _ = strconv.ParseBool(getenv("DDNS_SKIP_OVERDUE"))
+	cfg.StatsdAddr = getenv("DDNS_STATSD_ADDR")
+	cfg.HealthAddr = getenv("DDNS_HEALTH_ADDR")
+	cfg.MetricsAddr = getenv("DDNS_METRICS_ADDR")
+	cfg.StatusAddr = getenv("DDNS_STATUS_ADDR")
+	cfg.APIToken = getenv("DDNS_API_TOKEN")
+	cfg.StatsdPrefix = DefaultStatsdPrefix
+	if raw, ok := lookupenv("DDNS_STATSD_PREFIX"); ok {
+		cfg.StatsdPrefix = raw
+	}
+
+	if raw := getenv("DDNS_STATSD_TAGS"); raw != "" {
+		cfg.StatsdTags = strings.Split(raw, ",")
+	}
+
+	cfg.DebugAddr = DefaultDebugAddr
+	if raw := getenv("DDNS_DEBUG_ADDR"); raw != "" {
+		cfg.DebugAddr = raw
+	}
+
+	cfg.Debug, _ = strconv.ParseBool(getenv("DDNS_DEBUG"))
+	cfg.AdoptExisting, _ = strconv.ParseBool(getenv("DDNS_ADOPT_EXISTING"))
+	cfg.IPv6Optional, _ = strconv.ParseBool(getenv("DDNS_IPV6_OPTIONAL"))
+	cfg.AllowPrivateIPs, _ = strconv.ParseBool(getenv("DDNS_ALLOW_PRIVATE_IPS"))
+	cfg.AllowReservedIPs, _ = strconv.ParseBool(getenv("DDNS_ALLOW_RESERVED_IPS"))
+	cfg.UpdateAllRecords, _ = strconv.ParseBool(getenv("DDNS_UPDATE_ALL_RECORDS"))
+
+	cfg.Concurrency = DefaultConcurrency
+	if raw := getenv("DDNS_CONCURRENCY"); raw != "" {
+		cfg.Concurrency, err = strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", source("DDNS_CONCURRENCY"), err)
+		}
+
+		if cfg.Concurrency < 1 {
+			return nil, fmt.Errorf("%s must be at least 1, got %d", source("DDNS_CONCURRENCY"), cfg.Concurrency)
+		}
+	}
+	cfg.DryRun, _ = strconv.ParseBool(getenv("DDNS_DRY_RUN"))
+
+	if raw := getenv("DDNS_BLOCKLIST_IPS"); raw != "" {
+		for _, part := range strings.Split(raw, ",") {
+			ip := net.ParseIP(strings.TrimSpace(part))
+			if ip == nil {
+				return nil, fmt.Errorf("unable to parse %s: invalid ip %q", source("DDNS_BLOCKLIST_IPS"), part)
+			}
+
+			cfg.BlocklistIPs = append(cfg.BlocklistIPs, ip)
+		}
+	}
+
+	return cfg, nil
+}
+
+// secretFileName maps an environment variable to its file name in the secrets
+// directory, e.g. DDNS_DO_API_TOKEN becomes do_api_token.
+func secretFileName(key string) string {
+	return strings.ToLower(strings.TrimPrefix(key, "DDNS_"))
+}
+
+// readSecretsDir reads every regular file in dir into a map keyed by file name.
+// An empty dir yields an empty map.
+func readSecretsDir(dir string) (map[string]string, error) {
+	secrets := map[string]string{}
+
+	if dir == "" {
+		return secrets, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		// mounted secrets are often symlinks, so stat through them
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret %s: %w", entry.Name(), err)
+		}
+
+		secrets[entry.Name()] = strings.TrimRight(string(contents), "\r\n")
+	}
+
+	return secrets, nil
+}
+
+// readTokenFile reads an api token from a mounted secret file at path,
+// trimming surrounding whitespace.
+func readTokenFile(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+
+	return token, nil
+}
+
+type Config struct {
+	// DNS backend records are managed through, "digitalocean", "cloudflare" or
+	// "route53".
+	Provider string
+	DOToken  string
+	CFToken  string
+	// Named provider accounts from the credentials section of the config
+	// file, which domains select by name like a provider.
+	Credentials map[string]CredentialSet
+	// Timeout for each DNS provider API request.
+	DOTimeout time.Duration
+	// Optional DO API compatible endpoint replacing the default godo base url.
+	DOAPIURL *url.URL
+	// Timeout for each request to an IP provider, independent of DOTimeout.
+	CheckIPTimeout time.Duration
+	// Quick retries of a request to an IP provider failing with a transient
+	// error, before falling back to the next provider.
+	CheckIPRetries int
+	// Redirects a request to an IP provider follows, 0 refuses any redirect.
+	CheckIPMaxRedirects int
+	// How long to pause updates for a zone after DO reports it as locked.
+	ZoneLockCooldown time.Duration
+	// URL the public IP is read from, the first of CheckIPURLs.
+	CheckIPURL string
+	// URLs tried in order until one returns the public IP.
+	CheckIPURLs []string
+	// How ip provider responses are read, CheckIPFormatPlain,
+	// CheckIPFormatJSON or CheckIPFormatDual, and the dot separated field
+	// paths of the latter two.
+	CheckIPFormat    string
+	CheckIPJSONField string
+	CheckIPIPv4Field string
+	CheckIPIPv6Field string
+	// Require two providers to agree on an IP before accepting a change.
+	IPConsensus bool
+	// How many ip providers confirm a changed IP at once, and the timeout of
+	// each of those lookups.
+	ConsensusConcurrency int
+	ConsensusTimeout     time.Duration
+	// How long a changed IP must be detected at every check before records
+	// are updated to it, 0 updates right away.
+	IPStableFor time.Duration
+	// Where the public IP is read from, "http", "dns", "stun", "interface",
+	// "auto", "external" or "file", the STUN server asked by "stun", the
+	// network interface used by "interface" and "auto" and the file read by
+	// "file", or by "external" for pushed IPs besides POST /set-ip.
+	IPSource   string
+	STUNServer string
+	Interface  string
+	IPFile     string
+	// Which global IPv6 address of Interface an AAAA record gets,
+	// IPv6AddressStable or IPv6AddressPrivacy.
+	IPv6Address string
+	// Also request the IP provider over IPv4 and IPv6 separately each cycle
+	// and log which families reached it.
+	CheckReachability bool
+	// Valid time units are "ns", "us" (or "µs"), "ms", "s", "m", "h".
+	Interval time.Duration
+	// Shortest Interval, or domain interval, that is accepted.
+	MinInterval time.Duration
+	// Upper bound of a random delay added to every interval, so instances
+	// restarted together drift apart.
+	IntervalJitter time.Duration
+	// Interval between re-fetching records from the provider to correct drift.
+	// Zero disables reconciliation.
+	ReconcileInterval time.Duration
+	// The longest the run loop sleeps before re-reading the clock, bounding
+	// how late a check runs after e.g. a suspend. It otherwise sleeps until
+	// the next check is due; shutdown doesn't wait for it.
+	TickGranularity time.Duration
+	// Domains to update, parsed from the comma separated DDNS_DOMAINS entries
+	// like "home.example.com=60" or "home.example.com@record=home", see
+	// ParseDomainSpec, followed by those of DDNS_DOMAINS_FILE.
+	Domains []DomainSpec
+	// Record types to manage for every domain, A and/or AAAA.
+	RecordTypes []string
+	Debug       bool
+	// Address the debug server listens on with Debug.
+	DebugAddr string
+	// Comma separated list of IPs that must never be written, e.g. a captive
+	// portal address returned during a provider outage.
+	BlocklistIPs []net.IP
+	// Leave existing records untouched on the first check and only update them
+	// once the detected IP changes.
+	AdoptExisting bool
+	// Leave AAAA records as they are when no IPv6 address is detected, instead
+	// of failing the check, for connections where IPv6 comes and goes.
+	IPv6Optional bool
+	// Publish private, loopback and link-local addresses instead of rejecting
+	// them, e.g. for a split-horizon zone.
+	AllowPrivateIPs bool
+	// Publish addresses in reserved ranges such as CGNAT and documentation
+	// space, which are rejected like private ones otherwise.
+	AllowReservedIPs bool
+	// Update every record sharing a name and type, e.g. round-robin A
+	// records, instead of only the one with the lowest ID.
+	UpdateAllRecords bool
+	// How many records are synced or updated at once.
+	Concurrency int
+	// Log the writes that would be made instead of making them.
+	DryRun bool
+	// Only records whose current data matches are managed. Nil manages all records.
+	ManageDataPattern dataMatcher
+	// Machine-readable per-cycle output written to stdout, e.g. "json".
+	Output string
+	// Log format, "text" or "json", and the minimum level logged.
+	LogFormat string
+	LogLevel  slog.Level
+	// Timezone and layout of logged timestamps, nil for the local timezone
+	// and empty for RFC 3339.
+	LogTimezone *time.Location
+	TimeFormat  string
+	// Only log the next check of cycles that changed something or failed,
+	// with a heartbeat every HeartbeatInterval in between.
+	LogOnChangeOnly   bool
+	HeartbeatInterval time.Duration
+	// Number of times a failed cycle is retried before the next interval.
+	CycleRetries int
+	// Retries for DigitalOcean api calls failing with a network error, 429 or 5xx.
+	MaxRetries int
+	// What the watchdog does when no cycle completes within a few intervals:
+	// "off", "log" or "exit".
+	Watchdog string
+	// Recreate a managed record with the current IP when it was deleted outside
+	// of this tool.
+	RecreateDeleted bool
+	// Create records that don't exist yet with the current IP instead of skipping them.
+	CreateMissing bool
+	// Abort startup when a record of a domain wasn't found by the initial sync,
+	// unless CreateMissing creates it.
+	RequireAllDomains bool
+	// Skip the initial sync and look up each record on its first update.
+	LazySync bool
+	// Revert the records of a domain written in a cycle in which a record of
+	// another type of the domain failed to update.
+	RollbackOnPartial bool
+	// Re-fetch every updated record from the provider and fail the update
+	// unless it holds the new data.
+	VerifyAfterUpdate bool
+	// Look up the live record before writing it and skip the write when it
+	// already holds the new data.
+	ReadBeforeUpdate bool
+	// Like ReadBeforeUpdate, but the live record is also looked up when the
+	// cached one already holds the new data.
+	AlwaysFetchBeforeUpdate bool
+	// Run a single check and exit instead of looping, e.g. from cron.
+	OneShot bool
+	// Print the parsed config as JSON, secrets redacted, and exit.
+	PrintConfig bool
+	// How long to run before shutting down cleanly, 0 runs until stopped.
+	MaxRuntime time.Duration
+	// How long a check in progress gets to finish its writes on shutdown.
+	ShutdownTimeout time.Duration
+	// How long a check may take before a warning is logged, 0 never warns.
+	SlowCycleWarn time.Duration
+	// TTL in seconds written to managed records, 0 keeps the existing TTL (and
+	// uses the provider default for created records).
+	TTL int
+	// Lowest TTL in seconds written to a record, any lower TTL is raised to it
+	// on update. 0 disables the floor.
+	MinTTL int
+	// When a cycle takes longer than the interval, schedule the next check a
+	// full interval after it ends instead of running the overdue check at once.
+	SkipOverdue bool
+	// Optional listen address of the /healthz and /readyz server, e.g. :8080.
+	HealthAddr string
+	// Optional listen address of the Prometheus /metrics server, e.g. :9101.
+	MetricsAddr string
+	// Optional listen address of the JSON /status and POST /check server, e.g. :8081.
+	StatusAddr string
+	// Bearer token enabling POST /set-ip on the status server.
+	APIToken string
+	// Optional StatsD/DogStatsD UDP address, e.g. localhost:8125.
+	StatsdAddr string
+	// Prefix for every StatsD metric name.
+	StatsdPrefix string
+	// DogStatsD "key:value" tags sent with every metric.
+	StatsdTags []string
+	// Number of IP changes kept in the history. Zero disables it.
+	HistorySize int
+	// Optional file the history is persisted to.
+	HistoryFile string
+	// Optional file listing more domains, one DDNS_DOMAINS entry per line.
+	DomainsFile string
+	// Optional file the last confirmed IPs are persisted to and seeded from.
+	StateFile string
+	// Where the last confirmed IPs are kept, StateBackendJSON,
+	// StateBackendBolt or StateBackendMemory.
+	StateBackend string
+	// Optional JSON lines file every record write is appended to.
+	AuditFile string
+	// Size in bytes past which AuditFile is rotated, 0 never rotates it.
+	AuditMaxSize int64
+	// Optional URL an event is posted to after every IP change.
+	WebhookURL string
+	// Optional secret the webhook body is signed with.
+	WebhookSecret  string
+	WebhookTimeout time.Duration
+	// How events are posted to WebhookURL: NotifyWebhook, NotifySlack or
+	// NotifyDiscord.
+	Notify string
+	// Shortest time between two failure or breaker alerts of the same record
+	// or breaker, 0 sends every alert.
+	NotifyThrottle time.Duration
+	// Consecutive failed writes of a record posting a failure event to the
+	// webhook, 0 disables failure events.
+	FailureAlertThreshold int
+	// Cycles in a row that panic before the process exits, 0 keeps running.
+	PanicExitThreshold int
+	// Cycles in a row that fail before checks pause for BreakerInterval, 0
+	// disables the breaker.
+	BreakerThreshold int
+	BreakerInterval  time.Duration
+	// Optional command run after every IP change with the old and new IP, and
+	// how long it may run before it is killed.
+	OnChangeCmd     string
+	OnChangeTimeout time.Duration
+	// Proxy every outbound request goes through, overriding HTTP_PROXY and
+	// HTTPS_PROXY when set.
+	ProxyURL *url.URL
+	// Local addresses ip provider requests go out from, at most one per
+	// family.
+	BindAddresses []net.IP
+	// User-Agent of requests to the ip providers, the DNS provider APIs and
+	// the webhook.
+	UserAgent string
+}
+
+// recordKey identifies a managed record by its configured domain name and type.
+type recordKey struct {
+	Name string
+	Type string
+}
+
+func (k recordKey) String() string {
+	return k.Name + "/" + k.Type
+}
+
+// DomainSpec is a single entry of DDNS_DOMAINS. Options are appended to the
+// domain name with "@", e.g. "home.example.com@record=home".
+type DomainSpec struct {
+	// Name is the configured domain name, e.g. home.example.com.
+	Name string
+	// RecordName is the exact relative record name (e.g. "@" or
+	// "home") to match during sync. When empty it is derived from the public suffix list.
+	RecordName string
+	// Required domains are retried immediately when an update fails and the
+	// failure is logged as an error.
+	Required bool
+	// TTL in seconds for this domain's records, overriding DDNS_TTL. 0 uses DDNS_TTL.
+	TTL int
+	// Types overrides DDNS_RECORD_TYPES for this domain when not nil.
+	Types []string
+	// Provider overrides DDNS_PROVIDER for this domain when not empty.
+	Provider string
+	// Secondary is a provider the records are mirrored to, best effort, when
+	// not empty.
+	Secondary string
+	// Interval overrides DDNS_INTERVAL for this domain when not 0.
+	Interval time.Duration
+	// Value is the template of the data of TXT and CNAME records, rendered
+	// with the detected IPs as {{.IPv4}} and {{.IPv6}}.
+	Value string
+	// Apex is the zone of the domain when not empty, instead of deriving it
+	// from the public suffix list, e.g. for a private TLD.
+	Apex string
+	// Target derives the data of the A and AAAA records from the detected IP
+	// when not empty, see parseTargets.
+	Target string
+
+	valueTemplate *template.Template
+	// record type: target, missing for types holding the detected IP
+	targets map[string]ipTarget
+}
+
+// readDomainsFile parses the file at path holding one DDNS_DOMAINS entry per
+// line. Blank lines and everything from a # on are ignored.
+func readDomainsFile(path string) ([]DomainSpec, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	domains := []DomainSpec{}
+
+	for i, line := range strings.Split(string(contents), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		spec, err := ParseDomainSpec(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		domains = append(domains, spec)
+	}
+
+	return domains, nil
+}
+
+// ParseDomainSpec parses a single DDNS_DOMAINS entry.
+func ParseDomainSpec(raw string) (DomainSpec, error) {
+	// a leading @ label names the apex, e.g. @.example.com for example.com,
+	// and isn't an option separator
+	name, _ := strings.CutPrefix(strings.TrimSpace(raw), "@.")
+
+	parts := strings.Split(name, "@")
+	spec := DomainSpec{Name: strings.TrimSpace(parts[0])}
+
+	// host.example.com=60 is shorthand for host.example.com@ttl=60
+	if host, rawTTL, ok := strings.Cut(spec.Name, "="); ok {
+		spec.Name = strings.TrimSpace(host)
+
+		ttl, err := strconv.Atoi(strings.TrimSpace(rawTTL))
+		if err != nil || ttl <= 0 {
+			return spec, fmt.Errorf("domain %s: ttl requires a positive number of seconds", spec.Name)
+		}
+
+		spec.TTL = ttl
+	}
+
+	if spec.Name == "" {
+		return spec, fmt.Errorf("domain %q: name is required", raw)
+	}
+
+	for _, option := range parts[1:] {
+		key, value, _ := strings.Cut(option, "=")
+
+		switch key {
+		case "record":
+			if value == "" {
+				return spec, fmt.Errorf("domain %s: record option requires a value", spec.Name)
+			}
+
+			spec.RecordName = value
+		case "required":
+			spec.Required = true
+		case "ttl":
+			ttl, err := strconv.Atoi(value)
+			if err != nil || ttl <= 0 {
+				return spec, fmt.Errorf("domain %s: ttl option requires a positive number of seconds", spec.Name)
+			}
+
+			spec.TTL = ttl
+		case "interval":
+			interval, err := time.ParseDuration(value)
+			if err != nil || interval <= 0 {
+				return spec, fmt.Errorf("domain %s: interval option requires a positive duration", spec.Name)
+			}
+
+			spec.Interval = interval
+		case "apex":
+			if value == "" {
+				return spec, fmt.Errorf("domain %s: apex option requires a value", spec.Name)
+			}
+
+			spec.Apex = value
+		case "target":
+			targets, err := parseTargets(value)
+			if err != nil {
+				return spec, fmt.Errorf("domain %s: target option: %v", spec.Name, err)
+			}
+
+			spec.Target = value
+			spec.targets = targets
+		default:
+			return spec, fmt.Errorf("domain %s: unknown option %q", spec.Name, key)
+		}
+	}
+
+	return spec, nil
+}
+
+// dataMatcher decides whether a record's current data may be managed.
+type dataMatcher interface {
+	Match(data string) bool
+}
+
+// cidrMatcher matches record data that is an IP within a network.
+type cidrMatcher struct {
+	network *net.IPNet
+}
+
+func (c cidrMatcher) Match(data string) bool {
+	ip := net.ParseIP(data)
+
+	return ip != nil && c.network.Contains(ip)
+}
+
+func (c cidrMatcher) String() string { return c.network.String() }
+
+// regexpMatcher matches record data against a regular expression.
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (r regexpMatcher) Match(data string) bool {
+	return r.re.MatchString(data)
+}
+
+func (r regexpMatcher) String() string { return r.re.String() }
+
+// newDataMatcher builds a CIDR matcher when pattern is a network and a
+// regular expression matcher otherwise.
+func newDataMatcher(pattern string) (dataMatcher, error) {
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return cidrMatcher{network: network}, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return regexpMatcher{re: re}, nil
+}
+
+// NewDDNSUpdater creates a new DDNS updater that manages records through
+// providers, keyed by provider name
+func NewDDNSUpdater(cfg *Config, providers map[string]Provider) *DDNSUpdater {
+	if cfg.Interval < FriendlyInterval {
+		slog.Warn("interval is short, ip providers may throttle checks", "interval", cfg.Interval, "recommended", FriendlyInterval)
+	}
+
+	history, err := newIPHistory(cfg.HistorySize, cfg.HistoryFile)
+	if err != nil {
+		slog.Warn("unable to load ip history, starting empty", "error", err)
+	}
+
+	confirmedIPs := map[string]net.IP{}
+	currentIPs := map[string]net.IP{}
+
+	state, err := newStateStore(cfg)
+	if err != nil {
+		slog.Warn("unable to open the state store, not persisting state", "error", err)
+	}
+
+	if state != nil {
+		confirmedIPs, err = state.Load()
+		if err != nil {
+			slog.Warn("unable to load state, starting without prior ips", "error", err)
+		}
+
+		for recType, ip := range confirmedIPs {
+			slog.Info("last confirmed ip", "type", recType, "ip", ip.String())
+
+			currentIPs[recType] = ip
+		}
+	}
+
+	domainTable, specs, recordTypes := domainRecords(cfg)
+
+	var statsd *statsdClient
+	if cfg.StatsdAddr != "" {
+		statsd, err = newStatsdClient(cfg.StatsdAddr, cfg.StatsdPrefix, cfg.StatsdTags)
+		if err != nil {
+			slog.Warn("statsd disabled", "error", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var webhook *webhookNotifier
+	if cfg.WebhookURL != "" {
+		webhook = newWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret, cfg.Notify, cfg.UserAgent, newHTTPClient(cfg.WebhookTimeout, cfg.ProxyURL), cfg.NotifyThrottle)
+	}
+
+	var onChange *changeHook
+	if cfg.OnChangeCmd != "" {
+		onChange = newChangeHook(cfg.OnChangeCmd, cfg.OnChangeTimeout)
+	}
+
+	var metrics *metrics
+	if cfg.MetricsAddr != "" {
+		metrics = newMetrics()
+	}
+
+	var familyClients map[string]*http.Client
+	if cfg.CheckReachability {
+		familyClients = map[string]*http.Client{
+			"tcp4": limitRedirects(familyClient("tcp4", cfg.CheckIPTimeout, cfg.ProxyURL, bindAddress(cfg.BindAddresses, "tcp4")), cfg.CheckIPMaxRedirects),
+			"tcp6": limitRedirects(familyClient("tcp6", cfg.CheckIPTimeout, cfg.ProxyURL, bindAddress(cfg.BindAddresses, "tcp6")), cfg.CheckIPMaxRedirects),
+		}
+	}
+
+	// a bound address pins A checks to its family, where any family works otherwise
+	httpClient := newHTTPClient(cfg.CheckIPTimeout, cfg.ProxyURL)
+	if local := bindAddress(cfg.BindAddresses, "tcp4"); local != nil {
+		httpClient = familyClient("tcp4", cfg.CheckIPTimeout, cfg.ProxyURL, local)
+	}
+
+	limitRedirects(httpClient, cfg.CheckIPMaxRedirects)
+
+	d := &DDNSUpdater{
+		httpClient:        *httpClient,
+		checkIPTimeout:    cfg.CheckIPTimeout,
+		checkIPRetries:    cfg.CheckIPRetries,
+		userAgent:         cfg.UserAgent,
+		checkIPURL:        cfg.CheckIPURL,
+		checkIPURLs:       cfg.CheckIPURLs,
+		sources:           newSourceScorer(),
+		started:           time.Now(),
+		checkIPFormat:     cfg.CheckIPFormat,
+		checkIPField:      cfg.CheckIPJSONField,
+		dualFields:        map[string]string{"A": cfg.CheckIPIPv4Field, "AAAA": cfg.CheckIPIPv6Field},
+		dual:              &dualAnswers{},
+		ipSource:          cfg.IPSource,
+		ipFile:            cfg.IPFile,
+		iface:             cfg.Interface,
+		ipv6Address:       cfg.IPv6Address,
+		stunServer:        cfg.STUNServer,
+		ipConsensus:       cfg.IPConsensus,
+		consensusWorkers:  cfg.ConsensusConcurrency,
+		consensusTimeout:  cfg.ConsensusTimeout,
+		stableFor:         cfg.IPStableFor,
+		candidates:        map[string]candidateIP{},
+		familyClients:     familyClients,
+		providers:         providers,
+		defaultProvider:   cfg.Provider,
+		credentialTypes:   credentialTypes(cfg),
+		interval:          cfg.Interval,
+		jitter:            cfg.IntervalJitter,
+		recordMap:         domainTable,
+		siblings:          map[recordKey][]Record{},
+		updatedAt:         map[recordKey]time.Time{},
+		updateAll:         cfg.UpdateAllRecords,
+		concurrency:       cfg.Concurrency,
+		secondaryRecords:  map[recordKey]Record{},
+		secondaryFailures: map[recordKey]int{},
+		specs:             specs,
+		nextCheck:         time.Now(),
+		domainNext:        map[string]time.Time{},
+		blocklist:         cfg.BlocklistIPs,
+		adopt:             cfg.AdoptExisting,
+		ipv6Optional:      cfg.IPv6Optional,
+		allowPrivate:      cfg.AllowPrivateIPs,
+		allowReserved:     cfg.AllowReservedIPs,
+		dryRun:            cfg.DryRun,
+		history:           history,
+		auditLog:          newAuditLog(cfg.AuditFile, cfg.AuditMaxSize),
+		logger:            slog.Default(),
+		recordTypes:       recordTypes,
+		currentIPs:        currentIPs,
+		confirmedIPs:      confirmedIPs,
+		state:             state,
+		ipv6Client:        limitRedirects(familyClient("tcp6", cfg.CheckIPTimeout, cfg.ProxyURL, bindAddress(cfg.BindAddresses, "tcp6")), cfg.CheckIPMaxRedirects),
+		dataPattern:       cfg.ManageDataPattern,
+		output:            cfg.Output,
+		cycleRetries:      cfg.CycleRetries,
+		watchdog:          cfg.Watchdog,
+		recreateDeleted:   cfg.RecreateDeleted,
+		createMissing:     cfg.CreateMissing,
+		verifyUpdates:     cfg.VerifyAfterUpdate,
+		readBeforeUpdate:  cfg.ReadBeforeUpdate,
+		// a pushed ip is re-asserted against the live records
+		alwaysFetch:       cfg.AlwaysFetchBeforeUpdate || cfg.IPSource == IPSourceExternal,
+		requireAll:        cfg.RequireAllDomains,
+		rollbackOnPartial: cfg.RollbackOnPartial,
+		written:           map[recordKey][]Record{},
+		failed:            map[recordKey]bool{},
+		lazySync:          cfg.LazySync,
+		ttl:               cfg.TTL,
+		minTTL:            cfg.MinTTL,
+		skipOverdue:       cfg.SkipOverdue,
+		logOnChangeOnly:   cfg.LogOnChangeOnly,
+		statsd:            statsd,
+		metrics:           metrics,
+		webhook:           webhook,
+		onChange:          onChange,
+
+		failureThreshold:  cfg.FailureAlertThreshold,
+		panicThreshold:    cfg.PanicExitThreshold,
+		breakerThreshold:  cfg.BreakerThreshold,
+		breakerInterval:   cfg.BreakerInterval,
+		breakerState:      BreakerClosed,
+		heartbeatInterval: cfg.HeartbeatInterval,
+		slowCycleWarn:     cfg.SlowCycleWarn,
+		failures:          map[recordKey]int{},
+		lastErrors:        map[recordKey]string{},
+		unsynced:          map[recordKey]bool{},
+		zoneLockCooldown:  cfg.ZoneLockCooldown,
+		zoneCooldown:      map[string]time.Time{},
+		recheck:           map[recordKey]bool{},
+		tick:              cfg.TickGranularity,
+		stop:              make(chan struct{}),
+		reload:            make(chan *Config, 1),
+		force:             make(chan struct{}, 1),
+		overrides:         make(chan ipOverride),
+		apiToken:          cfg.APIToken,
+		done:              make(chan struct{}),
+		ctx:               ctx,
+		cancel:            cancel,
+
+		reconcileInterval: cfg.ReconcileInterval,
+		nextReconcile:     time.Now().Add(cfg.ReconcileInterval),
+	}
+
+	d.setCheckWindow()
+
+	return d
+}
+
+type DDNSUpdater struct {
+	httpClient http.Client
+	// primary ip provider, also used for reachability checks
+	checkIPURL string
+	// ip providers in the configured order, tried in the order of sources
+	checkIPURLs []string
+	sources     *sourceScorer
+	// CheckIPFormatPlain, CheckIPFormatJSON reading checkIPField, or
+	// CheckIPFormatDual
+	checkIPFormat string
+	checkIPField  string
+	// CheckIPFormatDual: record type: field path, and the answers kept for
+	// the other type
+	dualFields map[string]string
+	dual       *dualAnswers
+	// require two providers to agree before accepting an ip change
+	ipConsensus bool
+	// how many providers confirm a changed ip at once, each within consensusTimeout
+	consensusWorkers int
+	consensusTimeout time.Duration
+	// how long a changed ip must persist before it is written
+	stableFor time.Duration
+	// record type: changed ip waiting to be stable
+	candidates map[string]candidateIP
+	// IPSourceHTTP, IPSourceDNS, IPSourceSTUN, IPSourceInterface,
+	// IPSourceAuto, IPSourceExternal or IPSourceFile, asking stunServer for
+	// IPSourceSTUN, reading iface for IPSourceInterface and IPSourceAuto and
+	// ipFile for IPSourceFile and, when set, IPSourceExternal
+	ipSource   string
+	stunServer string
+	iface      string
+	ipFile     string
+	// IPv6AddressStable or IPv6AddressPrivacy, the address of iface for AAAA
+	ipv6Address string
+	// network: client forced onto that family, set when checking reachability
+	familyClients map[string]*http.Client
+	// bounds each request to an ip provider
+	checkIPTimeout time.Duration
+	// quick retries of a transient ip provider failure
+	checkIPRetries int
+	// sent with every request to an ip provider
+	userAgent string
+	// provider name: provider, domains use defaultProvider unless they select one
+	providers       map[string]Provider
+	defaultProvider string
+	// credential set name: its provider type
+	credentialTypes map[string]string
+	// domain and type: record
+	recordMap map[recordKey]Record
+	// domain and type: further records sharing the name, managed with updateAll
+	siblings  map[recordKey][]Record
+	updateAll bool
+	// domain and type: last successful write, for the status server
+	updatedAt map[recordKey]time.Time
+	// records synced or updated at once; mu guards the record caches,
+	// recheck, zoneCooldown and cycle while workers run
+	concurrency int
+	mu          sync.Mutex
+	// domain: per-domain options
+	specs    map[string]DomainSpec
+	interval time.Duration
+	// upper bound of the random delay added to each interval
+	jitter time.Duration
+	// when a detected ip was last written to the records, whether or not
+	// every write succeeded
+	lastSet time.Time
+	// end of the last check after which every record held the current ip
+	lastSuccess time.Time
+	// when the updater was created, staleness counts from it before the
+	// first success
+	started time.Time
+	// earliest of domainNext, when the run loop checks next
+	nextCheck time.Time
+	// domain: next check, due immediately when missing
+	domainNext map[string]time.Time
+	// domains handled by the check in progress, nil outside of a check
+	due map[string]bool
+	// longest interval of any domain in nanoseconds, read by the health
+	// server and watchdog
+	checkWindow atomic.Int64
+	// record type: last ip written
+	currentIPs map[string]net.IP
+	// record type: last ip every record was updated to, persisted to state
+	confirmedIPs map[string]net.IP
+	state        StateStore
+	blocklist    []net.IP
+	adopt        bool
+	// a failed AAAA check leaves the records as they are, see errIPv6Unavailable
+	ipv6Optional bool
+	// publish addresses validatePublic would reject, or only the reserved ones
+	allowPrivate  bool
+	allowReserved bool
+	// log provider writes instead of making them
+	dryRun  bool
+	history *ipHistory
+	// nil unless DDNS_AUDIT_FILE is set
+	auditLog *auditLog
+	logger   *slog.Logger
+	// record types managed for every domain, e.g. A and AAAA. Replaced under
+	// mu, as POST /set-ip reads it from the status server.
+	recordTypes []string
+	// used to detect the IPv6 address for AAAA records
+	ipv6Client *http.Client
+	// only records whose data matches are touched
+	dataPattern dataMatcher
+	output      string
+	// how often a failed cycle is retried before waiting for the next interval
+	cycleRetries int
+	// result of the cycle in progress
+	cycle *CycleResult
+	// completion time of the last cycle in unix nanoseconds, read by the watchdog
+	lastCycle atomic.Int64
+	watchdog  string
+	// recreate records deleted outside of this tool instead of dropping them
+	recreateDeleted bool
+	// create records the provider doesn't have
+	createMissing bool
+	// fail startup when a record isn't found by the initial sync
+	requireAll bool
+	// look records up on their first update instead of at startup
+	lazySync bool
+	// records at the secondary providers and their failures in a row, guarded
+	// by mu
+	secondaryRecords  map[recordKey]Record
+	secondaryFailures map[recordKey]int
+	// revert the written records of a domain when another type failed
+	rollbackOnPartial bool
+	// records written in this cycle as they were before, and the keys that
+	// failed, guarded by mu
+	written map[recordKey][]Record
+	failed  map[recordKey]bool
+	// re-fetch every updated record to confirm the write stuck
+	verifyUpdates bool
+	// writes waiting to be verified once every record was written, guarded by mu
+	unverified []verification
+	// look up the live record before writing, skipping writes it doesn't need
+	readBeforeUpdate bool
+	// look up the live record even when the cached one holds the data
+	alwaysFetch bool
+	// default ttl in seconds, 0 keeps the record's ttl
+	ttl int
+	// ttls below are raised to it on update, 0 disables the floor
+	minTTL int
+	// schedule from the end of a cycle that overran the interval
+	skipOverdue bool
+	// set while runCycleWithRetries runs, read by Shutdown
+	cycleRunning atomic.Bool
+	// set once the first successful ip check has been compared to DNS
+	firstCheckDone bool
+	// with logOnChangeOnly, quiet cycles are summed up in a heartbeat every
+	// heartbeatInterval
+	logOnChangeOnly   bool
+	heartbeatInterval time.Duration
+	lastHeartbeat     time.Time
+	quietChecks       int
+	// how long the last check took, and how long one may take before a
+	// warning, 0 never warns
+	lastCheckDuration time.Duration
+	slowCycleWarn     time.Duration
+	// outcome and unix nano time of the last ip check, read by the health server
+	lastCheckOK   atomic.Bool
+	lastCheckTime atomic.Int64
+	// consecutive failed ip checks, read by the health server
+	checkFailures atomic.Int64
+	// set once the initial sync completed, read by the health server
+	synced atomic.Bool
+	statsd *statsdClient
+	// nil unless the metrics server is enabled
+	metrics *metrics
+	// nil unless a webhook is configured
+	webhook *webhookNotifier
+	// nil unless DDNS_ON_CHANGE_CMD is set
+	onChange *changeHook
+	// consecutive failures of a record that raise an alert, 0 disables alerts
+	failureThreshold int
+	// cycles in a row that panicked, exiting at panicThreshold unless it is 0
+	panics         int
+	panicThreshold int
+	// cycles in a row that failed, opening the breaker at breakerThreshold
+	// unless it is 0; when open, checks pause until breakerUntil
+	breakerFailures  int
+	breakerThreshold int
+	breakerInterval  time.Duration
+	breakerState     string
+	breakerUntil     time.Time
+	// domain and type: consecutive failed writes, guarded by mu
+	failures map[recordKey]int
+	// domain and type: error of the last failed write until it succeeds again,
+	// guarded by mu
+	lastErrors map[recordKey]string
+	// domain and type: not looked up yet with lazy sync, guarded by mu
+	unsynced map[recordKey]bool
+
+	// zone: time until which updates are paused
+	zoneCooldown     map[string]time.Time
+	zoneLockCooldown time.Duration
+	// records whose last update didn't stick
+	recheck map[recordKey]bool
+
+	reconcileInterval time.Duration
+	// written under mu, as publishStatus reads it with the records
+	lastReconcile time.Time
+	nextReconcile time.Time
+
+	// tick is the longest the run loop sleeps between looking for due work
+	tick     time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+	// configs reloaded on SIGHUP, applied by Run between cycles
+	reload chan *Config
+	// requests from POST /check for an immediate check of every domain
+	force chan struct{}
+	// ips pushed with POST /set-ip, guarded by apiToken
+	overrides chan ipOverride
+	apiToken  string
+	// published by the run loop after every cycle, read by Snapshot
+	status atomic.Pointer[Status]
+	// closed by Run when it returns
+	done chan struct{}
+	// parent of every request Run makes, canceled by Shutdown once the cycle
+	// in progress finished or its deadline passed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Shutdown signals the Run method to shut down. A cycle in progress gets
+// until ctx is done to finish its writes, e.g. right after an IP change; then
+// its remaining requests are canceled.
+func (d *DDNSUpdater) Shutdown(ctx context.Context) error {
+	d.stopOnce.Do(func() { close(d.stop) })
+	defer d.cancel()
+
+	flushing := d.cycleRunning.Load()
+	if flushing {
+		slog.Info("waiting for the cycle in progress to finish its writes")
+	}
+
+	// wait for the run loop to exit
+	select {
+	case <-d.done:
+		if flushing {
+			slog.Info("cycle in progress finished before exiting")
+		}
+
+		return nil
+	case <-ctx.Done():
+		slog.Warn("shutdown deadline reached, canceling in-flight requests")
+
+		return fmt.Errorf("shutdown timeout reached: %w", ctx.Err())
+	}
+}
+
+// stopping reports whether Shutdown was called.
+func (d *DDNSUpdater) stopping() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitDomain derives the zone of spec, its relative record name
+// (empty for the apex) and the fully qualified name records are looked up by.
+// The zone is the name one label below its public suffix, so multi-label
+// suffixes like co.uk are handled; a leading * label is kept as a wildcard.
+func splitDomain(spec DomainSpec) (zone, subdomain, dnsName string, err error) {
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(spec.Name), "."))
+
+	host, wildcard := strings.CutPrefix(name, "*.")
+	if strings.Contains(host, "*") {
+		return "", "", "", fmt.Errorf("unable to parse domain (%s): a wildcard must be the leftmost label", spec.Name)
+	}
+
+	// an explicit apex skips the public suffix list, which doesn't know
+	// private TLDs
+	if spec.Apex != "" {
+		zone = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(spec.Apex), "."))
+		if host != zone && !strings.HasSuffix(host, "."+zone) {
+			return "", "", "", fmt.Errorf("unable to parse domain (%s): not within apex %s", spec.Name, spec.Apex)
+		}
+	} else {
+		zone, err = publicsuffix.EffectiveTLDPlusOne(host)
+		if err != nil {
+			return "", "", "", fmt.Errorf("unable to parse domain (%s): %s", spec.Name, err)
+		}
+	}
+
+	subdomain = strings.TrimSuffix(strings.TrimSuffix(host, zone), ".")
+
+	if wildcard {
+		subdomain = strings.TrimSuffix("*."+subdomain, ".")
+	}
+
+	// an explicit record name bypasses the derived subdomain entirely
+	if spec.RecordName != "" {
+		subdomain = spec.RecordName
+	}
+
+	if subdomain == "" || subdomain == "@" {
+		// root domains (@) are looked up by the zone itself
+		return zone, subdomain, zone, nil
+	}
+
+	return zone, subdomain, subdomain + "." + zone, nil
+}
+
+// domainRecords returns the empty records managed for the domains of cfg, the
+// domain specs by name and the record types in use. When several domains
+// resolve to the same record only the first one configured manages it.
+func domainRecords(cfg *Config) (map[recordKey]Record, map[string]DomainSpec, []string) {
+	domainTable := make(map[recordKey]Record, len(cfg.Domains)*len(cfg.RecordTypes))
+	specs := make(map[string]DomainSpec, len(cfg.Domains))
+	inUse := map[string]bool{}
+	// record identity: domain managing it
+	owners := map[string]string{}
+
+	for _, domain := range cfg.Domains {
+		types := domain.Types
+		if types == nil {
+			types = cfg.RecordTypes
+		}
+
+		// these records get filled during synchronization
+		for _, recType := range types {
+			identity := recordIdentity(domain, cfg.Provider, recType)
+			if owner, ok := owners[identity]; ok && owner != domain.Name {
+				slog.Warn("domains resolve to the same record, only the first is managed", "domain", domain.Name, "duplicate_of", owner, "type", recType)
+
+				continue
+			}
+
+			owners[identity] = domain.Name
+
+			domainTable[recordKey{Name: domain.Name, Type: recType}] = Record{}
+			inUse[recType] = true
+
+			// values of TXT and CNAME records are rendered from these ips
+			if !isIPType(recType) {
+				for _, ipType := range cfg.RecordTypes {
+					inUse[ipType] = true
+				}
+			}
+		}
+
+		specs[domain.Name] = domain
+	}
+
+	// the ip is only detected for record types some domain manages
+	recordTypes := []string{}
+	for _, recType := range []string{"A", "AAAA"} {
+		if inUse[recType] {
+			recordTypes = append(recordTypes, recType)
+		}
+	}
+
+	return domainTable, specs, recordTypes
+}
+
+// recordIdentity identifies the record of recType spec resolves to, so
+// spellings of the same name such as example.com and @.example.com match.
+func recordIdentity(spec DomainSpec, defaultProvider, recType string) string {
+	provider := spec.Provider
+	if provider == "" {
+		provider = defaultProvider
+	}
+
+	_, _, dnsName, err := splitDomain(spec)
+	if err != nil {
+		// reported by the sync, only the name itself is known to be unique
+		return spec.Name
+	}
+
+	return provider + " " + recType + " " + dnsName
+}
+
+// logDomainTable logs how each configured domain maps onto a zone and record
+// name before any API call, so derivation mistakes are easy to spot.
+func (d *DDNSUpdater) logDomainTable() {
+	names := make([]string, 0, len(d.specs))
+	for name := range d.specs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		zone, subdomain, dnsName, err := splitDomain(d.specs[name])
+		if err != nil {
+			d.logger.Error("invalid domain", "domain", name, "error", err)
+
+			continue
+		}
+
+		if subdomain == "" {
+			subdomain = "@"
+		}
+
+		d.logger.Info("managing domain", "domain", name, "zone", zone, "record", subdomain, "lookup", dnsName)
+	}
+}
+
+// errNothingSynced is returned by syncRecords when the lookup of every record
+// failed.
+var errNothingSynced = errors.New("no record could be synced")
+
+// syncRecords performs an initial synchronization of the provider's DNS records to the local cache.
+// Every record is synced even when some fail, the failures are returned together,
+// wrapped in errNothingSynced when no lookup succeeded. A record that doesn't
+// exist counts as synced. Several records of one zone are synced from a single
+// listing of the zone when its provider supports that.
+func (d *DDNSUpdater) syncRecords(ctx context.Context) error {
+	d.logger.Info("syncing records", "count", len(d.recordMap), "concurrency", d.concurrency)
+
+	type zoneKey struct {
+		provider Provider
+		zone     string
+	}
+
+	zones := map[zoneKey][]recordKey{}
+	keys := []recordKey{}
+
+	for key := range d.recordMap {
+		provider := d.providerFor(key.Name)
+
+		zone, _, _, err := splitDomain(d.specs[key.Name])
+		if _, ok := provider.(recordLister); ok && err == nil {
+			zones[zoneKey{provider, zone}] = append(zones[zoneKey{provider, zone}], key)
+
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	// each zone is listed by the worker of its first record
+	listed := map[recordKey][]recordKey{}
+
+	for zone, zoneKeys := range zones {
+		if len(zoneKeys) == 1 {
+			keys = append(keys, zoneKeys[0])
+
+			continue
+		}
+
+		keys = append(keys, zoneKeys[0])
+		listed[zoneKeys[0]] = zoneKeys
+
+		d.logger.Debug("listing zone", "zone", zone.zone, "records", len(zoneKeys))
+	}
+
+	// a zone listed at all syncs every one of its records
+	var synced atomic.Int64
+
+	err := d.forEachRecord(keys, func(key recordKey) error {
+		if zoneKeys, ok := listed[key]; ok {
+			err := d.syncZone(ctx, zoneKeys)
+			if err == nil {
+				synced.Add(int64(len(zoneKeys)))
+			}
+
+			return err
+		}
+
+		err := d.syncRecord(ctx, key)
+		if err == nil {
+			synced.Add(1)
+		}
+
+		return err
+	})
+
+	if err != nil && synced.Load() == 0 {
+		return fmt.Errorf("%w: %w", errNothingSynced, err)
+	}
+
+	return err
+}
+
+// syncZone syncs keys, records of the same zone, from a single listing of the
+// zone.
+func (d *DDNSUpdater) syncZone(ctx context.Context, keys []recordKey) error {
+	zone, _, _, err := splitDomain(d.specs[keys[0].Name])
+	if err != nil {
+		return err
+	}
+
+	all, err := d.providerFor(keys[0].Name).(recordLister).ListRecords(ctx, zone)
+	if errors.Is(err, ErrZoneNotFound) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to list records of zone %s: %w", zone, err)
+	}
+
+	errs := []error{}
+
+	for _, key := range keys {
+		_, subdomain, dnsName, _ := splitDomain(d.specs[key.Name])
+		if subdomain == "" {
+			subdomain = "@"
+		}
+
+		records := []Record{}
+		for _, r := range all {
+			if r.Type == key.Type && r.Name == subdomain {
+				records = append(records, r)
+			}
+		}
+
+		var findErr error
+		if len(records) == 0 {
+			findErr = fmt.Errorf("%w: no matching %s record for domain=%s name=%s", ErrRecordNotFound, key.Type, zone, dnsName)
+		}
+
+		errs = append(errs, d.cacheSynced(key, records, findErr))
+	}
+
+	return errors.Join(errs...)
+}
+
+// logSyncSummary logs every record found by the sync on a single line, and
+// warns about the ones that weren't found. It returns the latter, sorted.
+func (d *DDNSUpdater) logSyncSummary() []string {
+	found := []string{}
+	missing := []string{}
+
+	for key, record := range d.recordMap {
+		if record.ID == "" {
+			missing = append(missing, key.String())
+
+			continue
+		}
+
+		for _, r := range append([]Record{record}, d.siblings[key]...) {
+			found = append(found, fmt.Sprintf("%s id=%s data=%s ttl=%d", key.String(), r.ID, r.Data, r.TTL))
+		}
+	}
+
+	sort.Strings(found)
+	sort.Strings(missing)
+
+	d.logger.Info("records synced", "count", len(found), "records", found)
+
+	if len(missing) > 0 {
+		d.logger.Warn("records not found", "count", len(missing), "records", missing)
+	}
+
+	return missing
+}
+
+// forEachRecord calls fn for every key, running up to d.concurrency calls at
+// once, and returns the errors of all failed calls.
+func (d *DDNSUpdater) forEachRecord(keys []recordKey, fn func(key recordKey) error) error {
+	sem := make(chan struct{}, max(d.concurrency, 1))
+	errs := make([]error, len(keys))
+
+	var wg sync.WaitGroup
+
+	for i, key := range keys {
+		wg.Add(1)
+
+		sem <- struct{}{}
+
+		go func(i int, key recordKey) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer d.recoverPanic(&errs[i])
+
+			errs[i] = fn(key)
+		}(i, key)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncRecord looks up the record for key and caches it.
+func (d *DDNSUpdater) syncRecord(ctx context.Context, key recordKey) error {
+	name := key.Name
+
+	domain, subdomain, dnsName, err := splitDomain(d.specs[name])
+	if err != nil {
+		return fmt.Errorf("invalid domain %s: %w", name, err)
+	}
+
+	d.logger.Debug("searching record", "domain", domain, "name", dnsName, "type", key.Type, "original", name)
+
+	records, err := d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+
+	return d.cacheSynced(key, records, err)
+}
+
+// cacheSynced caches records, the result of looking up key, unless the lookup
+// failed with err, and clears the lazy sync mark of key once it was found or
+// is known to be missing. A failure leaves the cached record as is.
+func (d *DDNSUpdater) cacheSynced(key recordKey, records []Record, err error) error {
+	domain, subdomain, dnsName, _ := splitDomain(d.specs[key.Name])
+
+	// an empty answer is a missing record too, whatever the provider returns
+	if err == nil && len(records) == 0 {
+		err = ErrRecordNotFound
+	}
+
+	if errors.Is(err, ErrRecordNotFound) {
+		d.logger.Warn("no records found", "type", key.Type, "domain", domain, "subdomain", subdomain, "name", dnsName)
+
+		if d.createMissing {
+			d.logger.Info("record will be created on the first update", "record", key.String())
+		}
+
+		d.mu.Lock()
+		delete(d.unsynced, key)
+		d.mu.Unlock()
+
+		return nil
+	}
+
+	// the message already names the domain and what to check
+	if errors.Is(err, ErrZoneNotFound) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to fetch records. domain=%s subdomain=%s name=%s: %w", domain, subdomain, dnsName, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.unsynced, key)
+	d.recordMap[key] = records[0]
+	delete(d.siblings, key)
+
+	if len(records) == 1 {
+		return nil
+	}
+
+	if d.updateAll {
+		d.logger.Info("managing every record", "record", key.String(), "count", len(records))
+
+		d.siblings[key] = records[1:]
+
+		return nil
+	}
+
+	d.logger.Warn("multiple records exist, only the first is updated; set DDNS_UPDATE_ALL_RECORDS=true to update all of them", "record", key.String(), "count", len(records), "record_id", records[0].ID)
+
+	return nil
+}
+
+// validateProviders confirms every provider accepts its credentials before any
+// record is touched, so a bad token fails fast with a clear cause.
+func (d *DDNSUpdater) validateProviders(ctx context.Context) error {
+	for name, provider := range d.providers {
+		err := provider.Validate(ctx)
+
+		switch {
+		case err == nil:
+			continue
+		case errors.Is(err, ErrInvalidToken):
+			return fmt.Errorf("the %s api token was rejected, check it is set and valid: %w", name, err)
+		case errors.Is(err, ErrUnreachable):
+			return fmt.Errorf("unable to reach the %s api, check network connectivity: %w", name, err)
+		default:
+			return fmt.Errorf("unable to validate the %s api token: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// start validates the providers and syncs the records, the startup shared by
+// Run and RunOnce. With lazy sync the records are only marked to be looked up
+// on their first update.
+func (d *DDNSUpdater) start(ctx context.Context) error {
+	d.logDomainTable()
+
+	err := d.validateProviders(ctx)
+	if err != nil {
+		return err
+	}
+
+	if d.lazySync {
+		for key := range d.recordMap {
+			d.unsynced[key] = true
+		}
+
+		d.logger.Info("lazy sync enabled, records are looked up on their first update", "count", len(d.recordMap))
+
+		return nil
+	}
+
+	// records that failed to sync are skipped until a later sync finds them,
+	// unless none could be synced and checking would only spin
+	err = d.syncRecords(ctx)
+	if errors.Is(err, errNothingSynced) {
+		return fmt.Errorf("unable to sync records, check the domains and the provider: %w", err)
+	}
+
+	if err != nil && d.requireAll {
+		return fmt.Errorf("unable to sync records: %w", err)
+	}
+
+	if err != nil {
+		d.logger.Error("unable to sync records", "error", err)
+	}
+
+	missing := d.logSyncSummary()
+	if len(missing) > 0 && d.requireAll && !d.createMissing {
+		return fmt.Errorf("%w for %s, check the domain names or unset DDNS_REQUIRE_ALL_DOMAINS", ErrRecordNotFound, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// RunOnce syncs the records and runs a single check of every domain, for use
+// from cron. It returns an error wrapping ErrCheckFailed when the check
+// failed.
+func (d *DDNSUpdater) RunOnce() error {
+	defer close(d.done)
+
+	ctx := d.ctx
+
+	err := d.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.synced.Store(true)
+
+	now := time.Now()
+
+	err = d.runCycleWithRetries(ctx, now, now)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCheckFailed, err)
+	}
+
+	return nil
+}
+
+// Run should be run in a go routine. It runs in a loop.
+func (d *DDNSUpdater) Run() error {
+	defer close(d.done)
+
+	// canceled by Shutdown once the cycle in progress had its chance to finish
+	ctx := d.ctx
+
+	err := d.start(ctx)
+	if err != nil {
+		return err
+	}
+
+	d.synced.Store(true)
+	d.publishStatus()
+	notifyReady()
+
+	d.lastCycle.Store(time.Now().UnixNano())
+
+	if d.watchdog != WatchdogOff {
+		go d.runWatchdog()
+	}
+
+	if d.ipFile != "" {
+		go d.watchIPFile()
+	}
+
+	timer := time.NewTimer(d.untilDue())
+	defer timer.Stop()
+
+	for {
+		var tick time.Time
+
+		select {
+		case <-d.stop:
+			return nil
+		case cfg := <-d.reload:
+			d.applyConfig(ctx, cfg)
+			d.publishStatus()
+			resetTimer(timer, d.untilDue())
+
+			continue
+		case override := <-d.overrides:
+			err := d.overrideIP(ctx, override.ip)
+			override.result <- overrideResult{cycle: *d.cycle, err: err}
+
+			continue
+		case <-d.force:
+			d.logger.Info("check requested, checking every domain")
+
+			// every domain becomes due
+			clear(d.domainNext)
+			d.updateNextCheck()
+
+			tick = time.Now()
+		case tick = <-timer.C:
+		}
+
+		// select picks at random when the timer fired along with stop
+		if d.stopping() {
+			return nil
+		}
+
+		now := time.Now()
+
+		if d.nextCheck.Before(now) || d.nextCheck.Equal(now) {
+			d.probeBreaker(now)
+
+			err := d.runCycleWithRetries(ctx, tick, now)
+			if err != nil {
+				d.logger.Error("cycle failed", "error", err)
+				d.statsd.Incr("cycle_failures")
+				d.metrics.CycleFailed()
+			}
+
+			d.trackPanics(err)
+			d.trackBreaker(err, time.Now())
+		} else if d.reconcileDue(now) {
+			d.reconcile(ctx, tick)
+		}
+
+		resetTimer(timer, d.untilDue())
+	}
+}
+
+// reconcileDue reports whether a reconcile is due at now. Reconciles wait
+// while the breaker isn't closed.
+func (d *DDNSUpdater) reconcileDue(now time.Time) bool {
+	return d.reconcilePending() && !d.nextReconcile.After(now)
+}
+
+// reconcilePending reports whether a reconcile gets scheduled at all.
+func (d *DDNSUpdater) reconcilePending() bool {
+	return d.reconcileInterval > 0 && len(d.currentIPs) > 0 && d.breakerState == BreakerClosed
+}
+
+// untilDue returns how long the run loop may sleep: until the next check or
+// reconcile, but no longer than the tick granularity.
+func (d *DDNSUpdater) untilDue() time.Duration {
+	next := d.nextCheck
+	if d.reconcilePending() && d.nextReconcile.Before(next) {
+		next = d.nextReconcile
+	}
+
+	return max(min(time.Until(next), d.tick), 0)
+}
+
+// resetTimer makes timer fire after wait, discarding a pending expiry.
+func resetTimer(timer *time.Timer, wait time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	timer.Reset(wait)
+}
+
+// runCycleWithRetries runs a cycle and, while it fails, retries it with
+// exponential backoff up to the configured number of retries. It returns the
+// errors of the last attempt.
+func (d *DDNSUpdater) runCycleWithRetries(ctx context.Context, tick, now time.Time) error {
+	// cycles run on the run loop, one at a time, along with overrides and
+	// reloads; the flag only tells Shutdown whether writes may be in flight
+	d.cycleRunning.Store(true)
+	defer d.cycleRunning.Store(false)
+
+	// retries check the same domains
+	d.due = d.dueDomains(now)
+	defer func() { d.due = nil }()
+
+	defer d.checkOverdue(now)
+
+	backoff := DefaultCycleRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := d.runCycle(ctx, tick, now)
+		if err == nil {
+			notifyWatchdog()
+
+			return nil
+		}
+
+		// a tripped breaker probes with a single attempt
+		if attempt > d.cycleRetries || d.breakerState != BreakerClosed {
+			return err
+		}
+
+		d.logger.Warn("cycle failed, retrying", "error", err, "backoff", backoff, "attempt", attempt, "retries", d.cycleRetries)
+		d.metrics.CycleRetry()
+
+		select {
+		case <-d.stop:
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// warnDivergence logs a prominent warning for every record of recType whose
+// data differs from the detected ip, so operators get a heads-up before the
+// first edit.
+func (d *DDNSUpdater) warnDivergence(recType string, ip net.IP) {
+	for key, record := range d.recordMap {
+		target, err := d.targetIP(key.Name, recType, ip)
+		if key.Type != recType || record.ID == "" || err != nil || record.Data == target.String() {
+			continue
+		}
+
+		d.logger.Warn("record differs from the detected ip, an update is about to occur", "record", key.String(), "record_id", record.ID, "old_ip", record.Data, "new_ip", target.String())
+	}
+}
+
+// checkOverdue warns when the cycle started at start ran longer than the
+// interval and, when configured, schedules the next check from the end of the
+// cycle so the overdue check isn't run back to back.
+func (d *DDNSUpdater) checkOverdue(start time.Time) {
+	elapsed := time.Since(start)
+	if elapsed < d.interval {
+		return
+	}
+
+	d.logger.Warn("cycle took longer than the interval, the interval is too short for this workload", "elapsed", elapsed.Round(time.Millisecond), "interval", d.interval)
+
+	if d.skipOverdue {
+		d.scheduleDue(time.Now())
+
+		d.logger.Info("skipping overdue check", "next_check", d.nextCheck)
+	}
+}
+
+// scheduleAfter returns when the check following t is due: interval later plus
+// a random delay below the configured jitter.
+func (d *DDNSUpdater) scheduleAfter(t time.Time, interval time.Duration) time.Time {
+	next := t.Add(interval)
+	if d.jitter > 0 {
+		next = next.Add(time.Duration(mrand.Int63n(int64(d.jitter))))
+	}
+
+	return next
+}
+
+// intervalFor returns the check interval of the domain name.
+func (d *DDNSUpdater) intervalFor(name string) time.Duration {
+	if interval := d.specs[name].Interval; interval > 0 {
+		return interval
+	}
+
+	return d.interval
+}
+
+// dueDomains returns the domains whose next check is due at now.
+func (d *DDNSUpdater) dueDomains(now time.Time) map[string]bool {
+	due := map[string]bool{}
+
+	for name := range d.specs {
+		if !d.domainNext[name].After(now) {
+			due[name] = true
+		}
+	}
+
+	return due
+}
+
+// isDue reports whether the records of the domain name are handled by the
+// check in progress. Outside of a check, e.g. while reconciling, all are.
+func (d *DDNSUpdater) isDue(name string) bool {
+	return d.due == nil || d.due[name]
+}
+
+// typeDue reports whether any record of recType is handled by the check in
+// progress.
+func (d *DDNSUpdater) typeDue(recType string) bool {
+	for key := range d.recordMap {
+		if key.Type == recType && d.isDue(key.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scheduleDue schedules the next check of every due domain one of its
+// intervals after t.
+func (d *DDNSUpdater) scheduleDue(t time.Time) {
+	for name := range d.due {
+		d.domainNext[name] = d.scheduleAfter(t, d.intervalFor(name))
+	}
+
+	d.updateNextCheck()
+}
+
+// updateNextCheck moves nextCheck to the earliest next check of any domain.
+func (d *DDNSUpdater) updateNextCheck() {
+	first := true
+
+	for name := range d.specs {
+		if next := d.domainNext[name]; first || next.Before(d.nextCheck) {
+			d.nextCheck = next
+			first = false
+		}
+	}
+}
+
+// setCheckWindow stores the longest interval of any domain, the most time that
+// may pass between checks.
+func (d *DDNSUpdater) setCheckWindow() {
+	window := d.interval
+
+	for name := range d.specs {
+		window = max(window, d.intervalFor(name))
+	}
+
+	d.checkWindow.Store(int64(window))
+}
+
+// runCycle performs a single check: detect the IP for every managed record
+// type and update records if it changed. It returns the errors of every
+// failed IP check and record write.
+func (d *DDNSUpdater) runCycle(ctx context.Context, tick, now time.Time) (err error) {
+	defer d.recoverPanic(&err)
+
+	d.startCycle()
+	defer d.endCycle()
+
+	if d.familyClients != nil {
+		d.checkReachability(ctx)
+	}
+
+	errs := []error{}
+
+	for _, recType := range d.recordTypes {
+		if !d.typeDue(recType) {
+			continue
+		}
+
+		if d.ipSource == IPSourceExternal {
+			errs = append(errs, d.externalIP(ctx, recType, tick))
+
+			continue
+		}
+
+		ip, err := d.detectIP(ctx, recType, tick)
+		if errors.Is(err, errIPv6Unavailable) {
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		errs = append(errs, d.handleIP(ctx, recType, ip, tick))
+	}
+
+	errs = append(errs, d.rollbackPartial(ctx))
+
+	// derived records are rendered once after startup, and then on changes
+	errs = append(errs, d.applyDerived(ctx, d.cycle.IPChanged || !d.firstCheckDone))
+
+	err = errors.Join(errs...)
+
+	// a cycle is only healthy when every record could be written as well
+	d.lastCheckOK.Store(err == nil)
+	d.lastCheckTime.Store(time.Now().UnixNano())
+
+	d.trackCycleDuration(time.Since(d.cycle.Started))
+
+	// records still flagged for a re-check, e.g. of domains that weren't
+	// due, don't hold the current ip yet
+	if err == nil && len(d.recheck) == 0 {
+		d.lastSuccess = time.Now()
+		d.metrics.UpdateSucceeded(d.lastSuccess)
+	}
+
+	d.firstCheckDone = true
+
+	d.scheduleDue(now)
+	d.logNextCheck(now)
+
+	return err
+}
+
+// trackCycleDuration records elapsed, how long a check took from detecting the
+// ip to its last record write, and warns when it took longer than
+// slowCycleWarn.
+func (d *DDNSUpdater) trackCycleDuration(elapsed time.Duration) {
+	d.lastCheckDuration = elapsed
+	d.metrics.CycleDuration(elapsed)
+
+	if d.slowCycleWarn > 0 && elapsed > d.slowCycleWarn {
+		d.logger.Warn("slow check, the ip providers or the DNS provider api may be degrading", "duration", elapsed.Round(time.Millisecond), "threshold", d.slowCycleWarn, "updated_records", len(d.cycle.UpdatedRecords))
+	}
+}
+
+// logNextCheck logs when the next check is due. With logOnChangeOnly a cycle
+// that changed nothing and didn't fail only logs it at debug level, and a
+// heartbeat counting those cycles is logged every heartbeatInterval instead.
+func (d *DDNSUpdater) logNextCheck(now time.Time) {
+	next := d.nextCheck
+
+	if !d.logOnChangeOnly || d.cycle.IPChanged || len(d.cycle.UpdatedRecords) > 0 || len(d.cycle.Errors) > 0 {
+		d.logger.Info("next check", "next_check", next)
+
+		d.lastHeartbeat = now
+		d.quietChecks = 0
+
+		return
+	}
+
+	d.logger.Debug("next check", "next_check", next)
+
+	d.quietChecks++
+
+	if d.lastHeartbeat.IsZero() {
+		d.lastHeartbeat = now
+	}
+
+	if now.Sub(d.lastHeartbeat) < d.heartbeatInterval {
+		return
+	}
+
+	d.logger.Info("still checking, nothing changed", "checks", d.quietChecks, "since", d.lastHeartbeat, "ips", d.cycle.IPs, "next_check", next)
+
+	d.lastHeartbeat = now
+	d.quietChecks = 0
+}
+
+// errIPv6Unavailable is returned by detectIP when no IPv6 address was
+// detected with ipv6Optional. The AAAA records are left as they are and the
+// check doesn't fail.
+var errIPv6Unavailable = errors.New("IPv6 unavailable")
+
+// detectIP detects the IP for recType and validates it can be written to its
+// records.
+func (d *DDNSUpdater) detectIP(ctx context.Context, recType string, tick time.Time) (net.IP, error) {
+	d.statsd.Incr("checks")
+
+	address, err := d.CheckIP(ctx, recType)
+
+	// e.g. an interface without a global IPv6 address answers with an IPv4 one
+	if err == nil && recType == "AAAA" && d.ipv6Optional {
+		err = validateFamily(recType, net.ParseIP(strings.TrimSpace(address)))
+	}
+
+	if err != nil && recType == "AAAA" && d.ipv6Optional {
+		d.logger.Warn("IPv6 unavailable this cycle", "error", err)
+
+		return nil, errIPv6Unavailable
+	}
+
+	if err != nil {
+		// the current ip is kept, a failed check never counts as a change
+		d.logger.Error("unable to check ip", "type", recType, "error", err)
+		d.cycle.addError(err)
+		d.checkFailures.Add(1)
+		d.statsd.Incr("check_failures")
+		d.metrics.CheckIPError()
+
+		return nil, err
+	}
+
+	d.checkFailures.Store(0)
+
+	ip := net.ParseIP(strings.TrimSpace(address))
+	d.cycle.IPs[recType] = ip.String()
+
+	d.logger.Debug("ip checked", "type", recType, "ip", ip.String(), "ts", tick)
+
+	err = validateFamily(recType, ip)
+	if err == nil && !d.allowPrivate {
+		err = validatePublic(ip, d.allowReserved)
+	}
+
+	if err != nil {
+		d.logger.Error("invalid ip, skipping update", "type", recType, "error", err)
+		d.cycle.addError(err)
+
+		return nil, err
+	}
+
+	return ip, nil
+}
+
+// handleIP updates the records of recType when ip, the detected IP, changed
+// or they are flagged for a re-check. It returns the failed updates.
+func (d *DDNSUpdater) handleIP(ctx context.Context, recType string, ip net.IP, tick time.Time) error {
+	// adopt mode never edits on the first check, so there is nothing to warn about
+	if !d.firstCheckDone && !d.adopt {
+		d.warnDivergence(recType, ip)
+	}
+
+	current := d.currentIPs[recType]
+	if current.Equal(ip) {
+		// a flap back to the current ip ends the pending change
+		delete(d.candidates, recType)
+	}
+
+	switch {
+	case d.isBlocklisted(ip):
+		d.logger.Error("detected ip is blocklisted, skipping update", "type", recType, "ip", ip.String())
+
+		d.notifyBlocklist(blocklistEvent{Event: BlocklistEventDetected, RecordType: recType, IP: ip.String(), Timestamp: time.Now()})
+
+		err := fmt.Errorf("detected %s address %s is blocklisted", recType, ip)
+		d.cycle.addError(err)
+
+		return err
+	case d.adopt && current == nil:
+		d.logger.Info("adopting existing records, first update deferred until the ip changes", "type", recType, "ip", ip.String())
+
+		d.currentIPs[recType] = ip
+	case current == nil:
+		return d.seedIP(ctx, recType, ip, tick)
+	case !current.Equal(ip) && !d.stable(recType, ip, time.Now()):
+		d.logger.Info("ip changed, waiting for it to be stable before updating", "type", recType, "old_ip", current.String(), "new_ip", ip.String(), "stable_for", d.stableFor, "since", d.candidates[recType].since)
+	case !current.Equal(ip):
+		return d.updateRecords(ctx, recType, ip, tick)
+	case d.needsRecheck(recType):
+		d.logger.Info("ip is unchanged, re-checking records", "type", recType)
+
+		return d.applyRecords(ctx, recType)
+	default:
+		d.logger.Debug("ip is unchanged", "type", recType)
+	}
+
+	return nil
+}
+
+// candidateIP is a changed IP waiting to be stable for DDNS_IP_STABLE_FOR.
+type candidateIP struct {
+	ip    net.IP
+	since time.Time
+}
+
+// stable reports whether ip, a change of the current IP of recType, has been
+// detected at every check for at least the stable-for window at now.
+func (d *DDNSUpdater) stable(recType string, ip net.IP, now time.Time) bool {
+	if d.stableFor <= 0 {
+		return true
+	}
+
+	candidate, ok := d.candidates[recType]
+	if !ok || !candidate.ip.Equal(ip) {
+		d.candidates[recType] = candidateIP{ip: ip, since: now}
+
+		return false
+	}
+
+	if now.Sub(candidate.since) < d.stableFor {
+		return false
+	}
+
+	delete(d.candidates, recType)
+
+	return true
+}
+
+// validateFamily checks that ip can be written to a record of recType: an
+// IPv4 address for A records and an IPv6 address for AAAA records.
+func validateFamily(recType string, ip net.IP) error {
+	if ip == nil {
+		return fmt.Errorf("no valid %s address detected", recType)
+	}
+
+	isV4 := ip.To4() != nil
+
+	if recType == "A" && !isV4 {
+		return fmt.Errorf("detected address %s is not IPv4 but an A record is managed", ip.String())
+	}
+
+	if recType == "AAAA" && isV4 {
+		return fmt.Errorf("detected address %s is not IPv6 but an AAAA record is managed", ip.String())
+	}
+
+	return nil
+}
+
+// validatePublic rejects addresses that can't be the public address of this
+// host, e.g. a private address returned by a misconfigured proxy. With
+// allowReserved only private, loopback, link-local and unspecified addresses
+// are rejected, not the other bogon ranges.
+func validatePublic(ip net.IP, allowReserved bool) error {
+	if isPubliclyRoutable(ip) {
+		return nil
+	}
+
+	network := bogonNet(ip)
+	if network == nil {
+		return fmt.Errorf("detected address %s is not public, set DDNS_ALLOW_PRIVATE_IPS=true to publish it anyway", ip.String())
+	}
+
+	if allowReserved {
+		return nil
+	}
+
+	return fmt.Errorf("detected address %s is in the reserved range %s, set DDNS_ALLOW_RESERVED_IPS=true to publish it anyway", ip.String(), network.String())
+}
+
+// needsRecheck reports whether any record of recType is flagged for a re-check.
+func (d *DDNSUpdater) needsRecheck(recType string) bool {
+	for key := range d.recheck {
+		if key.Type == recType && d.isDue(key.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CycleResult summarizes a single cycle. With DDNS_OUTPUT=json one is written
+// to stdout per cycle.
+type CycleResult struct {
+	CycleID        string            `json:"cycle_id"`
+	Started        time.Time         `json:"started"`
+	DurationMillis int64             `json:"duration_ms"`
+	IPs            map[string]string `json:"ips"`
+	IPChanged      bool              `json:"ip_changed"`
+	UpdatedRecords []string          `json:"updated_records"`
+	Errors         []string          `json:"errors"`
+}
+
+func (c *CycleResult) addError(err error) {
+	c.Errors = append(c.Errors, err.Error())
+}
+
+// startCycle assigns a new correlation ID that prefixes every log line until endCycle.
+func (d *DDNSUpdater) startCycle() {
+	id := make([]byte, 4)
+	_, _ = rand.Read(id)
+
+	d.cycle = &CycleResult{
+		CycleID:        hex.EncodeToString(id),
+		Started:        time.Now(),
+		IPs:            map[string]string{},
+		UpdatedRecords: []string{},
+		Errors:         []string{},
+	}
+
+	d.written = map[recordKey][]Record{}
+	d.failed = map[recordKey]bool{}
+
+	d.logger = slog.Default().With("cycle_id", d.cycle.CycleID)
+}
+
+// endCycle clears the correlation ID and emits the cycle result.
+func (d *DDNSUpdater) endCycle() {
+	d.logger = slog.Default()
+
+	d.cycle.DurationMillis = time.Since(d.cycle.Started).Milliseconds()
+	d.lastCycle.Store(time.Now().UnixNano())
+
+	if d.output == OutputJSON {
+		err := json.NewEncoder(os.Stdout).Encode(d.cycle)
+		if err != nil {
+			d.logger.Error("unable to write cycle result", "error", err)
+		}
+	}
+
+	d.publishStatus()
+
+	d.flushAlerts(time.Now())
+}
+
+// isBlocklisted reports whether ip is one of the configured blocklisted IPs.
+func (d *DDNSUpdater) isBlocklisted(ip net.IP) bool {
+	for _, blocked := range d.blocklist {
+		if blocked.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckIP returns the public address used for records of recType, trying
+// each ip provider in order until one answers. With consensus enabled, an
+// address that differs from the current one is only accepted once a second
+// provider agrees. AAAA addresses are requested over IPv6 so the provider sees
+// the IPv6 address. With a dns, stun or interface ip source the address is
+// looked up at OpenDNS, asked from the STUN server or read from the interface
+// instead.
+func (d *DDNSUpdater) CheckIP(ctx context.Context, recType string) (string, error) {
+	if d.ipSource == IPSourceDNS {
+		return dnsIP(ctx, recType, d.checkIPTimeout)
+	}
+
+	if d.ipSource == IPSourceSTUN {
+		return stunIP(ctx, d.stunServer, recType, d.checkIPTimeout)
+	}
+
+	if d.ipSource == IPSourceFile {
+		return fileIP(d.ipFile, recType)
+	}
+
+	if d.ipSource != IPSourceHTTP {
+		address, err := interfaceIP(d.iface, recType, d.ipv6Address)
+		if err == nil || d.ipSource == IPSourceInterface {
+			return address, err
+		}
+
+		d.logger.Warn("unable to read the ip from the interface, falling back to the ip providers", "interface", d.iface, "error", err)
+	}
+
+	client := &d.httpClient
+	if recType == "AAAA" {
+		client = d.ipv6Client
+	}
+
+	current := d.currentIPs[recType]
+	failures := []string{}
+
+	// providers that failed recently are tried last
+	order := d.sources.Order(recType, d.checkIPURLs)
+	for i, u := range order {
+		ip, err := d.lookupIP(ctx, recType, u, func() (string, error) { return d.fetchIPWithRetries(ctx, client, recType, u) })
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", u, err))
+
+			continue
+		}
+
+		// an unchanged address needs no second opinion
+		if !d.ipConsensus || ip.Equal(current) {
+			return ip.String(), nil
+		}
+
+		return d.confirmIP(ctx, client, recType, u, ip, order[i+1:], failures)
+	}
+
+	return "", fmt.Errorf("all ip providers failed: %s", strings.Join(failures, "; "))
+}
+
+// lookupIP returns the address of recType fetch got from the ip provider at u,
+// and records the outcome for its ranking and metrics unless ctx was cancelled
+// meanwhile.
+func (d *DDNSUpdater) lookupIP(ctx context.Context, recType, u string, fetch func() (string, error)) (net.IP, error) {
+	start := time.Now()
+
+	address, err := fetch()
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+
+	if err != nil {
+		d.sources.Failed(recType, u)
+		d.metrics.IPCheck(u, "error", time.Since(start))
+
+		return nil, err
+	}
+
+	// a provider answering with an error page falls back like a failed request
+	ip := net.ParseIP(address)
+	if ip == nil {
+		d.sources.Failed(recType, u)
+		d.metrics.IPCheck(u, "invalid", time.Since(start))
+
+		return nil, fmt.Errorf("invalid address %q", address)
+	}
+
+	// e.g. a dual stack provider reached over IPv6 while checking an A record
+	if err := validateFamily(recType, ip); err != nil {
+		d.sources.Failed(recType, u)
+		d.metrics.IPCheck(u, "invalid", time.Since(start))
+
+		return nil, err
+	}
+
+	d.sources.Succeeded(recType, u)
+	d.metrics.IPCheck(u, "success", time.Since(start))
+
+	return ip, nil
+}
+
+// confirmIP asks the providers in others, up to consensusWorkers at once and
+// each within consensusTimeout, for the address of recType, and returns ip,
+// detected by first, once one of them agrees. Without that, an address two of
+// them agree on is returned instead. The lookups still running are cancelled
+// once ip is confirmed.
+func (d *DDNSUpdater) confirmIP(ctx context.Context, client *http.Client, recType, first string, ip net.IP, others, failures []string) (string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type answer struct {
+		ip  net.IP
+		err error
+	}
+
+	answers := make([]answer, len(others))
+	done := make(chan int, len(others))
+	sem := make(chan struct{}, max(d.consensusWorkers, 1))
+
+	var wg sync.WaitGroup
+
+	// started in order, so the best ranked providers are asked first
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i, u := range others {
+			sem <- struct{}{}
+
+			wg.Add(1)
+
+			go func(i int, u string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				defer func() { done <- i }()
+
+				if ctx.Err() != nil {
+					answers[i].err = ctx.Err()
+
+					return
+				}
+
+				lookupCtx, cancel := context.WithTimeout(ctx, d.consensusTimeout)
+				defer cancel()
+
+				answers[i].ip, answers[i].err = d.lookupIP(ctx, recType, u, func() (string, error) { return d.fetchIP(lookupCtx, client, recType, u) })
+			}(i, u)
+		}
+	}()
+
+	for range others {
+		i := <-done
+		if answers[i].ip.Equal(ip) {
+			d.logger.Info("ip providers agree", "providers", []string{first, others[i]}, "ip", ip.String())
+
+			cancel()
+			wg.Wait()
+
+			return ip.String(), nil
+		}
+	}
+
+	wg.Wait()
+
+	// e.g. the first provider returned garbage the others don't confirm
+	seen := map[string]string{ip.String(): first}
+	unconfirmed := []string{ip.String()}
+
+	for i, u := range others {
+		if answers[i].err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", u, answers[i].err))
+
+			continue
+		}
+
+		address := answers[i].ip.String()
+		if other, ok := seen[address]; ok {
+			d.logger.Info("ip providers agree", "providers", []string{other, u}, "ip", address)
+
+			return address, nil
+		}
+
+		seen[address] = u
+		unconfirmed = append(unconfirmed, address)
+	}
+
+	for _, address := range unconfirmed {
+		failures = append(failures, fmt.Sprintf("%s: %s not confirmed by another provider", seen[address], address))
+	}
+
+	return "", fmt.Errorf("ip providers disagree: %s", strings.Join(failures, "; "))
+}
+
+// transientError marks a failed ip provider request a quick retry may fix: a
+// network error, a rate limit or a 5xx response.
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+
+func (e transientError) Unwrap() error { return e.err }
+
+// fetchIPWithRetries requests the address of recType from the ip provider at
+// u, retrying a transient failure up to checkIPRetries times with a short
+// backoff.
+func (d *DDNSUpdater) fetchIPWithRetries(ctx context.Context, client *http.Client, recType, u string) (string, error) {
+	backoff := DefaultCheckIPRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		address, err := d.fetchIP(ctx, client, recType, u)
+
+		var transient transientError
+		if err == nil || !errors.As(err, &transient) || attempt > d.checkIPRetries {
+			return address, err
+		}
+
+		d.logger.Debug("ip provider failed, retrying", "url", u, "wait", backoff, "attempt", attempt, "retries", d.checkIPRetries, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-d.stop:
+			return "", err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+// fetchIP requests the address of recType from the ip provider at u, unless
+// the earlier response of a dual provider held it.
+func (d *DDNSUpdater) fetchIP(ctx context.Context, client *http.Client, recType, u string) (string, error) {
+	// the response to the check of the other type held it already
+	if address, ok := d.dual.Take(d.cycleID(), u, recType); ok {
+		return address, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.checkIPTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("error while forming request: %v", err)
+	}
+
+	req.Header.Set("User-Agent", d.userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", transientError{fmt.Errorf("error while unpacking response: %v", err)}
+	}
+
+	defer resp.Body.Close()
+
+	// one byte past the cap tells a full body from a cut off one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxCheckIPBodySize+1))
+	if err != nil {
+		return "", transientError{fmt.Errorf("error while reading response body: \"%v\"", err)}
+	}
+
+	if len(body) > MaxCheckIPBodySize {
+		return "", fmt.Errorf("response body exceeds %d bytes", MaxCheckIPBodySize)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return "", transientError{fmt.Errorf("error from server (%d) body: \"%s\"", resp.StatusCode, body)}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("error from server (%d) body: \"%s\"", resp.StatusCode, body)
+	}
+
+	if d.checkIPFormat == CheckIPFormatJSON {
+		return jsonField(body, d.checkIPField)
+	}
+
+	if d.checkIPFormat == CheckIPFormatDual {
+		return d.dualField(body, recType, u)
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
+
+// jsonField returns the string at the dot separated path of the JSON object in
+// body, e.g. "ip" or "data.address".
+func jsonField(body []byte, path string) (string, error) {
+	var value interface{}
+
+	err := json.Unmarshal(body, &value)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse response as JSON: %v", err)
+	}
+
+	for _, field := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("field %q not found in response: %s", path, body)
+		}
+
+		value, ok = object[field]
+		if !ok {
+			return "", fmt.Errorf("field %q not found in response: %s", path, body)
+		}
+	}
+
+	address, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q of response is not a string: %s", path, body)
+	}
+
+	return strings.TrimSpace(address), nil
+}
+
+// updateRecords handles a change of the IP of recType to ip: it is counted,
+// recorded in the history and written to the records. It returns the failed
+// writes.
+func (d *DDNSUpdater) updateRecords(ctx context.Context, recType string, ip net.IP, ts time.Time) error {
+	oldIP := d.currentIPs[recType]
+	d.currentIPs[recType] = ip
+
+	d.logger.Info("ip changed", "type", recType, "old_ip", oldIP.String(), "new_ip", ip.String())
+
+	d.cycle.IPChanged = true
+	d.statsd.Incr("ip_changes")
+	d.metrics.IPChanged(recType, ip.String(), ts)
+
+	if err := d.history.Add(ts, recType, oldIP, ip); err != nil {
+		d.logger.Error("unable to persist ip history", "error", err)
+	}
+
+	return d.propagateIP(ctx, recType, oldIP, ip, ts)
+}
+
+// seedIP takes ip as the current IP of recType on the first check without a
+// known prior IP. It isn't counted as a change: records already holding it
+// are left alone, so a cold start makes no writes when nothing changed.
+func (d *DDNSUpdater) seedIP(ctx context.Context, recType string, ip net.IP, ts time.Time) error {
+	d.currentIPs[recType] = ip
+
+	d.logger.Info("ip detected, updating records that differ", "type", recType, "ip", ip.String())
+
+	d.metrics.CurrentIP(recType, ip.String())
+
+	return d.propagateIP(ctx, recType, nil, ip, ts)
+}
+
+// propagateIP writes the current IP of recType, previously oldIP, to its
+// records and confirms it once every record holds it. It returns the failed
+// writes.
+func (d *DDNSUpdater) propagateIP(ctx context.Context, recType string, oldIP, ip net.IP, ts time.Time) error {
+	d.deferUndue(recType)
+
+	updated := len(d.cycle.UpdatedRecords)
+
+	err := d.applyRecords(ctx, recType)
+
+	d.lastSet = ts
+
+	pending := false
+	for key := range d.recheck {
+		pending = pending || key.Type == recType
+	}
+
+	// the ip is only confirmed once every record holds it
+	if err == nil && !pending {
+		d.saveState(recType, ip, ts)
+	}
+
+	if len(d.cycle.UpdatedRecords) > updated {
+		d.notifyIPChange(ctx, recType, oldIP, ip, ts, d.cycle.UpdatedRecords[updated:])
+	}
+
+	return err
+}
+
+// deferUndue flags the records of recType of domains that aren't due, so they
+// get the new ip once their own check comes up.
+func (d *DDNSUpdater) deferUndue(recType string) {
+	for key := range d.recordMap {
+		if key.Type == recType && !d.isDue(key.Name) {
+			d.recheck[key] = true
+		}
+	}
+}
+
+// notifyIPChange posts a single event for an IP change to the webhook and runs
+// the on change command. A delivery or command failure is only logged.
+func (d *DDNSUpdater) notifyIPChange(ctx context.Context, recType string, oldIP, newIP net.IP, ts time.Time, updated []string) {
+	event := ipChangeEvent{
+		RecordType:     recType,
+		NewIP:          newIP.String(),
+		Timestamp:      ts,
+		DomainsUpdated: []string{},
+	}
+
+	if oldIP != nil {
+		event.OldIP = oldIP.String()
+	}
+
+	seen := map[string]bool{}
+
+	for _, record := range updated {
+		// every record of a domain with DDNS_UPDATE_ALL_RECORDS is listed once
+		if seen[record] {
+			continue
+		}
+
+		seen[record] = true
+		event.DomainsUpdated = append(event.DomainsUpdated, strings.TrimSuffix(record, "/"+recType))
+	}
+
+	if d.dryRun {
+		if d.webhook != nil {
+			d.logger.Info("dry run: would notify webhook", "type", recType, "old_ip", event.OldIP, "new_ip", event.NewIP)
+		}
+
+		if d.onChange != nil {
+			d.logger.Info("dry run: would run on change command", "type", recType, "old_ip", event.OldIP, "new_ip", event.NewIP)
+		}
+
+		return
+	}
+
+	if err := d.webhook.Notify(ctx, event); err != nil {
+		d.logger.Error("unable to notify webhook", "error", err)
+	}
+
+	d.onChange.Run(ctx, d.logger, event)
+}
+
+// saveState records ip as confirmed for recType and persists it when a state
+// store is configured.
+func (d *DDNSUpdater) saveState(recType string, ip net.IP, ts time.Time) {
+	d.confirmedIPs[recType] = ip
+
+	d.persistState(ts)
+}
+
+// persistState writes the confirmed ips to the state store, if configured.
+func (d *DDNSUpdater) persistState(ts time.Time) {
+	// nothing was written, so there is nothing to remember across restarts
+	if d.state == nil || d.dryRun {
+		return
+	}
+
+	if err := d.state.Save(d.confirmedIPs, ts); err != nil {
+		d.logger.Error("unable to persist state", "error", err)
+	}
+}
+
+// reconcile re-fetches records from the provider and re-applies the current IP
+// to any record that drifted, e.g. after an edit in the provider console.
+func (d *DDNSUpdater) reconcile(ctx context.Context, ts time.Time) {
+	d.startCycle()
+	defer d.endCycle()
+
+	d.logger.Info("reconciling records")
+
+	err := d.syncRecords(ctx)
+	if err != nil {
+		d.logger.Error("unable to sync records", "error", err)
+	}
+
+	// failures are recorded on the cycle and retried at the next reconcile
+	for recType := range d.currentIPs {
+		_ = d.applyRecords(ctx, recType)
+	}
+
+	for _, recType := range d.derivedTypes() {
+		_ = d.applyRecords(ctx, recType)
+	}
+
+	d.mu.Lock()
+	d.lastReconcile = ts
+	d.mu.Unlock()
+
+	d.nextReconcile = ts.Add(d.reconcileInterval)
+
+	d.logger.Info("next reconcile", "next_reconcile", d.nextReconcile)
+}
+
+// applyRecords writes the current value of recType, the IP or a rendered
+// template, to every record of that type that doesn't already hold it. The
+// failed writes are recorded on the cycle and returned together. Writes to be
+// verified are read back once all of them are done.
+func (d *DDNSUpdater) applyRecords(ctx context.Context, recType string) error {
+	// taken before the workers start replacing cached records
+	records := map[recordKey][]Record{}
+	keys := []recordKey{}
+
+	for key, record := range d.recordMap {
+		// records of domains that aren't due keep their recheck flag
+		if key.Type != recType || !d.isDue(key.Name) {
+			continue
+		}
+
+		delete(d.recheck, key)
+
+		records[key] = append([]Record{record}, d.siblings[key]...)
+		keys = append(keys, key)
+	}
+
+	err := d.forEachRecord(keys, func(key recordKey) error {
+		value, err := d.valueFor(key)
+		if err != nil {
+			d.recordFailed(key, "unable to determine record data, skipping update", err)
+
+			return err
+		}
+
+		// whatever happens to the primary records
+		defer d.mirrorSecondary(ctx, key, value)
+
+		current := records[key]
+
+		d.mu.Lock()
+		unsynced := d.unsynced[key]
+		d.mu.Unlock()
+
+		// with lazy sync the record is looked up right before its first update
+		if unsynced {
+			err := d.syncRecord(ctx, key)
+			if err != nil {
+				d.recordFailed(key, "unable to look up record", err)
+
+				return err
+			}
+
+			d.mu.Lock()
+			current = append([]Record{d.recordMap[key]}, d.siblings[key]...)
+			d.mu.Unlock()
+		}
+
+		if current[0].ID == "" && d.createMissing {
+			err := d.createMissingRecord(ctx, key, value)
+			if err != nil {
+				d.recordFailed(key, "unable to create record", err)
+			}
+
+			return err
+		}
+
+		if current[0].ID == "" {
+			d.logger.Warn("no record synced, skipping update", "record", key.String())
+
+			return nil
+		}
+
+		errs := []error{}
+		for _, record := range current {
+			errs = append(errs, d.applyRecord(ctx, key, record, value))
+		}
+
+		return errors.Join(errs...)
+	})
+
+	return errors.Join(err, d.verifyQueued(ctx))
+}
+
+// skipCachedRecord skips the write of record, a record of key whose cached
+// data already holds the value.
+func (d *DDNSUpdater) skipCachedRecord(key recordKey, record Record) {
+	d.logger.Debug("record consistent, skipping update", "record", key.String(), "record_id", record.ID)
+	d.statsd.Incr("update_skips", "source:cache")
+	d.metrics.UpdateSkipped(key.Name, "cache")
+
+	// e.g. fixed by hand after failing
+	d.trackRecovery(key)
+}
+
+// applyRecord writes value to a single synced record of key unless it already
+// holds it, and returns the error of a failed write.
+func (d *DDNSUpdater) applyRecord(ctx context.Context, key recordKey, record Record, value string) error {
+	name := key.Name
+
+	consistent := record.Data == value && !d.ttlDiffers(name, record)
+
+	if consistent && !d.alwaysFetch {
+		d.skipCachedRecord(key, record)
+
+		return nil
+	}
+
+	// the cache is stale after an edit outside of this tool
+	if d.readBeforeUpdate || d.alwaysFetch {
+		live, err := d.liveRecord(ctx, key, record.ID)
+		if err != nil && consistent {
+			d.logger.Warn("unable to look up record before updating, trusting the cached record", "record", key.String(), "record_id", record.ID, "error", err)
+			d.skipCachedRecord(key, record)
+
+			return nil
+		}
+
+		if err != nil {
+			d.logger.Warn("unable to look up record before updating, updating anyway", "record", key.String(), "record_id", record.ID, "error", err)
+		}
+
+		if err == nil && live.Data == value && !d.ttlDiffers(name, live) {
+			d.logger.Debug("record already holds the value, skipping update", "record", key.String(), "record_id", record.ID)
+			d.statsd.Incr("update_skips", "source:live")
+			d.metrics.UpdateSkipped(name, "live")
+
+			d.cacheRecord(key, record.ID, live)
+			d.trackRecovery(key)
+
+			return nil
+		}
+
+		if err == nil && consistent {
+			d.logger.Warn("cached record is stale, updating", "record", key.String(), "record_id", record.ID, "cached", record.Data, "live", live.Data)
+		}
+
+		// a failed write is retried from the live record too
+		if err == nil {
+			d.cacheRecord(key, record.ID, live)
+			record = live
+		}
+	}
+
+	if d.dataPattern != nil && !d.dataPattern.Match(record.Data) {
+		d.logger.Info("record data doesn't match DDNS_MANAGE_DATA_PATTERN, skipping update", "domain", name, "record_id", record.ID, "data", record.Data)
+
+		return nil
+	}
+
+	err := d.updateRecord(ctx, key, record, value)
+	if err == nil {
+		return nil
+	}
+
+	if !d.specs[name].Required || errors.Is(err, ErrZoneLocked) {
+		d.recordFailed(key, "unable to update record", err, "record_id", record.ID)
+
+		return err
+	}
+
+	// required domains get one immediate retry instead of waiting for the next cycle
+	d.logger.Warn("required domain failed to update, retrying", "domain", name, "record_id", record.ID, "error", err)
+
+	err = d.updateRecord(ctx, key, record, value)
+	if err != nil {
+		d.recordFailed(key, "required domain failed to update", err, "record_id", record.ID)
+	}
+
+	return err
+}
+
+// recordUpdated counts a successful write of a record of key.
+func (d *DDNSUpdater) recordUpdated(key recordKey) {
+	d.mu.Lock()
+	d.cycle.UpdatedRecords = append(d.cycle.UpdatedRecords, key.String())
+	d.updatedAt[key] = time.Now()
+	d.mu.Unlock()
+
+	d.statsd.Incr("record_updates", "result:success")
+	d.metrics.RecordUpdate(key.Name, "success")
+
+	d.trackRecovery(key)
+}
+
+// recordFailed counts a failed write of a record of key and logs it as msg
+// with args. An error repeating the last one of key is only logged at debug
+// level, so a broken domain doesn't flood the log every cycle.
+func (d *DDNSUpdater) recordFailed(key recordKey, msg string, err error, args ...any) {
+	d.mu.Lock()
+	d.cycle.addError(err)
+	d.failed[key] = true
+	repeated := d.lastErrors[key] == err.Error()
+	d.lastErrors[key] = err.Error()
+	d.mu.Unlock()
+
+	args = append([]any{"record", key.String(), "error", err}, args...)
+	if repeated {
+		d.logger.Debug(msg+", same error as before", args...)
+	} else {
+		d.logger.Error(msg, args...)
+	}
+
+	d.statsd.Incr("record_updates", "result:failure")
+	d.metrics.RecordUpdate(key.Name, "failure")
+
+	d.trackFailure(key, err)
+}
+
+// cacheRecord replaces the cached record of key with id, the managed one or a
+// sibling, by r.
+func (d *DDNSUpdater) cacheRecord(key recordKey, id string, r Record) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.recordMap[key].ID == id {
+		d.recordMap[key] = r
+
+		return
+	}
+
+	for i, sibling := range d.siblings[key] {
+		if sibling.ID == id {
+			d.siblings[key][i] = r
+
+			return
+		}
+	}
+}
+
+// forgetRecord drops the cached record of key with id. When the managed record
+// is dropped its first sibling takes over.
+func (d *DDNSUpdater) forgetRecord(key recordKey, id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	siblings := d.siblings[key]
+
+	if d.recordMap[key].ID == id {
+		d.recordMap[key] = Record{}
+
+		if len(siblings) > 0 {
+			d.recordMap[key] = siblings[0]
+			d.siblings[key] = siblings[1:]
+		}
+
+		return
+	}
+
+	for i, sibling := range siblings {
+		if sibling.ID == id {
+			d.siblings[key] = append(siblings[:i:i], siblings[i+1:]...)
+
+			return
+		}
+	}
+}
+
+// handleDeletedRecord deals with a record the provider no longer knows by its
+// cached id. The record is looked up by name again first, as it may have been
+// replaced, e.g. after its domain moved to another zone, and that one is
+// managed instead. Otherwise it is recreated with value when enabled and
+// dropped from management until a later sync finds it again.
+func (d *DDNSUpdater) handleDeletedRecord(ctx context.Context, key recordKey, domain string, record Record, value string) error {
+	_, subdomain, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return err
+	}
+
+	if subdomain == "" {
+		subdomain = "@"
+	}
+
+	found, err := d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		return fmt.Errorf("record id=%s not found, unable to look it up again. domain=%s name=%s: %v", record.ID, domain, subdomain, err)
+	}
+
+	if replacement, ok := d.replacementRecord(key, record.ID, found); ok {
+		d.logger.Warn("record not found by id, managing the record found by name instead", "domain", domain, "name", subdomain, "record_id", record.ID, "new_record_id", replacement.ID)
+
+		d.cacheRecord(key, record.ID, replacement)
+
+		if replacement.Data == value && !d.ttlDiffers(key.Name, replacement) {
+			d.trackRecovery(key)
+
+			return nil
+		}
+
+		return d.updateRecord(ctx, key, replacement, value)
+	}
+
+	if !d.recreateDeleted && !d.createMissing {
+		d.forgetRecord(key, record.ID)
+
+		return fmt.Errorf("record was deleted externally, no longer managing domain=%s name=%s id=%s", domain, record.Name, record.ID)
+	}
+
+	d.logger.Warn("record was deleted externally, recreating", "domain", domain, "name", subdomain, "record_id", record.ID)
+
+	// the cached name is relative to the zone the record was found in
+	oldValue := record.Data
+	record.Name = subdomain
+	record.Data = value
+
+	r, err := d.providerFor(key.Name).CreateRecord(ctx, domain, record)
+	if err != nil {
+		err = fmt.Errorf("error while recreating domain record: %v", err)
+		d.audit(key, d.providerName(key.Name), AuditFailed, record.ID, oldValue, value, err)
+
+		return err
+	}
+
+	d.logger.Info("record recreated", "domain", domain, "name", r.Name, "record_id", r.ID, "new_ip", r.Data)
+
+	d.audit(key, d.providerName(key.Name), AuditRecreated, r.ID, oldValue, r.Data, nil)
+
+	d.recordUpdated(key)
+	d.cacheRecord(key, record.ID, r)
+
+	return nil
+}
+
+// replacementRecord returns the first of found, the records of key looked up
+// by name, that isn't the record with id, missing at the provider, or already
+// cached for key.
+func (d *DDNSUpdater) replacementRecord(key recordKey, id string, found []Record) (Record, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cached := map[string]bool{id: true, d.recordMap[key].ID: true}
+	for _, sibling := range d.siblings[key] {
+		cached[sibling.ID] = true
+	}
+
+	for _, r := range found {
+		if !cached[r.ID] {
+			return r, true
+		}
+	}
+
+	return Record{}, false
+}
+
+// createMissingRecord creates the record for key holding value. Another
+// instance starting at the same time may create it too, so the record is looked
+// up again afterwards: providers pick deterministically among duplicates, and
+// the instance whose record lost deletes it.
+func (d *DDNSUpdater) createMissingRecord(ctx context.Context, key recordKey, value string) error {
+	domain, subdomain, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return err
+	}
+
+	if subdomain == "" {
+		subdomain = "@"
+	}
+
+	found, err := d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+	if err == nil && len(found) == 0 {
+		err = ErrRecordNotFound
+	}
+
+	if err == nil {
+		existing := found[0]
+
+		d.logger.Info("record appeared since the last sync, managing it", "domain", domain, "name", subdomain, "record_id", existing.ID)
+
+		d.cacheRecord(key, "", existing)
+		if existing.Data == value && !d.ttlDiffers(key.Name, existing) {
+			return nil
+		}
+
+		return d.updateRecord(ctx, key, existing, value)
+	}
+
+	if !errors.Is(err, ErrRecordNotFound) {
+		return fmt.Errorf("unable to fetch records. domain=%s name=%s: %v", domain, subdomain, err)
+	}
+
+	// created records without a configured ttl keep the provider default
+	ttl, _ := d.targetTTL(key.Name, 0)
+
+	created, err := d.providerFor(key.Name).CreateRecord(ctx, domain, Record{Type: key.Type, Name: subdomain, Data: value, TTL: ttl})
+	if err != nil {
+		err = fmt.Errorf("error while creating domain record: %v", err)
+		d.audit(key, d.providerName(key.Name), AuditFailed, "", "", value, err)
+
+		return err
+	}
+
+	d.logger.Info("record created", "domain", domain, "name", subdomain, "record_id", created.ID, "new_ip", created.Data)
+
+	d.audit(key, d.providerName(key.Name), AuditCreated, created.ID, "", created.Data, nil)
+
+	d.recordUpdated(key)
+	d.cacheRecord(key, "", created)
+
+	found, err = d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+	if err != nil || len(found) == 0 || found[0].ID == created.ID {
+		return nil
+	}
+
+	winner := found[0]
+
+	d.logger.Warn("record was created concurrently, deleting the duplicate", "domain", domain, "name", subdomain, "record_id", winner.ID, "duplicate_id", created.ID)
+
+	d.cacheRecord(key, created.ID, winner)
+
+	err = d.providerFor(key.Name).DeleteRecord(ctx, domain, created.ID)
+	if err != nil {
+		err = fmt.Errorf("unable to delete duplicate record domain=%s id=%s: %v", domain, created.ID, err)
+		d.audit(key, d.providerName(key.Name), AuditFailed, created.ID, created.Data, "", err)
+
+		return err
+	}
+
+	d.audit(key, d.providerName(key.Name), AuditDeleted, created.ID, created.Data, "", nil)
+
+	if winner.Data == value && !d.ttlDiffers(key.Name, winner) {
+		return nil
+	}
+
+	return d.updateRecord(ctx, key, winner, value)
+}
+
+// providerFor returns the Provider managing the domain name.
+func (d *DDNSUpdater) providerFor(name string) Provider {
+	return d.providers[d.providerName(name)]
+}
+
+// providerName returns the name of the provider managing the domain name.
+func (d *DDNSUpdater) providerName(name string) string {
+	if provider := d.specs[name].Provider; provider != "" {
+		return provider
+	}
+
+	return d.defaultProvider
+}
+
+// ttlFor returns the TTL configured for the domain name, 0 when the record's
+// TTL should be left as is.
+func (d *DDNSUpdater) ttlFor(name string) int {
+	if ttl := d.specs[name].TTL; ttl > 0 {
+		return ttl
+	}
+
+	return d.ttl
+}
+
+// targetTTL returns the TTL a record of name with the TTL current gets on
+// update, 0 to leave it as is: the configured TTL or current, raised to minTTL
+// when below it. raised reports whether the floor applied.
+func (d *DDNSUpdater) targetTTL(name string, current int) (ttl int, raised bool) {
+	ttl = d.ttlFor(name)
+	if ttl == 0 {
+		ttl = current
+	}
+
+	provider := d.providerName(name)
+	if kind, ok := d.credentialTypes[provider]; ok {
+		provider = kind
+	}
+
+	// 1 is Cloudflare's automatic TTL rather than a second
+	if provider == ProviderCloudflare && ttl == 1 {
+		return d.ttlFor(name), false
+	}
+
+	if ttl > 0 && ttl < d.minTTL {
+		return d.minTTL, true
+	}
+
+	return d.ttlFor(name), false
+}
+
+// ttlDiffers reports whether record doesn't have the TTL it gets on update.
+func (d *DDNSUpdater) ttlDiffers(name string, record Record) bool {
+	ttl, _ := d.targetTTL(name, record.TTL)
+
+	return ttl != 0 && record.TTL != ttl
+}
+
+// updateRecord writes value to a single record of key.
+func (d *DDNSUpdater) updateRecord(ctx context.Context, key recordKey, record Record, value string) error {
+	domain, subdomain, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	until, locked := d.zoneCooldown[domain]
+	if locked && !time.Now().Before(until) {
+		delete(d.zoneCooldown, domain)
+
+		locked = false
+	}
+	d.mu.Unlock()
+
+	if locked {
+		return fmt.Errorf("%w: skipping domain=%s name=%s until %s", ErrZoneLocked, domain, record.Name, until.Format(time.RFC3339))
+	}
+
+	ttl, raised := d.targetTTL(key.Name, record.TTL)
+	if ttl == record.TTL {
+		ttl = 0
+	}
+
+	if raised {
+		d.logger.Info("raising ttl to DDNS_MIN_TTL", "domain", domain, "name", record.Name, "record_id", record.ID, "ttl", record.TTL, "configured_ttl", d.ttlFor(key.Name), "min_ttl", d.minTTL)
+	}
+
+	r, err := d.providerFor(key.Name).UpdateRecord(ctx, domain, record.ID, value, ttl)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		d.audit(key, d.providerName(key.Name), AuditFailed, record.ID, record.Data, value, err)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrZoneLocked) {
+			d.mu.Lock()
+			d.zoneCooldown[domain] = time.Now().Add(d.zoneLockCooldown)
+			d.mu.Unlock()
+
+			return fmt.Errorf("%w: pausing updates for zone %s for %s: %v", ErrZoneLocked, domain, d.zoneLockCooldown, err)
+		}
+
+		if errors.Is(err, ErrRecordNotFound) {
+			return d.handleDeletedRecord(ctx, key, domain, record, value)
+		}
+
+		return fmt.Errorf("error while updating domain record: %v", err)
+	}
+
+	if r.Data != value {
+		// don't cache a record the provider claims to have updated but didn't
+		d.logger.Warn("provider returned unexpected data, re-checking next cycle", "domain", domain, "name", record.Name, "record_id", record.ID, "data", r.Data, "new_ip", value)
+
+		d.mu.Lock()
+		d.recheck[key] = true
+		d.mu.Unlock()
+
+		return nil
+	}
+
+	// a dry run write never reaches the provider, so there is nothing to read back
+	if d.verifyUpdates && !d.dryRun {
+		d.queueVerification(key, domain, subdomain, r.ID, value)
+	}
+
+	d.logger.Info("record updated", "domain", domain, "name", record.Name, "record_id", r.ID, "old_ip", record.Data, "new_ip", r.Data)
+
+	d.audit(key, d.providerName(key.Name), AuditUpdated, r.ID, record.Data, r.Data, nil)
+	d.recordUpdated(key)
+	d.trackWrite(key, r.ID, record)
+
+	if r.ID != record.ID {
+		d.logger.Warn("record id changed", "domain", domain, "name", record.Name, "old_id", record.ID, "record_id", r.ID)
+	}
+
+	// cache under the configured name so later cycles use the returned id
+	d.cacheRecord(key, record.ID, r)
+
+	return nil
+}
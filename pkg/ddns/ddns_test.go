@@ -0,0 +1,1932 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// fakeDomains is an in-memory domainsService standing in for the DO api.
+type fakeDomains struct {
+	mu      sync.Mutex
+	records []godo.DomainRecord
+	nextID  int
+	// splits listings into pages of that many records, 0 returns one page
+	pageSize int
+	// answers every call without a response, like some SDK edge cases
+	nilResponse bool
+	// method name: error returned instead of calling it
+	errs map[string]error
+	// changes the record an edit returns, e.g. to mimic a DO inconsistency
+	editHook func(r *godo.DomainRecord)
+	// method name: calls made
+	calls map[string]int
+	// edit requests in the order they were made
+	edits []godo.DomainRecordEditRequest
+}
+
+func newFakeDomains(records ...godo.DomainRecord) *fakeDomains {
+	f := &fakeDomains{records: records, nextID: 100, errs: map[string]error{}, calls: map[string]int{}}
+
+	for _, r := range records {
+		f.nextID = max(f.nextID, r.ID+1)
+	}
+
+	return f
+}
+
+// call counts a call of method and returns the error set for it.
+func (f *fakeDomains) call(method string) error {
+	f.calls[method]++
+
+	return f.errs[method]
+}
+
+// Calls returns how often method was called.
+func (f *fakeDomains) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[method]
+}
+
+// Get returns a copy of the stored record with id.
+func (f *fakeDomains) Get(id int) (godo.DomainRecord, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, r := range f.records {
+		if r.ID == id {
+			return r, true
+		}
+	}
+
+	return godo.DomainRecord{}, false
+}
+
+// Set changes the data of the stored record with id, like an edit in the
+// DO console.
+func (f *fakeDomains) Set(id int, data string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.records {
+		if f.records[i].ID == id {
+			f.records[i].Data = data
+		}
+	}
+}
+
+// page returns the page of records opt asks for and the links to the next.
+func (f *fakeDomains) page(records []godo.DomainRecord, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response) {
+	resp := f.response()
+	if f.pageSize == 0 || opt == nil || resp == nil {
+		return records, resp
+	}
+
+	page := max(opt.Page, 1)
+	start := min((page-1)*f.pageSize, len(records))
+	end := min(start+f.pageSize, len(records))
+
+	if end < len(records) {
+		resp.Links = &godo.Links{Pages: &godo.Pages{Next: fmt.Sprintf("https://api.digitalocean.com/v2/domains/x/records?page=%d", page+1)}}
+	}
+
+	return records[start:end], resp
+}
+
+func (f *fakeDomains) Records(_ context.Context, domain string, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("Records"); err != nil {
+		return nil, nil, err
+	}
+
+	records, resp := f.page(append([]godo.DomainRecord{}, f.records...), opt)
+
+	return records, resp, nil
+}
+
+func (f *fakeDomains) RecordsByTypeAndName(_ context.Context, domain, recType, name string, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("RecordsByTypeAndName"); err != nil {
+		return nil, nil, err
+	}
+
+	matched := []godo.DomainRecord{}
+	for _, r := range f.records {
+		if r.Type == recType && fqdn(domain, r.Name) == name {
+			matched = append(matched, r)
+		}
+	}
+
+	records, resp := f.page(matched, opt)
+
+	return records, resp, nil
+}
+
+func (f *fakeDomains) Record(_ context.Context, _ string, id int) (*godo.DomainRecord, *godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("Record"); err != nil {
+		return nil, nil, err
+	}
+
+	for _, r := range f.records {
+		if r.ID == id {
+			return &r, f.response(), nil
+		}
+	}
+
+	return nil, nil, apiError(http.StatusNotFound, "The resource you were accessing could not be found.")
+}
+
+func (f *fakeDomains) EditRecord(_ context.Context, _ string, id int, request *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.edits = append(f.edits, *request)
+
+	if err := f.call("EditRecord"); err != nil {
+		return nil, nil, err
+	}
+
+	for i, r := range f.records {
+		if r.ID != id {
+			continue
+		}
+
+		f.records[i].Data = request.Data
+		f.records[i].TTL = request.TTL
+
+		edited := f.records[i]
+		if f.editHook != nil {
+			f.editHook(&edited)
+		}
+
+		return &edited, f.response(), nil
+	}
+
+	return nil, nil, apiError(http.StatusNotFound, "The resource you were accessing could not be found.")
+}
+
+func (f *fakeDomains) CreateRecord(_ context.Context, _ string, request *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("CreateRecord"); err != nil {
+		return nil, nil, err
+	}
+
+	r := godo.DomainRecord{ID: f.nextID, Type: request.Type, Name: request.Name, Data: request.Data, TTL: request.TTL}
+	f.nextID++
+	f.records = append(f.records, r)
+
+	return &r, f.response(), nil
+}
+
+func (f *fakeDomains) DeleteRecord(_ context.Context, _ string, id int) (*godo.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.call("DeleteRecord"); err != nil {
+		return nil, err
+	}
+
+	for i, r := range f.records {
+		if r.ID == id {
+			f.records = append(f.records[:i], f.records[i+1:]...)
+
+			return f.response(), nil
+		}
+	}
+
+	return nil, apiError(http.StatusNotFound, "The resource you were accessing could not be found.")
+}
+
+// response is the response to a successful call.
+func (f *fakeDomains) response() *godo.Response {
+	if f.nilResponse {
+		return nil
+	}
+
+	return okResponse()
+}
+
+// okResponse is a 200 response with an empty JSON body.
+func okResponse() *godo.Response {
+	return &godo.Response{Response: &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}}
+}
+
+// apiError is an error response of the DO api with status.
+func apiError(status int, message string) error {
+	return &godo.ErrorResponse{Response: &http.Response{StatusCode: status, Request: &http.Request{Method: http.MethodPut}}, Message: message}
+}
+
+// newTestDO returns a DO provider making its record calls to domains.
+func newTestDO(domains domainsService) *digitalOceanProvider {
+	return &digitalOceanProvider{
+		client:  godo.NewClient(nil),
+		domains: domains,
+		records: map[int]godo.DomainRecord{},
+	}
+}
+
+// offlineDO is a DO provider whose token is always valid, as validating it
+// would call the real api.
+type offlineDO struct {
+	*digitalOceanProvider
+}
+
+func (offlineDO) Validate(context.Context) error {
+	return nil
+}
+
+// newOfflineDO returns a DO provider for updaters, making its record calls to
+// domains.
+func newOfflineDO(domains domainsService) offlineDO {
+	return offlineDO{newTestDO(domains)}
+}
+
+// memProvider is an in-memory Provider for tests of the updater, keyed by
+// zone.
+type memProvider struct {
+	mu      sync.Mutex
+	records map[string][]Record
+	nextID  int
+	// error returned by every call of the named method
+	errs map[string]error
+	// delay before every UpdateRecord returns
+	updateDelay time.Duration
+	// method name: calls made
+	calls map[string]int
+}
+
+func newMemProvider() *memProvider {
+	return &memProvider{records: map[string][]Record{}, nextID: 1, errs: map[string]error{}, calls: map[string]int{}}
+}
+
+// Add stores a record in zone and returns its ID.
+func (p *memProvider) Add(zone, recType, name, data string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := fmt.Sprint(p.nextID)
+	p.nextID++
+	p.records[zone] = append(p.records[zone], Record{ID: id, Type: recType, Name: name, Data: data})
+
+	return id
+}
+
+// Data returns the data of the record with id in zone.
+func (p *memProvider) Data(zone, id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.records[zone] {
+		if r.ID == id {
+			return r.Data
+		}
+	}
+
+	return ""
+}
+
+// Calls returns how often method was called.
+func (p *memProvider) Calls(method string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.calls[method]
+}
+
+func (p *memProvider) call(method string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls[method]++
+
+	return p.errs[method]
+}
+
+func (p *memProvider) Validate(context.Context) error {
+	return p.call("Validate")
+}
+
+func (p *memProvider) FindRecords(_ context.Context, domain, recType, name string) ([]Record, error) {
+	if err := p.call("FindRecords"); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "@"
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	found := []Record{}
+	for _, r := range p.records[domain] {
+		if r.Type == recType && r.Name == name {
+			found = append(found, r)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w: no %s record %s in %s", ErrRecordNotFound, recType, name, domain)
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+
+	return found, nil
+}
+
+func (p *memProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	if err := p.call("UpdateRecord"); err != nil {
+		return Record{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return Record{}, ctx.Err()
+	case <-time.After(p.updateDelay):
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, r := range p.records[domain] {
+		if r.ID == id {
+			p.records[domain][i].Data = data
+			if ttl > 0 {
+				p.records[domain][i].TTL = ttl
+			}
+
+			return p.records[domain][i], nil
+		}
+	}
+
+	return Record{}, fmt.Errorf("%w: no record %s in %s", ErrRecordNotFound, id, domain)
+}
+
+func (p *memProvider) CreateRecord(_ context.Context, domain string, record Record) (Record, error) {
+	if err := p.call("CreateRecord"); err != nil {
+		return Record{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	record.ID = fmt.Sprint(p.nextID)
+	p.nextID++
+	p.records[domain] = append(p.records[domain], record)
+
+	return record, nil
+}
+
+func (p *memProvider) DeleteRecord(_ context.Context, domain, id string) error {
+	if err := p.call("DeleteRecord"); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, r := range p.records[domain] {
+		if r.ID == id {
+			p.records[domain] = append(p.records[domain][:i], p.records[domain][i+1:]...)
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no record %s in %s", ErrRecordNotFound, id, domain)
+}
+
+// testEnv is the environment every test updater starts from.
+var testEnv = map[string]string{
+	"DDNS_INTERVAL":      "5m",
+	"DDNS_DOMAINS":       "home.example.com",
+	"DDNS_DO_API_TOKEN":  "test-token",
+	"DDNS_RECORD_TYPES":  "A",
+	"DDNS_IP_PROVIDER":   "http://127.0.0.1:1",
+	"DDNS_CHECKIP_URLS":  "",
+	"DDNS_CONFIG_FILE":   "",
+	"DDNS_SECRETS_DIR":   "",
+	"DDNS_STATE_FILE":    "",
+	"DDNS_HISTORY_FILE":  "",
+	"DDNS_METRICS_ADDR":  "",
+	"DDNS_CYCLE_RETRIES": "",
+}
+
+// loadTestConfig loads the config from testEnv with env on top.
+func loadTestConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+
+	for key, value := range testEnv {
+		t.Setenv(key, value)
+	}
+
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	return cfg
+}
+
+// newTestUpdater creates an updater from testEnv with env on top, managing
+// its records through provider.
+func newTestUpdater(t *testing.T, env map[string]string, provider Provider) *DDNSUpdater {
+	t.Helper()
+
+	d := NewDDNSUpdater(loadTestConfig(t, env), map[string]Provider{ProviderDigitalOcean: provider})
+	t.Cleanup(d.cancel)
+
+	return d
+}
+
+// ipServer serves body as the answer of an ip provider.
+func ipServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// key returns the record key of the A record of name.
+func key(name string) recordKey {
+	return recordKey{Name: name, Type: "A"}
+}
+
+func TestUpdateRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		// data the record holds before the change
+		data string
+		// error returned by EditRecord
+		editErr error
+		wantErr bool
+		// EditRecord calls expected
+		wantEdits int
+		// data the record holds afterwards
+		wantData string
+	}{
+		{name: "skips a record already holding the ip", data: "8.8.8.8", wantEdits: 0, wantData: "8.8.8.8"},
+		{name: "updates a record holding the old ip", data: "8.8.4.4", wantEdits: 1, wantData: "8.8.8.8"},
+		{name: "reports a failed edit", data: "8.8.4.4", editErr: apiError(http.StatusUnprocessableEntity, "invalid data"), wantErr: true, wantEdits: 1, wantData: "8.8.4.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: tt.data, TTL: 300})
+			if tt.editErr != nil {
+				domains.errs["EditRecord"] = tt.editErr
+			}
+
+			d := newTestUpdater(t, nil, newTestDO(domains))
+			ctx := context.Background()
+
+			if err := d.syncRecords(ctx); err != nil {
+				t.Fatalf("syncRecords: %v", err)
+			}
+
+			d.startCycle()
+			d.currentIPs["A"] = net.ParseIP("8.8.4.4")
+
+			err := d.updateRecords(ctx, "A", net.ParseIP("8.8.8.8"), time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateRecords error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got := domains.Calls("EditRecord"); got != tt.wantEdits {
+				t.Errorf("EditRecord calls = %d, want %d", got, tt.wantEdits)
+			}
+
+			if r, _ := domains.Get(1); r.Data != tt.wantData {
+				t.Errorf("record data = %s, want %s", r.Data, tt.wantData)
+			}
+
+			if tt.wantErr && !d.failed[key("home.example.com")] {
+				t.Errorf("failed record isn't flagged as failed")
+			}
+
+			if !tt.wantErr && d.recordMap[key("home.example.com")].Data != "8.8.8.8" {
+				t.Errorf("cached data = %s, want 8.8.8.8", d.recordMap[key("home.example.com")].Data)
+			}
+		})
+	}
+}
+
+func TestCheckIP(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "plain text", env: map[string]string{"DDNS_IP_PROVIDER": ipServer(t, "8.8.8.8").URL}, want: "8.8.8.8"},
+		{name: "surrounding whitespace", env: map[string]string{"DDNS_IP_PROVIDER": ipServer(t, " 8.8.8.8\n").URL}, want: "8.8.8.8"},
+		{name: "json field", env: map[string]string{"DDNS_IP_PROVIDER": ipServer(t, `{"data": {"address": "8.8.8.8"}}`).URL, "DDNS_CHECKIP_FORMAT": "json", "DDNS_CHECKIP_JSON_FIELD": "data.address"}, want: "8.8.8.8"},
+		{name: "falls back past a failing provider", env: map[string]string{"DDNS_CHECKIP_URLS": failing.URL + "," + ipServer(t, "8.8.8.8").URL, "DDNS_CHECKIP_RETRIES": "0"}, want: "8.8.8.8"},
+		{name: "error page", env: map[string]string{"DDNS_IP_PROVIDER": ipServer(t, "<html>oops</html>").URL}, wantErr: "invalid address"},
+		{name: "all providers failing", env: map[string]string{"DDNS_IP_PROVIDER": failing.URL, "DDNS_CHECKIP_RETRIES": "0"}, wantErr: "all ip providers failed"},
+		{name: "wrong family", env: map[string]string{"DDNS_IP_PROVIDER": ipServer(t, "2001:db8::1").URL}, wantErr: "all ip providers failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestUpdater(t, tt.env, newMemProvider())
+
+			got, err := d.CheckIP(context.Background(), "A")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CheckIP error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CheckIP: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("CheckIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIPConsensus(t *testing.T) {
+	// answers once the lookup gives up
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+
+	agreeing, other := ipServer(t, "8.8.8.8").URL, ipServer(t, "8.8.4.4").URL
+
+	tests := []struct {
+		name    string
+		urls    []string
+		want    string
+		wantErr string
+	}{
+		{name: "agreement", urls: []string{agreeing, other, agreeing}, want: "8.8.8.8"},
+		{name: "agreement of the others", urls: []string{other, agreeing, agreeing}, want: "8.8.8.8"},
+		{name: "agreement past a hung provider", urls: []string{agreeing, slow.URL, agreeing}, want: "8.8.8.8"},
+		{name: "disagreement", urls: []string{agreeing, other}, wantErr: "8.8.8.8 not confirmed by another provider"},
+		{name: "timeout", urls: []string{agreeing, slow.URL}, wantErr: "ip providers disagree"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestUpdater(t, map[string]string{
+				"DDNS_CHECKIP_URLS":      strings.Join(tt.urls, ","),
+				"DDNS_IP_CONSENSUS":      "true",
+				"DDNS_CONSENSUS_TIMEOUT": "50ms",
+			}, newMemProvider())
+
+			start := time.Now()
+
+			got, err := d.CheckIP(context.Background(), "A")
+
+			// the hung provider is given up on, or no longer waited for
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("CheckIP returned after %s, want it bounded by DDNS_CONSENSUS_TIMEOUT", elapsed)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CheckIP error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CheckIP: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("CheckIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckIPConsensusConcurrent(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+
+	// each lookup takes long enough for the others to start meanwhile
+	counting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprint(w, "8.8.4.4")
+	}))
+	t.Cleanup(counting.Close)
+
+	urls := []string{ipServer(t, "8.8.8.8").URL}
+	for i := 0; i < 4; i++ {
+		// distinct urls of the same server
+		urls = append(urls, fmt.Sprintf("%s/%d", counting.URL, i))
+	}
+
+	d := newTestUpdater(t, map[string]string{
+		"DDNS_CHECKIP_URLS":          strings.Join(urls, ","),
+		"DDNS_IP_CONSENSUS":          "true",
+		"DDNS_CONSENSUS_CONCURRENCY": "2",
+	}, newMemProvider())
+
+	got, err := d.CheckIP(context.Background(), "A")
+	if err != nil {
+		t.Fatalf("CheckIP: %v", err)
+	}
+
+	if got != "8.8.4.4" {
+		t.Errorf("CheckIP = %s, want 8.8.4.4 the others agree on", got)
+	}
+
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("up to %d lookups ran at once, want DDNS_CONSENSUS_CONCURRENCY, 2", got)
+	}
+}
+
+func TestCheckIPSendsUserAgent(t *testing.T) {
+	var userAgent string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		fmt.Fprint(w, "8.8.8.8")
+	}))
+	t.Cleanup(srv.Close)
+
+	d := newTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": srv.URL}, newMemProvider())
+
+	if _, err := d.CheckIP(context.Background(), "A"); err != nil {
+		t.Fatalf("CheckIP: %v", err)
+	}
+
+	if !strings.HasPrefix(userAgent, "do-dynamic-dns-server/") {
+		t.Errorf("User-Agent = %q, want do-dynamic-dns-server/...", userAgent)
+	}
+}
+
+// testIP is an ip provider answering with an address the test can change.
+type testIP struct {
+	mu sync.Mutex
+	ip string
+	// requests answered with a 503 before answering with ip
+	failures int
+}
+
+// newTestIP starts an ip provider answering with ip and returns it with its URL.
+func newTestIP(t *testing.T, ip string) (*testIP, string) {
+	t.Helper()
+
+	s := &testIP{ip: ip}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if s.failures > 0 {
+			s.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprint(w, s.ip)
+	}))
+	t.Cleanup(srv.Close)
+
+	return s, srv.URL
+}
+
+// Set changes the address the provider answers with.
+func (s *testIP) Set(ip string) {
+	s.mu.Lock()
+	s.ip = ip
+	s.mu.Unlock()
+}
+
+// Fail makes the next n requests fail.
+func (s *testIP) Fail(n int) {
+	s.mu.Lock()
+	s.failures = n
+	s.mu.Unlock()
+}
+
+// startTestUpdater creates an updater like newTestUpdater and syncs its
+// records.
+func startTestUpdater(t *testing.T, env map[string]string, provider Provider) *DDNSUpdater {
+	t.Helper()
+
+	d := newTestUpdater(t, env, provider)
+
+	if err := d.start(d.ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	return d
+}
+
+// runTestCycle runs a check of every domain, like a forced check of the run
+// loop.
+func runTestCycle(d *DDNSUpdater) error {
+	clear(d.domainNext)
+	d.updateNextCheck()
+
+	now := time.Now()
+
+	return d.runCycleWithRetries(d.ctx, now, now)
+}
+
+// logBuffer collects the log lines of a test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// Count returns how many lines were logged with msg.
+func (b *logBuffer) Count(msg string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.Count(b.buf.String(), logMsg(msg))
+}
+
+// CountWith returns how many lines were logged with msg and containing attrs.
+func (b *logBuffer) CountWith(msg, attrs string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		if strings.Contains(line, logMsg(msg)) && strings.Contains(line, attrs) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// logMsg returns msg as the text handler logs it.
+func logMsg(msg string) string {
+	if strings.ContainsAny(msg, " =\"") {
+		return fmt.Sprintf("msg=%q ", msg)
+	}
+
+	return "msg=" + msg + " "
+}
+
+// captureLogs logs to the returned buffer until the test ends. It must be
+// called before the updater is created.
+func captureLogs(t *testing.T) *logBuffer {
+	t.Helper()
+
+	logs := &logBuffer{}
+	previous := slog.Default()
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return logs
+}
+
+func TestParseDomainSpecRecordOverride(t *testing.T) {
+	spec, err := ParseDomainSpec("nas.example.com@record=nas_box")
+	if err != nil {
+		t.Fatalf("ParseDomainSpec: %v", err)
+	}
+
+	if spec.Name != "nas.example.com" || spec.RecordName != "nas_box" {
+		t.Errorf("spec = %+v, want name nas.example.com with record nas_box", spec)
+	}
+
+	if _, err := ParseDomainSpec("nas.example.com@record="); err == nil {
+		t.Errorf("ParseDomainSpec accepted an empty record option")
+	}
+}
+
+func TestParseDomainSpecApex(t *testing.T) {
+	spec, err := ParseDomainSpec("@.example.com@ttl=60")
+	if err != nil {
+		t.Fatalf("ParseDomainSpec: %v", err)
+	}
+
+	if spec.Name != "example.com" || spec.TTL != 60 {
+		t.Errorf("spec = %+v, want the apex example.com with ttl 60", spec)
+	}
+
+	// both spellings of the apex are the same domain
+	cfg := loadTestConfig(t, map[string]string{"DDNS_DOMAINS": "example.com,@.example.com"})
+	if len(cfg.Domains) != 1 || cfg.Domains[0].Name != "example.com" {
+		t.Errorf("domains %+v, want example.com once", cfg.Domains)
+	}
+}
+
+func TestParseDomainSpecTTL(t *testing.T) {
+	for _, raw := range []string{"nas.example.com=60", "nas.example.com@ttl=60", "nas.example.com=60@required"} {
+		spec, err := ParseDomainSpec(raw)
+		if err != nil {
+			t.Fatalf("ParseDomainSpec(%s): %v", raw, err)
+		}
+
+		if spec.Name != "nas.example.com" || spec.TTL != 60 {
+			t.Errorf("ParseDomainSpec(%s) = %+v, want nas.example.com with ttl 60", raw, spec)
+		}
+	}
+
+	for _, raw := range []string{"nas.example.com=", "nas.example.com=0", "nas.example.com=1m"} {
+		if _, err := ParseDomainSpec(raw); err == nil {
+			t.Errorf("ParseDomainSpec accepted %s", raw)
+		}
+	}
+}
+
+func TestSyncRecordOverride(t *testing.T) {
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 1, Type: "A", Name: "nas", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 2, Type: "A", Name: "nas_box", Data: "8.8.4.4"},
+	)
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_DOMAINS": "nas.example.com@record=nas_box", "DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if got := d.recordMap[key("nas.example.com")].ID; got != "2" {
+		t.Fatalf("synced record %s, want the overridden name's record 2", got)
+	}
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if r, _ := domains.Get(2); r.Data != "8.8.8.8" {
+		t.Errorf("overridden record holds %s, want 8.8.8.8", r.Data)
+	}
+
+	if r, _ := domains.Get(1); r.Data != "8.8.4.4" {
+		t.Errorf("derived record was changed to %s", r.Data)
+	}
+}
+
+func TestBlocklistedIP(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	_, ipURL := newTestIP(t, "1.1.1.1")
+	server, webhookURL := newWebhookServer(t)
+
+	d := startTestUpdater(t, map[string]string{
+		"DDNS_IP_PROVIDER":     ipURL,
+		"DDNS_BLOCKLIST_IPS":   "1.1.1.1, 1.0.0.1",
+		"DDNS_WEBHOOK_URL":     webhookURL,
+		"DDNS_NOTIFY_THROTTLE": "1h",
+	}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err == nil || !strings.Contains(err.Error(), "blocklisted") {
+		t.Fatalf("cycle error = %v, want the blocklisted ip to fail the cycle", err)
+	}
+
+	if got := domains.Calls("EditRecord"); got != 0 {
+		t.Errorf("EditRecord calls = %d, want the blocklisted ip never written", got)
+	}
+
+	if d.currentIPs["A"] != nil {
+		t.Errorf("blocklisted ip %s was taken as the current ip", d.currentIPs["A"])
+	}
+
+	if len(d.cycle.Errors) != 1 {
+		t.Errorf("cycle errors = %v, want the blocklisted ip", d.cycle.Errors)
+	}
+
+	events := server.Events()
+	if len(events) != 1 || events[0].Event != BlocklistEventDetected || events[0].RecordType != "A" {
+		t.Fatalf("sent %+v, want a single blocklist alert for A", events)
+	}
+
+	// the next detection within the throttle is held back
+	if err := runTestCycle(d); err == nil {
+		t.Fatalf("second cycle succeeded with a blocklisted ip")
+	}
+
+	if got := len(server.Events()); got != 1 {
+		t.Errorf("sent %d alerts, want the repeated one throttled", got)
+	}
+}
+
+func TestBlocklistConfig(t *testing.T) {
+	cfg := loadTestConfig(t, map[string]string{"DDNS_BLOCKLIST_IPS": " 1.1.1.1 , 2001:db8::1"})
+
+	if len(cfg.BlocklistIPs) != 2 || !cfg.BlocklistIPs[0].Equal(net.ParseIP("1.1.1.1")) {
+		t.Errorf("BlocklistIPs = %v, want 1.1.1.1 and 2001:db8::1", cfg.BlocklistIPs)
+	}
+
+	t.Setenv("DDNS_BLOCKLIST_IPS", "1.1.1.1,not-an-ip")
+
+	if _, err := LoadConfig(nil); err == nil {
+		t.Errorf("LoadConfig accepted an invalid blocklist address")
+	}
+}
+
+func TestRequiredDomainAlertsRightAway(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+	domains.errs["EditRecord"] = apiError(http.StatusInternalServerError, "server error")
+
+	ip, ipURL := newTestIP(t, "8.8.8.8")
+	server, webhookURL := newWebhookServer(t)
+
+	d := startTestUpdater(t, map[string]string{
+		"DDNS_DOMAINS":     "home.example.com@required",
+		"DDNS_IP_PROVIDER": ipURL,
+		"DDNS_WEBHOOK_URL": webhookURL,
+	}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err == nil {
+		t.Fatalf("cycle succeeded with a failing edit")
+	}
+
+	if got := domains.Calls("EditRecord"); got != 2 {
+		t.Errorf("EditRecord calls = %d, want the update and its retry", got)
+	}
+
+	// the default threshold of 3 doesn't hold back a required domain
+	events := server.Events()
+	if len(events) != 1 || events[0].Event != FailureEventFailing || events[0].Domain != "home.example.com" || events[0].Failures != 1 {
+		t.Fatalf("sent %+v, want a failing alert after the first failed cycle", events)
+	}
+
+	delete(domains.errs, "EditRecord")
+	ip.Set("1.1.1.1")
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	// followed by the ip change event
+	if events := server.Events(); len(events) < 2 || events[1].Event != FailureEventRecovered {
+		t.Errorf("sent %+v, want the recovery to follow", events)
+	}
+}
+
+func TestZoneLockCooldown(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+	domains.errs["EditRecord"] = apiError(http.StatusLocked, "zone is locked")
+
+	ip, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_ZONE_LOCK_COOLDOWN": "1h"}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); !errors.Is(err, ErrZoneLocked) {
+		t.Fatalf("cycle error = %v, want ErrZoneLocked", err)
+	}
+
+	if _, ok := d.zoneCooldown["example.com"]; !ok {
+		t.Fatalf("no cooldown started for example.com")
+	}
+
+	// the next change is held back while the zone is cooling down
+	ip.Set("1.1.1.1")
+
+	if err := runTestCycle(d); !errors.Is(err, ErrZoneLocked) {
+		t.Fatalf("second cycle error = %v, want ErrZoneLocked", err)
+	}
+
+	if got := domains.Calls("EditRecord"); got != 1 {
+		t.Errorf("EditRecord calls = %d, want no edit during the cooldown", got)
+	}
+
+	// once it's over the record is written again
+	delete(domains.errs, "EditRecord")
+	d.zoneCooldown["example.com"] = time.Now().Add(-time.Second)
+
+	ip.Set("8.8.8.8")
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle after the cooldown: %v", err)
+	}
+
+	if r, _ := domains.Get(1); r.Data != "8.8.8.8" {
+		t.Errorf("record holds %s after the cooldown, want 8.8.8.8", r.Data)
+	}
+}
+
+func TestValidateFamily(t *testing.T) {
+	tests := []struct {
+		recType string
+		ip      string
+		wantErr bool
+	}{
+		{recType: "A", ip: "8.8.8.8"},
+		{recType: "A", ip: "2001:4860:4860::8888", wantErr: true},
+		{recType: "AAAA", ip: "2001:4860:4860::8888"},
+		{recType: "AAAA", ip: "8.8.8.8", wantErr: true},
+		// an IPv4-mapped address is still IPv4
+		{recType: "AAAA", ip: "::ffff:8.8.8.8", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateFamily(tt.recType, net.ParseIP(tt.ip))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateFamily(%s, %s) = %v, want error %v", tt.recType, tt.ip, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFamilyMismatchSkipsUpdate(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	// a dual stack provider answering over IPv6
+	_, ipURL := newTestIP(t, "2001:4860:4860::8888")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_CHECKIP_RETRIES": "0"}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err == nil {
+		t.Errorf("cycle with an IPv6 answer for an A record succeeded")
+	}
+
+	if got := domains.Calls("EditRecord"); got != 0 {
+		t.Errorf("EditRecord calls = %d, want an IPv6 address never written to an A record", got)
+	}
+}
+
+func TestUnexpectedDataFlagsRecheck(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+	domains.editHook = func(r *godo.DomainRecord) { r.Data = "8.8.4.4" }
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := d.recordMap[key("home.example.com")].Data; got == "8.8.8.8" {
+		t.Errorf("cached the data the api didn't confirm")
+	}
+
+	if !d.recheck[key("home.example.com")] {
+		t.Fatalf("record isn't flagged for a re-check")
+	}
+
+	// the next cycle writes it again though the ip is unchanged
+	domains.editHook = nil
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	if got := domains.Calls("EditRecord"); got != 2 {
+		t.Errorf("EditRecord calls = %d, want a second edit on the re-check", got)
+	}
+
+	if d.recheck[key("home.example.com")] {
+		t.Errorf("record is still flagged after a confirmed write")
+	}
+}
+
+func TestUntilDue(t *testing.T) {
+	d := newTestUpdater(t, map[string]string{"DDNS_TICK_GRANULARITY": "10m"}, newMemProvider())
+
+	tests := []struct {
+		name  string
+		next  time.Duration
+		tick  time.Duration
+		want  time.Duration
+		exact bool
+	}{
+		// a long interval sleeps up to the granularity instead of waking every second
+		{name: "capped by the granularity", next: time.Hour, tick: 10 * time.Minute, want: 10 * time.Minute, exact: true},
+		{name: "finer granularity", next: time.Hour, tick: time.Minute, want: time.Minute, exact: true},
+		{name: "until the next check", next: 5 * time.Second, tick: 10 * time.Minute, want: 5 * time.Second},
+		{name: "overdue", next: -time.Minute, tick: 10 * time.Minute, want: 0, exact: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.tick = tt.tick
+			d.nextCheck = time.Now().Add(tt.next)
+
+			got := d.untilDue()
+			if tt.exact && got != tt.want || !tt.exact && (got > tt.want || got < tt.want-time.Second) {
+				t.Errorf("untilDue = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManageDataPattern(t *testing.T) {
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "100.64.0.7"},
+		godo.DomainRecord{ID: 2, Type: "A", Name: "static", Data: "8.8.4.4"},
+	)
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{
+		"DDNS_DOMAINS":             "home.example.com,static.example.com",
+		"DDNS_IP_PROVIDER":         ipURL,
+		"DDNS_MANAGE_DATA_PATTERN": "100.64.0.0/10",
+	}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if r, _ := domains.Get(1); r.Data != "8.8.8.8" {
+		t.Errorf("matching record holds %s, want 8.8.8.8", r.Data)
+	}
+
+	if r, _ := domains.Get(2); r.Data != "8.8.4.4" {
+		t.Errorf("record outside the pattern was changed to %s", r.Data)
+	}
+}
+
+func TestDataMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		data    string
+		want    bool
+	}{
+		{pattern: "100.64.0.0/10", data: "100.64.1.2", want: true},
+		{pattern: "100.64.0.0/10", data: "8.8.8.8"},
+		{pattern: "100.64.0.0/10", data: "not an ip"},
+		{pattern: "2001:db8::/32", data: "2001:db8::1", want: true},
+		{pattern: `^8\.8\.`, data: "8.8.4.4", want: true},
+		{pattern: `^8\.8\.`, data: "1.8.8.1"},
+	}
+
+	for _, tt := range tests {
+		matcher, err := newDataMatcher(tt.pattern)
+		if err != nil {
+			t.Fatalf("newDataMatcher(%s): %v", tt.pattern, err)
+		}
+
+		if got := matcher.Match(tt.data); got != tt.want {
+			t.Errorf("%s matching %s = %v, want %v", tt.pattern, tt.data, got, tt.want)
+		}
+	}
+
+	if _, err := newDataMatcher("(unclosed"); err == nil {
+		t.Errorf("newDataMatcher accepted an invalid regular expression")
+	}
+}
+
+func TestSyncPicksARecord(t *testing.T) {
+	// another type at the same name, listed before the A records
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 3, Type: "TXT", Name: "home", Data: "v=spf1 -all"},
+		godo.DomainRecord{ID: 9, Type: "A", Name: "home", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 4, Type: "A", Name: "home", Data: "8.8.4.4"},
+	)
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if r, _ := domains.Get(4); r.Data != "8.8.8.8" {
+		t.Errorf("A record with the lowest id holds %s, want 8.8.8.8", r.Data)
+	}
+
+	if r, _ := domains.Get(9); r.Data != "8.8.4.4" {
+		t.Errorf("second A record was changed to %s without DDNS_UPDATE_ALL_RECORDS", r.Data)
+	}
+
+	if r, _ := domains.Get(3); r.Data != "v=spf1 -all" {
+		t.Errorf("TXT record was changed to %s", r.Data)
+	}
+}
+
+func TestCycleResultJSON(t *testing.T) {
+	result := CycleResult{
+		CycleID:        "0a1b2c3d",
+		Started:        time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DurationMillis: 42,
+		IPs:            map[string]string{"A": "8.8.8.8"},
+		IPChanged:      true,
+		UpdatedRecords: []string{"home.example.com/A"},
+		Errors:         []string{},
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(result); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"cycle_id":"0a1b2c3d","started":"2024-05-01T12:00:00Z","duration_ms":42,"ips":{"A":"8.8.8.8"},"ip_changed":true,"updated_records":["home.example.com/A"],"errors":[]}` + "\n"
+	if buf.String() != want {
+		t.Errorf("cycle result =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestCycleResult(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if d.cycle.IPs["A"] != "8.8.8.8" || len(d.cycle.UpdatedRecords) != 1 || d.cycle.UpdatedRecords[0] != "home.example.com/A" || len(d.cycle.Errors) != 0 {
+		t.Errorf("cycle result %+v, want the ip and the updated record", d.cycle)
+	}
+}
+
+func TestCycleRetries(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	provider, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_CHECKIP_RETRIES": "0", "DDNS_CYCLE_RETRIES": "2"}, newOfflineDO(domains))
+
+	// a momentary outage fails the first attempt of the cycle
+	provider.Fail(1)
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle failed despite the retry: %v", err)
+	}
+
+	if r, _ := domains.Get(1); r.Data != "8.8.8.8" {
+		t.Errorf("record holds %s after the retried cycle, want 8.8.8.8", r.Data)
+	}
+}
+
+func TestCycleRetriesGiveUp(t *testing.T) {
+	provider, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_CHECKIP_RETRIES": "0", "DDNS_CYCLE_RETRIES": "1"}, newOfflineDO(newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})))
+	provider.Fail(2)
+
+	if err := runTestCycle(d); err == nil {
+		t.Fatalf("cycle failing every attempt succeeded")
+	}
+}
+
+func TestCycleRetriesStopOnShutdown(t *testing.T) {
+	provider, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_CHECKIP_RETRIES": "0", "DDNS_CYCLE_RETRIES": "5"}, newOfflineDO(newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})))
+	provider.Fail(100)
+
+	close(d.stop)
+
+	start := time.Now()
+
+	if err := runTestCycle(d); err == nil {
+		t.Fatalf("failing cycle succeeded")
+	}
+
+	if elapsed := time.Since(start); elapsed >= DefaultCycleRetryBackoff {
+		t.Errorf("retries kept going for %s after shutdown", elapsed)
+	}
+}
+
+func TestEditChangingID(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	ip, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	// the api replaces the record on edit
+	domains.editHook = func(r *godo.DomainRecord) {
+		domains.records[0].ID = 42
+		r.ID = 42
+	}
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := d.recordMap[key("home.example.com")].ID; got != "42" {
+		t.Fatalf("cached record id = %s, want the returned id 42", got)
+	}
+
+	// the next change edits the new id
+	domains.editHook = nil
+	ip.Set("8.8.4.4")
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	if r, _ := domains.Get(42); r.Data != "8.8.4.4" {
+		t.Errorf("record 42 holds %s, want 8.8.4.4", r.Data)
+	}
+}
+
+func TestRecreateDeletedRecord(t *testing.T) {
+	tests := []struct {
+		name     string
+		recreate string
+		wantErr  bool
+	}{
+		{name: "recreated", recreate: "true"},
+		{name: "dropped", recreate: "false", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4", TTL: 600})
+
+			_, ipURL := newTestIP(t, "8.8.8.8")
+
+			d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_RECREATE_DELETED": tt.recreate}, newOfflineDO(domains))
+
+			// deleted in the DO console after the sync
+			if _, err := domains.DeleteRecord(context.Background(), "example.com", 1); err != nil {
+				t.Fatal(err)
+			}
+
+			err := runTestCycle(d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cycle error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "deleted externally") {
+					t.Errorf("cycle error = %v, want it to say the record was deleted externally", err)
+				}
+
+				if domains.Calls("CreateRecord") != 0 || d.recordMap[key("home.example.com")].ID != "" {
+					t.Errorf("deleted record wasn't dropped from management")
+				}
+
+				return
+			}
+
+			if got := domains.Calls("CreateRecord"); got != 1 {
+				t.Fatalf("CreateRecord calls = %d, want 1", got)
+			}
+
+			found, err := newTestDO(domains).FindRecords(context.Background(), "example.com", "A", "home")
+			if err != nil {
+				t.Fatalf("recreated record not found: %v", err)
+			}
+
+			if found[0].Data != "8.8.8.8" || found[0].TTL != 600 {
+				t.Errorf("recreated record %+v, want the new ip and the old ttl", found[0])
+			}
+
+			if got := d.recordMap[key("home.example.com")].ID; got != found[0].ID {
+				t.Errorf("cached record id = %s, want the recreated record %s", got, found[0].ID)
+			}
+		})
+	}
+}
+
+func TestDivergenceWarning(t *testing.T) {
+	logs := captureLogs(t)
+
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	ip, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	const warning = "record differs from the detected ip, an update is about to occur"
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := logs.Count(warning); got != 1 {
+		t.Fatalf("warned %d times on the first cycle, want once", got)
+	}
+
+	// later changes are regular updates
+	ip.Set("1.1.1.1")
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	if got := logs.Count(warning); got != 1 {
+		t.Errorf("warned %d times after a later change, want only on the first cycle", got)
+	}
+}
+
+func TestNoDivergenceWarning(t *testing.T) {
+	logs := captureLogs(t)
+
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.8.8"})
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := logs.Count("record differs from the detected ip, an update is about to occur"); got != 0 {
+		t.Errorf("warned %d times though the record holds the detected ip", got)
+	}
+}
+
+func TestSplitDomain(t *testing.T) {
+	tests := []struct {
+		spec      DomainSpec
+		zone      string
+		subdomain string
+		dnsName   string
+		wantErr   bool
+	}{
+		{spec: DomainSpec{Name: "example.com"}, zone: "example.com", dnsName: "example.com"},
+		{spec: DomainSpec{Name: "home.example.com"}, zone: "example.com", subdomain: "home", dnsName: "home.example.com"},
+		{spec: DomainSpec{Name: "a.b.home.example.com"}, zone: "example.com", subdomain: "a.b.home", dnsName: "a.b.home.example.com"},
+		{spec: DomainSpec{Name: "example.co.uk"}, zone: "example.co.uk", dnsName: "example.co.uk"},
+		{spec: DomainSpec{Name: "home.example.co.uk"}, zone: "example.co.uk", subdomain: "home", dnsName: "home.example.co.uk"},
+		{spec: DomainSpec{Name: " Home.Example.COM. "}, zone: "example.com", subdomain: "home", dnsName: "home.example.com"},
+		{spec: DomainSpec{Name: "*.example.com"}, zone: "example.com", subdomain: "*", dnsName: "*.example.com"},
+		{spec: DomainSpec{Name: "*.sub.example.com"}, zone: "example.com", subdomain: "*.sub", dnsName: "*.sub.example.com"},
+		{spec: DomainSpec{Name: "*.example.co.uk"}, zone: "example.co.uk", subdomain: "*", dnsName: "*.example.co.uk"},
+		{spec: DomainSpec{Name: "home.lan", Apex: "home.lan"}, zone: "home.lan", dnsName: "home.lan"},
+		{spec: DomainSpec{Name: "nas.home.lan", Apex: "home.lan"}, zone: "home.lan", subdomain: "nas", dnsName: "nas.home.lan"},
+		{spec: DomainSpec{Name: "example.com", RecordName: "@"}, zone: "example.com", subdomain: "@", dnsName: "example.com"},
+		{spec: DomainSpec{Name: "home.example.com", RecordName: "home_v2"}, zone: "example.com", subdomain: "home_v2", dnsName: "home_v2.example.com"},
+		{spec: DomainSpec{Name: "home.*.example.com"}, wantErr: true},
+		{spec: DomainSpec{Name: "com"}, wantErr: true},
+		{spec: DomainSpec{Name: "nas.other.lan", Apex: "home.lan"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec.Name, func(t *testing.T) {
+			zone, subdomain, dnsName, err := splitDomain(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitDomain error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if zone != tt.zone || subdomain != tt.subdomain || dnsName != tt.dnsName {
+				t.Errorf("splitDomain = %q, %q, %q, want %q, %q, %q", zone, subdomain, dnsName, tt.zone, tt.subdomain, tt.dnsName)
+			}
+		})
+	}
+}
+
+func TestDomainsList(t *testing.T) {
+	tests := []struct {
+		name    string
+		domains string
+		want    []string
+	}{
+		{name: "trailing comma", domains: "a.example.com,b.example.com,", want: []string{"a.example.com", "b.example.com"}},
+		{name: "spaces", domains: " a.example.com ,  b.example.com", want: []string{"a.example.com", "b.example.com"}},
+		{name: "empty entries", domains: "a.example.com,,,b.example.com", want: []string{"a.example.com", "b.example.com"}},
+		{name: "duplicates", domains: "a.example.com,b.example.com,A.example.com,a.example.com@required", want: []string{"a.example.com", "b.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, map[string]string{"DDNS_DOMAINS": tt.domains})
+
+			got := []string{}
+			for _, spec := range cfg.Domains {
+				got = append(got, spec.Name)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("domains = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// the first listing keeps its options
+	cfg := loadTestConfig(t, map[string]string{"DDNS_DOMAINS": "a.example.com@required, a.example.com"})
+	if !cfg.Domains[0].Required {
+		t.Errorf("a duplicate replaced the options of the first listing")
+	}
+}
+
+func TestUnchangedIPSkipsUpdate(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := domains.Calls("EditRecord"); got != 1 {
+		t.Fatalf("EditRecord calls = %d after the first cycle, want 1", got)
+	}
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	if got := domains.Calls("EditRecord"); got != 1 {
+		t.Errorf("EditRecord calls = %d after a cycle with the same ip, want still 1", got)
+	}
+}
+
+func TestShutdownWaitsForRun(t *testing.T) {
+	p := newMemProvider()
+	p.Add("example.com", "A", "home", "8.8.4.4")
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+	d := newTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL}, p)
+
+	go d.Run()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// Shutdown only returns once the run loop exited
+	select {
+	case <-d.done:
+	default:
+		t.Errorf("Shutdown returned while the run loop was still running")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	d := newTestUpdater(t, nil, newMemProvider())
+
+	// the run loop was never started, so it never exits
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown error = %v, want the context deadline", err)
+	}
+}
+
+func TestIPv6ChangeLeavesARecords(t *testing.T) {
+	p := newMemProvider()
+	a := p.Add("example.com", "A", "home", "8.8.8.8")
+	aaaa := p.Add("example.com", "AAAA", "home", "2001:4860::8844")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_RECORD_TYPES": "A,AAAA"}, p)
+	d.currentIPs["A"] = net.ParseIP("8.8.8.8")
+	d.currentIPs["AAAA"] = net.ParseIP("2001:4860::8844")
+
+	d.startCycle()
+	err := d.updateRecords(d.ctx, "AAAA", net.ParseIP("2001:4860::8888"), time.Now())
+	d.endCycle()
+
+	if err != nil {
+		t.Fatalf("updateRecords: %v", err)
+	}
+
+	if got := p.Data("example.com", aaaa); got != "2001:4860::8888" {
+		t.Errorf("AAAA record holds %s, want 2001:4860::8888", got)
+	}
+
+	// the A record and ip are tracked on their own
+	if got := p.Data("example.com", a); got != "8.8.8.8" {
+		t.Errorf("A record holds %s, want it left at 8.8.8.8", got)
+	}
+
+	if got := p.Calls("UpdateRecord"); got != 1 {
+		t.Errorf("made %d updates, want only the AAAA record's", got)
+	}
+
+	if got := d.currentIPs["A"].String(); got != "8.8.8.8" {
+		t.Errorf("current A address = %s, want 8.8.8.8", got)
+	}
+}
+
+func TestWildcardDomains(t *testing.T) {
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 1, Type: "A", Name: "*", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 2, Type: "A", Name: "*.sub", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 3, Type: "A", Name: "sub", Data: "8.8.4.4"},
+	)
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_DOMAINS": "*.example.com,*.sub.example.com", "DDNS_IP_PROVIDER": ipURL}, newOfflineDO(domains))
+
+	for name, id := range map[string]string{"*.example.com": "1", "*.sub.example.com": "2"} {
+		if got := d.recordMap[key(name)].ID; got != id {
+			t.Errorf("%s synced record %q, want %s", name, got, id)
+		}
+	}
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	for id, want := range map[int]string{1: "8.8.8.8", 2: "8.8.8.8", 3: "8.8.4.4"} {
+		if r, _ := domains.Get(id); r.Data != want {
+			t.Errorf("record %d (%s) holds %s, want %s", id, r.Name, r.Data, want)
+		}
+	}
+}
+
+func TestWildcardDomainsSeparateLookups(t *testing.T) {
+	provider := newMemProvider()
+	provider.Add("example.com", "A", "*", "8.8.4.4")
+	provider.Add("example.com", "A", "*.sub", "8.8.4.4")
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	// without listing zones every record is looked up by its name
+	d := startTestUpdater(t, map[string]string{"DDNS_DOMAINS": "*.example.com,*.sub.example.com", "DDNS_IP_PROVIDER": ipURL}, provider)
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if got := provider.Data("example.com", id); got != "8.8.8.8" {
+			t.Errorf("record %s holds %s, want 8.8.8.8", id, got)
+		}
+	}
+}
+
+func TestResolveIPProvider(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     string
+		wantErr  bool
+	}{
+		{provider: "ipify", want: "https://api.ipify.org/"},
+		{provider: "icanhazip", want: "https://icanhazip.com/"},
+		{provider: "ifconfig.me", want: "https://ifconfig.me/ip"},
+		{provider: "aws", want: CheckIPURL},
+		{provider: "https://ip.example.com/raw", want: "https://ip.example.com/raw"},
+		{provider: "http://192.168.1.1:8080/ip", want: "http://192.168.1.1:8080/ip"},
+		{provider: "ipfy", wantErr: true},
+		{provider: "ftp://ip.example.com/", wantErr: true},
+		{provider: "https://", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveIPProvider(tt.provider)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveIPProvider(%s) error = %v, want error %v", tt.provider, err, tt.wantErr)
+
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("resolveIPProvider(%s) = %s, want %s", tt.provider, got, tt.want)
+		}
+	}
+}
+
+func TestIPProviderPresetConfig(t *testing.T) {
+	cfg := loadTestConfig(t, map[string]string{"DDNS_IP_PROVIDER": "icanhazip"})
+	if cfg.CheckIPURL != "https://icanhazip.com/" {
+		t.Errorf("CheckIPURL = %s, want the icanhazip preset", cfg.CheckIPURL)
+	}
+
+	cfg = loadTestConfig(t, map[string]string{"DDNS_CHECKIP_URLS": "ipify, https://ip.example.com/"})
+	if len(cfg.CheckIPURLs) != 2 || cfg.CheckIPURLs[0] != "https://api.ipify.org/" || cfg.CheckIPURLs[1] != "https://ip.example.com/" {
+		t.Errorf("CheckIPURLs = %v, want the ipify preset and the custom URL", cfg.CheckIPURLs)
+	}
+
+	t.Setenv("DDNS_IP_PROVIDER", "nope")
+
+	if _, err := LoadConfig(nil); err == nil {
+		t.Errorf("LoadConfig accepted an unknown preset")
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	p := newMemProvider()
+	id := p.Add("example.com", "A", "home", "8.8.4.4")
+
+	_, url := newTestIP(t, "8.8.8.8")
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_RECONCILE_INTERVAL": "1h"}, p)
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := d.Snapshot().LastReconcile; !got.IsZero() {
+		t.Errorf("last reconcile = %s before any reconcile, want zero", got)
+	}
+
+	// the record drifted in the provider console
+	p.mu.Lock()
+	p.records["example.com"][0].Data = "8.8.4.4"
+	p.mu.Unlock()
+
+	now := time.Now()
+	d.reconcile(d.ctx, now)
+
+	if got := d.Snapshot().LastReconcile; !got.Equal(now) {
+		t.Errorf("last reconcile = %s, want %s", got, now)
+	}
+
+	if got := p.Data("example.com", id); got != "8.8.8.8" {
+		t.Errorf("record data = %s after reconciling, want 8.8.8.8", got)
+	}
+}
+
+// overlapProvider is a memProvider tracking how many updates run at once.
+type overlapProvider struct {
+	*memProvider
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (p *overlapProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	for {
+		peak := p.maxInFlight.Load()
+		if n <= peak || p.maxInFlight.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+
+	return p.memProvider.UpdateRecord(ctx, domain, id, data, ttl)
+}
+
+func TestSlowCycleDoesNotOverlap(t *testing.T) {
+	p := &overlapProvider{memProvider: newMemProvider()}
+	p.updateDelay = 50 * time.Millisecond
+	p.Add("example.com", "A", "home", "8.8.4.4")
+
+	ip, url := newTestIP(t, "8.8.8.8")
+
+	// every cycle takes longer than the interval
+	d := newTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_INTERVAL": "20ms", "DDNS_MIN_INTERVAL": "10ms"}, p)
+
+	go func() { _ = d.Run() }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_ = d.Shutdown(ctx)
+	})
+
+	for i := 1; i <= 5; i++ {
+		ip.Set(fmt.Sprintf("8.8.8.%d", i))
+
+		// forced checks and overrides arrive while a slow cycle runs
+		select {
+		case d.force <- struct{}{}:
+		default:
+		}
+
+		override := ipOverride{ip: net.ParseIP(fmt.Sprintf("1.1.1.%d", i)), result: make(chan overrideResult, 1)}
+		d.overrides <- override
+
+		if result := <-override.result; result.err != nil {
+			t.Fatalf("override: %v", result.err)
+		}
+	}
+
+	if got := p.Calls("UpdateRecord"); got < 5 {
+		t.Errorf("UpdateRecord calls = %d, want at least one per override", got)
+	}
+
+	if got := p.maxInFlight.Load(); got != 1 {
+		t.Errorf("%d updates ran at once, want cycles and overrides one at a time", got)
+	}
+}
+
+// emptyProvider is a memProvider answering lookups of missing records with
+// no records instead of ErrRecordNotFound.
+type emptyProvider struct {
+	*memProvider
+}
+
+func (p emptyProvider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	found, err := p.memProvider.FindRecords(ctx, domain, recType, name)
+	if errors.Is(err, ErrRecordNotFound) {
+		return []Record{}, nil
+	}
+
+	return found, err
+}
+
+func TestCreateMissingEmptyLookup(t *testing.T) {
+	p := newMemProvider()
+
+	_, url := newTestIP(t, "8.8.8.8")
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_CREATE_MISSING": "true"}, emptyProvider{p})
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := p.Calls("CreateRecord"); got != 1 {
+		t.Fatalf("CreateRecord calls = %d, want 1", got)
+	}
+
+	if got := p.Data("example.com", "1"); got != "8.8.8.8" {
+		t.Errorf("created record holds %q, want 8.8.8.8", got)
+	}
+}
+
+func TestIPv6Optional(t *testing.T) {
+	for _, optional := range []bool{false, true} {
+		t.Run(fmt.Sprintf("optional=%t", optional), func(t *testing.T) {
+			logs := captureLogs(t)
+
+			p := newMemProvider()
+			a := p.Add("example.com", "A", "home", "8.8.4.4")
+			aaaa := p.Add("example.com", "AAAA", "home", "2001:4860::8844")
+
+			// the provider only listens on IPv4, so every AAAA check fails
+			_, url := newTestIP(t, "8.8.8.8")
+			d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_RECORD_TYPES": "A,AAAA", "DDNS_CHECKIP_RETRIES": "0", "DDNS_IPV6_OPTIONAL": fmt.Sprint(optional)}, p)
+
+			err := runTestCycle(d)
+			if optional && err != nil {
+				t.Errorf("cycle failed without IPv6: %v", err)
+			}
+
+			if !optional && err == nil {
+				t.Errorf("cycle without IPv6 succeeded, want the AAAA check to fail it")
+			}
+
+			if got := p.Data("example.com", a); got != "8.8.8.8" {
+				t.Errorf("A record holds %s, want 8.8.8.8", got)
+			}
+
+			if got := p.Data("example.com", aaaa); got != "2001:4860::8844" {
+				t.Errorf("AAAA record holds %s, want it left as is", got)
+			}
+
+			want := 0
+			if optional {
+				want = 1
+			}
+
+			if got := logs.Count("IPv6 unavailable this cycle"); got != want {
+				t.Errorf("logged IPv6 unavailable %d times, want %d", got, want)
+			}
+		})
+	}
+}
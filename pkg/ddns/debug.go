@@ -0,0 +1,15 @@
+//go:build debugcharts
+// +build debugcharts
+
+package ddns
+
+import (
+	"net/http"
+
+	_ "github.com/mkevac/debugcharts"
+)
+
+func init() {
+	// debugcharts only registers its pages on the default mux
+	debugCharts = http.DefaultServeMux
+}
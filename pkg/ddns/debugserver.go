@@ -0,0 +1,42 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// DefaultDebugAddr is where the debug server listens unless DDNS_DEBUG_ADDR
+// is set.
+const DefaultDebugAddr = "localhost:6060"
+
+// debugCharts serves /debug/charts/, only set in builds with the debugcharts
+// tag.
+var debugCharts http.Handler
+
+// ServeDebug runs the debug server on ln: the pprof handlers, the api rate
+// limit state when reporter is set, and the debugcharts pages when built in.
+// Handlers are registered on their own mux, so nothing added to the default
+// mux is exposed. It only returns on error.
+func ServeDebug(ln net.Listener, reporter RateReporter) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	if reporter != nil {
+		mux.HandleFunc("/debug/ratelimit", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(reporter.RateLimit())
+		})
+	}
+
+	if debugCharts != nil {
+		mux.Handle("/debug/charts/", debugCharts)
+	}
+
+	return http.Serve(ln, mux)
+}
@@ -0,0 +1,491 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/godo"
+	"golang.org/x/oauth2"
+)
+
+// domainsService is the part of godo.DomainsService the provider uses, so a
+// fake can stand in for the DO api.
+type domainsService interface {
+	Records(ctx context.Context, domain string, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)
+	RecordsByTypeAndName(ctx context.Context, domain, recType, name string, opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)
+	Record(ctx context.Context, domain string, id int) (*godo.DomainRecord, *godo.Response, error)
+	EditRecord(ctx context.Context, domain string, id int, editRequest *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error)
+	CreateRecord(ctx context.Context, domain string, createRequest *godo.DomainRecordEditRequest) (*godo.DomainRecord, *godo.Response, error)
+	DeleteRecord(ctx context.Context, domain string, id int) (*godo.Response, error)
+}
+
+// DOPageSize is the number of records requested per page of a DO listing, the
+// api maximum.
+const DOPageSize = 200
+
+// digitalOceanProvider manages records through the DigitalOcean API.
+type digitalOceanProvider struct {
+	// account checks and rate limit state
+	client *godo.Client
+	// record calls, client.Domains unless a fake is injected
+	domains domainsService
+	// id: last record seen, so edits can carry every field forward
+	records map[int]godo.DomainRecord
+	// guards records, concurrent workers share the provider
+	mu sync.Mutex
+	// retries for api calls failing with a transient error
+	maxRetries int
+}
+
+func newDigitalOceanProvider(token, userAgent string, base *http.Client, apiURL *url.URL, maxRetries int) (*digitalOceanProvider, error) {
+	// mirrors godo.NewFromToken, but on top of base for its timeout and proxy
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: strings.Trim(strings.TrimSpace(token), "'")})
+	httpClient := oauth2.NewClient(context.WithValue(context.Background(), oauth2.HTTPClient, base), ts)
+	httpClient.Timeout = base.Timeout
+
+	// godo keeps its own user agent after ours, e.g. "do-dynamic-dns-server/dev godo/1.92.0"
+	client, err := godo.New(httpClient, godo.SetUserAgent(userAgent))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create DO client: %w", err)
+	}
+
+	if apiURL != nil {
+		client.BaseURL = apiURL
+	}
+
+	return &digitalOceanProvider{
+		client:     client,
+		domains:    client.Domains,
+		records:    map[int]godo.DomainRecord{},
+		maxRetries: maxRetries,
+	}, nil
+}
+
+func (p *digitalOceanProvider) Validate(ctx context.Context) error {
+	err := p.retry(ctx, "validating token", func() error {
+		_, _, err := p.client.Account.Get(ctx)
+
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+
+	var errResp *godo.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+
+	status := errResp.Response.StatusCode
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return err
+}
+
+func (p *digitalOceanProvider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	if name == "" {
+		name = "@"
+	}
+
+	records, err := p.listPages(ctx, domain, "listing records", func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+		return p.domains.RecordsByTypeAndName(ctx, domain, recType, fqdn(domain, name), opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	matched := matchRecords(records, recType, name)
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("%w: no matching %s record for domain=%s name=%s", ErrRecordNotFound, recType, domain, name)
+	}
+
+	found := make([]Record, 0, len(matched))
+	for _, r := range matched {
+		found = append(found, p.remember(r))
+	}
+
+	return found, nil
+}
+
+// ListRecords returns every record of domain, fetched page by page.
+func (p *digitalOceanProvider) ListRecords(ctx context.Context, domain string) ([]Record, error) {
+	records, err := p.listPages(ctx, domain, "listing zone", func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error) {
+		return p.domains.Records(ctx, domain, opt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	found := make([]Record, 0, len(records))
+	for _, r := range records {
+		found = append(found, p.remember(r))
+	}
+
+	return found, nil
+}
+
+// listPages calls list for every page of a listing of domain and returns the
+// records of all pages.
+func (p *digitalOceanProvider) listPages(ctx context.Context, domain, op string, list func(opt *godo.ListOptions) ([]godo.DomainRecord, *godo.Response, error)) ([]godo.DomainRecord, error) {
+	all := []godo.DomainRecord{}
+
+	for page := 1; ; page++ {
+		var records []godo.DomainRecord
+
+		var resp *godo.Response
+
+		err := p.retry(ctx, op, func() (err error) {
+			records, resp, err = list(&godo.ListOptions{Page: page, PerPage: DOPageSize})
+
+			return err
+		})
+		// listing the records of a domain the account doesn't hold is a 404
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: domain %s is not managed by this DigitalOcean account", ErrZoneNotFound, domain)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// guard against SDK edge cases and mocks that return no response
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+
+		all = append(all, records...)
+
+		if resp == nil || resp.Links == nil || resp.Links.IsLastPage() {
+			return all, nil
+		}
+	}
+}
+
+// matchRecords returns the records of type recType with exactly the relative
+// name, ordered by ID so the first one is picked deterministically.
+func matchRecords(records []godo.DomainRecord, recType, name string) []godo.DomainRecord {
+	matched := []godo.DomainRecord{}
+
+	for _, r := range records {
+		if r.Type == recType && r.Name == name {
+			matched = append(matched, r)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+
+	return matched
+}
+
+func (p *digitalOceanProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	recordID, err := strconv.Atoi(id)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid DO record id %q: %w", id, err)
+	}
+
+	current, ok := p.cached(recordID)
+	if !ok {
+		err := p.retry(ctx, "fetching record", func() error {
+			r, _, err := p.domains.Record(ctx, domain, recordID)
+			if err == nil {
+				current = *r
+			}
+
+			return err
+		})
+		if err != nil {
+			return Record{}, p.wrapError(err)
+		}
+	}
+
+	request := editRequest(current, data)
+	if ttl > 0 {
+		request.TTL = ttl
+	}
+
+	var r *godo.DomainRecord
+
+	var resp *godo.Response
+
+	err = p.retry(ctx, "editing record", func() (err error) {
+		r, resp, err = p.domains.EditRecord(ctx, domain, recordID, request)
+
+		return err
+	})
+	if err != nil {
+		return Record{}, p.wrapError(err)
+	}
+
+	if resp == nil || resp.Body == nil || r == nil {
+		return Record{}, fmt.Errorf("empty response from DO api while updating domain=%s name=%s", domain, current.Name)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAPIBodySize))
+	if err != nil {
+		return Record{}, fmt.Errorf("error while reading response body: \"%v\"", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return Record{}, fmt.Errorf("error from DO api (%d) body: \"%s\"", resp.StatusCode, body)
+	}
+
+	if r.ID != recordID {
+		p.forget(recordID)
+	}
+
+	return p.remember(*r), nil
+}
+
+func (p *digitalOceanProvider) CreateRecord(ctx context.Context, domain string, record Record) (Record, error) {
+	request := &godo.DomainRecordEditRequest{
+		Type: record.Type,
+		Name: record.Name,
+		Data: record.Data,
+		TTL:  record.TTL,
+	}
+
+	// recreating a deleted record keeps the fields it had
+	if recordID, err := strconv.Atoi(record.ID); err == nil {
+		if previous, ok := p.cached(recordID); ok {
+			request = editRequest(previous, record.Data)
+
+			p.forget(recordID)
+		}
+	}
+
+	var r *godo.DomainRecord
+
+	err := p.retry(ctx, "creating record", func() (err error) {
+		r, _, err = p.domains.CreateRecord(ctx, domain, request)
+
+		return err
+	})
+	if err != nil {
+		return Record{}, p.wrapError(err)
+	}
+
+	if r == nil {
+		return Record{}, fmt.Errorf("empty response from DO api while creating domain=%s name=%s", domain, record.Name)
+	}
+
+	return p.remember(*r), nil
+}
+
+func (p *digitalOceanProvider) DeleteRecord(ctx context.Context, domain, id string) error {
+	recordID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid DO record id %q: %w", id, err)
+	}
+
+	_, err = p.domains.DeleteRecord(ctx, domain, recordID)
+	if err != nil {
+		return p.wrapError(err)
+	}
+
+	p.forget(recordID)
+
+	return nil
+}
+
+// retry calls fn until it succeeds, fails with an error a retry won't fix, or
+// maxRetries retries were made. Retries back off exponentially from
+// DefaultAPIRetryBackoff, with up to 50% jitter so instances don't retry in
+// lockstep.
+func (p *digitalOceanProvider) retry(ctx context.Context, op string, fn func() error) error {
+	backoff := DefaultAPIRetryBackoff
+
+	for attempt := 1; ; attempt++ {
+		if err := p.waitForRate(ctx); err != nil {
+			return err
+		}
+
+		err := fn()
+		if err == nil || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+
+		if attempt > p.maxRetries {
+			if p.maxRetries > 0 {
+				return fmt.Errorf("%s failed after %d retries: %w", op, p.maxRetries, err)
+			}
+
+			return err
+		}
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+
+		// a hard rate limit says exactly how long to stay away
+		if retryAfter, ok := retryAfter(err); ok {
+			wait = retryAfter
+		}
+
+		slog.Warn("api call failed, retrying", "op", op, "wait", wait.Round(time.Millisecond), "attempt", attempt, "retries", p.maxRetries, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+	}
+}
+
+// waitForRate sleeps until the rate limit resets when the last response
+// reported fewer than DORateLimitReserve requests remaining.
+func (p *digitalOceanProvider) waitForRate(ctx context.Context) error {
+	rate := p.client.GetRate()
+	if rate.Limit == 0 || rate.Remaining > DORateLimitReserve {
+		return nil
+	}
+
+	wait := time.Until(rate.Reset.Time)
+	if wait <= 0 {
+		return nil
+	}
+
+	slog.Warn("DO api rate limit nearly exhausted, waiting until it resets", "remaining", rate.Remaining, "limit", rate.Limit, "wait", wait.Round(time.Second))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// retryAfter returns the Retry-After duration of a 429 response from the DO api.
+func retryAfter(err error) (time.Duration, bool) {
+	var errResp *godo.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil || errResp.Response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	seconds, convErr := strconv.Atoi(errResp.Response.Header.Get("Retry-After"))
+	if convErr != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// RateLimit returns the rate limit state reported by the last DO api response.
+func (p *digitalOceanProvider) RateLimit() RateLimit {
+	rate := p.client.GetRate()
+
+	return RateLimit{Limit: rate.Limit, Remaining: rate.Remaining, Reset: rate.Reset.Time}
+}
+
+// isRetryable reports whether err from the DO api may be transient: network
+// errors, rate limiting and 5xx responses. Other 4xx responses such as 401 or
+// 403 fail the same way on every attempt.
+func isRetryable(err error) bool {
+	var errResp *godo.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return true
+	}
+
+	status := errResp.Response.StatusCode
+
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// remember caches r for later edits and converts it to a Record.
+func (p *digitalOceanProvider) remember(r godo.DomainRecord) Record {
+	p.mu.Lock()
+	p.records[r.ID] = r
+	p.mu.Unlock()
+
+	return Record{
+		ID:   strconv.Itoa(r.ID),
+		Type: r.Type,
+		Name: r.Name,
+		Data: r.Data,
+		TTL:  r.TTL,
+	}
+}
+
+// cached returns the last record seen with id.
+func (p *digitalOceanProvider) cached(id int) (godo.DomainRecord, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.records[id]
+
+	return r, ok
+}
+
+// forget drops the cached record with id.
+func (p *digitalOceanProvider) forget(id int) {
+	p.mu.Lock()
+	delete(p.records, id)
+	p.mu.Unlock()
+}
+
+// wrapError maps DO api errors onto the provider-neutral sentinels.
+func (p *digitalOceanProvider) wrapError(err error) error {
+	if isZoneLocked(err) {
+		return fmt.Errorf("%w: %v", ErrZoneLocked, err)
+	}
+
+	if isNotFound(err) {
+		return fmt.Errorf("%w: %v", ErrRecordNotFound, err)
+	}
+
+	return err
+}
+
+// isZoneLocked reports whether err from the DO api indicates the zone is locked,
+// e.g. while it is being transferred.
+func isZoneLocked(err error) bool {
+	var errResp *godo.ErrorResponse
+	if !errors.As(err, &errResp) {
+		return false
+	}
+
+	if errResp.Response != nil && errResp.Response.StatusCode == http.StatusLocked {
+		return true
+	}
+
+	message := strings.ToLower(errResp.Message)
+
+	return strings.Contains(message, "locked") || strings.Contains(message, "transfer")
+}
+
+// isNotFound reports whether err from the DO api is a 404.
+func isNotFound(err error) bool {
+	var errResp *godo.ErrorResponse
+
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// editRequest builds an edit that changes only the data of record, carrying
+// every other field forward so a full replace can't clear TTL, priority, etc.
+func editRequest(record godo.DomainRecord, data string) *godo.DomainRecordEditRequest {
+	return &godo.DomainRecordEditRequest{
+		Type:     record.Type,
+		Name:     record.Name,
+		Data:     data,
+		Priority: record.Priority,
+		Port:     record.Port,
+		TTL:      record.TTL,
+		Weight:   record.Weight,
+		Flags:    record.Flags,
+		Tag:      record.Tag,
+	}
+}
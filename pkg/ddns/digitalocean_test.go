@@ -0,0 +1,269 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+func TestFindRecordsPaged(t *testing.T) {
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.8.8"},
+		godo.DomainRecord{ID: 2, Type: "A", Name: "other", Data: "8.8.8.8"},
+		godo.DomainRecord{ID: 3, Type: "A", Name: "home", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 4, Type: "AAAA", Name: "home", Data: "2001:4860::8888"},
+		godo.DomainRecord{ID: 5, Type: "A", Name: "home", Data: "1.1.1.1"},
+	)
+	domains.pageSize = 1
+
+	p := newTestDO(domains)
+
+	found, err := p.FindRecords(context.Background(), "example.com", "A", "home")
+	if err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	ids := []string{}
+	for _, r := range found {
+		ids = append(ids, r.ID)
+	}
+
+	if got := strings.Join(ids, ","); got != "1,3,5" {
+		t.Errorf("found records %s, want 1,3,5 from all pages", got)
+	}
+
+	if got := domains.Calls("RecordsByTypeAndName"); got != 3 {
+		t.Errorf("RecordsByTypeAndName calls = %d, want one per page, 3", got)
+	}
+}
+
+func TestListRecordsPaged(t *testing.T) {
+	records := []godo.DomainRecord{}
+	for id := 1; id <= 5; id++ {
+		records = append(records, godo.DomainRecord{ID: id, Type: "A", Name: "host", Data: "8.8.8.8"})
+	}
+
+	domains := newFakeDomains(records...)
+	domains.pageSize = 2
+
+	found, err := newTestDO(domains).ListRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("ListRecords: %v", err)
+	}
+
+	if len(found) != 5 {
+		t.Errorf("listed %d records, want 5", len(found))
+	}
+
+	if got := domains.Calls("Records"); got != 3 {
+		t.Errorf("Records calls = %d, want 3 pages", got)
+	}
+}
+
+func TestFindRecordsMixedTypes(t *testing.T) {
+	// the api returns them in any order, with other types at the same name
+	domains := newFakeDomains(
+		godo.DomainRecord{ID: 9, Type: "A", Name: "home", Data: "8.8.8.8"},
+		godo.DomainRecord{ID: 2, Type: "TXT", Name: "home", Data: "v=spf1 -all"},
+		godo.DomainRecord{ID: 3, Type: "AAAA", Name: "home", Data: "2001:4860::8888"},
+		godo.DomainRecord{ID: 7, Type: "A", Name: "home", Data: "8.8.4.4"},
+		godo.DomainRecord{ID: 1, Type: "A", Name: "www", Data: "8.8.8.8"},
+	)
+
+	found, err := newTestDO(domains).FindRecords(context.Background(), "example.com", "A", "home")
+	if err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	if len(found) != 2 || found[0].ID != "7" || found[1].ID != "9" {
+		t.Fatalf("found %+v, want the A records 7 and 9 in that order", found)
+	}
+
+	for _, r := range found {
+		if r.Type != "A" || r.Name != "home" {
+			t.Errorf("found %s record %s, want only A records of home", r.Type, r.Name)
+		}
+	}
+}
+
+func TestFindRecordsApex(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "@", Data: "8.8.8.8"})
+
+	found, err := newTestDO(domains).FindRecords(context.Background(), "example.com", "A", "")
+	if err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	if len(found) != 1 || found[0].Name != "@" {
+		t.Errorf("found %+v, want the apex record", found)
+	}
+}
+
+func TestFindRecordsNotFound(t *testing.T) {
+	_, err := newTestDO(newFakeDomains()).FindRecords(context.Background(), "example.com", "A", "home")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("FindRecords error = %v, want ErrRecordNotFound", err)
+	}
+
+	domains := newFakeDomains()
+	domains.errs["RecordsByTypeAndName"] = apiError(http.StatusNotFound, "The resource you were accessing could not be found.")
+
+	_, err = newTestDO(domains).FindRecords(context.Background(), "example.com", "A", "home")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("FindRecords error = %v, want ErrZoneNotFound", err)
+	}
+}
+
+func TestNilResponse(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+	domains.nilResponse = true
+
+	p := newTestDO(domains)
+
+	found, err := p.FindRecords(context.Background(), "example.com", "A", "home")
+	if err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	if len(found) != 1 {
+		t.Fatalf("found %d records, want 1", len(found))
+	}
+
+	_, err = p.UpdateRecord(context.Background(), "example.com", found[0].ID, "8.8.8.8", 0)
+	if err == nil || !strings.Contains(err.Error(), "empty response") {
+		t.Errorf("UpdateRecord error = %v, want an empty response error", err)
+	}
+}
+
+func TestUpdateRecordPreservesFields(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4", TTL: 1800})
+	p := newTestDO(domains)
+
+	if _, err := p.FindRecords(context.Background(), "example.com", "A", "home"); err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	r, err := p.UpdateRecord(context.Background(), "example.com", "1", "8.8.8.8", 0)
+	if err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+
+	if len(domains.edits) != 1 {
+		t.Fatalf("made %d edits, want 1", len(domains.edits))
+	}
+
+	edit := domains.edits[0]
+	if edit.Type != "A" || edit.Name != "home" || edit.TTL != 1800 || edit.Data != "8.8.8.8" {
+		t.Errorf("edit request %+v, want type, name and ttl carried forward", edit)
+	}
+
+	if r.TTL != 1800 {
+		t.Errorf("updated ttl = %d, want 1800", r.TTL)
+	}
+}
+
+func TestUpdateRecordUncached(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4", TTL: 1800})
+
+	// a record not seen in a listing yet is fetched before the edit
+	if _, err := newTestDO(domains).UpdateRecord(context.Background(), "example.com", "1", "8.8.8.8", 0); err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+
+	if got := domains.Calls("Record"); got != 1 {
+		t.Errorf("Record calls = %d, want 1", got)
+	}
+
+	if len(domains.edits) != 1 || domains.edits[0].TTL != 1800 {
+		t.Errorf("edit requests %+v, want the fetched ttl carried forward", domains.edits)
+	}
+}
+
+func TestUpdateRecordNewID(t *testing.T) {
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+	domains.editHook = func(r *godo.DomainRecord) { r.ID = 42 }
+
+	p := newTestDO(domains)
+
+	if _, err := p.FindRecords(context.Background(), "example.com", "A", "home"); err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	r, err := p.UpdateRecord(context.Background(), "example.com", "1", "8.8.8.8", 0)
+	if err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+
+	if r.ID != "42" {
+		t.Errorf("updated record id = %s, want 42", r.ID)
+	}
+
+	if _, ok := p.cached(1); ok {
+		t.Errorf("the replaced record 1 is still cached")
+	}
+
+	if _, ok := p.cached(42); !ok {
+		t.Errorf("the new record 42 isn't cached")
+	}
+}
+
+func TestUpdateRecordErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "locked", err: apiError(http.StatusLocked, "locked"), want: ErrZoneLocked},
+		{name: "in transfer", err: apiError(http.StatusUnprocessableEntity, "Domain is currently being transferred"), want: ErrZoneLocked},
+		{name: "deleted", err: apiError(http.StatusNotFound, "The resource you were accessing could not be found."), want: ErrRecordNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+			domains.errs["EditRecord"] = tt.err
+
+			_, err := newTestDO(domains).UpdateRecord(context.Background(), "example.com", "1", "8.8.8.8", 0)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("UpdateRecord error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDOTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	apiURL, err := url.Parse(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newDigitalOceanProvider("token", "test", newHTTPClient(50*time.Millisecond, nil), apiURL, 0)
+	if err != nil {
+		t.Fatalf("newDigitalOceanProvider: %v", err)
+	}
+
+	start := time.Now()
+
+	if _, err := p.FindRecords(context.Background(), "example.com", "A", "home"); err == nil {
+		t.Fatalf("FindRecords against a hung api succeeded")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("FindRecords returned after %s, want it bounded by the 50ms timeout", elapsed)
+	}
+}
@@ -0,0 +1,50 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// IPSourceDNS reads the public IP from an OpenDNS lookup.
+	IPSourceDNS = "dns"
+
+	// OpenDNSHostname resolves to the address a query came from when asked at
+	// an OpenDNS resolver.
+	OpenDNSHostname = "myip.opendns.com"
+	// OpenDNSResolver4 and OpenDNSResolver6 are resolver1.opendns.com, queried
+	// over the family of the record type so each sees that family's address.
+	OpenDNSResolver4 = "208.67.222.222:53"
+	OpenDNSResolver6 = "[2620:119:35::35]:53"
+)
+
+// dnsIP looks up the public address for recType at an OpenDNS resolver within
+// timeout.
+func dnsIP(ctx context.Context, recType string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	network, server := "ip4", OpenDNSResolver4
+	if recType == "AAAA" {
+		network, server = "ip6", OpenDNSResolver6
+	}
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		// every query goes to the OpenDNS resolver instead of the system one
+		Dial: func(ctx context.Context, proto, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, proto, server)
+		},
+	}
+
+	ips, err := resolver.LookupIP(ctx, network, OpenDNSHostname)
+	if err != nil {
+		return "", fmt.Errorf("error while resolving %s at %s: %v", OpenDNSHostname, server, err)
+	}
+
+	return ips[0].String(), nil
+}
@@ -0,0 +1,88 @@
+package ddns
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+)
+
+// dryRunProvider wraps a Provider, passing reads through and logging the
+// writes it would make instead of making them.
+type dryRunProvider struct {
+	Provider
+	// id: last record seen, so writes can be logged with their old data
+	records map[string]Record
+	// source of ids for records that would be created
+	created int
+	// guards records and created, concurrent workers share the provider
+	mu sync.Mutex
+}
+
+func newDryRunProvider(provider Provider) *dryRunProvider {
+	return &dryRunProvider{Provider: provider, records: map[string]Record{}}
+}
+
+func (p *dryRunProvider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	records, err := p.Provider.FindRecords(ctx, domain, recType, name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, record := range records {
+		p.records[record.ID] = record
+	}
+
+	return records, err
+}
+
+func (p *dryRunProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	record := p.records[id]
+
+	slog.Info("dry run: would edit record", "domain", domain, "record_id", id, "name", record.Name, "old_ip", record.Data, "new_ip", data, "ttl", ttl)
+
+	record.ID = id
+	record.Data = data
+	if ttl > 0 {
+		record.TTL = ttl
+	}
+
+	p.records[id] = record
+
+	return record, nil
+}
+
+func (p *dryRunProvider) CreateRecord(ctx context.Context, domain string, record Record) (Record, error) {
+	slog.Info("dry run: would create record", "domain", domain, "type", record.Type, "name", record.Name, "new_ip", record.Data, "ttl", record.TTL)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.created++
+	record.ID = "dry-run-" + strconv.Itoa(p.created)
+	p.records[record.ID] = record
+
+	return record, nil
+}
+
+func (p *dryRunProvider) DeleteRecord(ctx context.Context, domain, id string) error {
+	slog.Info("dry run: would delete record", "domain", domain, "record_id", id)
+
+	p.mu.Lock()
+	delete(p.records, id)
+	p.mu.Unlock()
+
+	return nil
+}
+
+// RateLimit passes through the rate limit of the wrapped provider, if any.
+func (p *dryRunProvider) RateLimit() RateLimit {
+	if reporter, ok := p.Provider.(RateReporter); ok {
+		return reporter.RateLimit()
+	}
+
+	return RateLimit{}
+}
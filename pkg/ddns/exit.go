@@ -0,0 +1,53 @@
+package ddns
+
+import "errors"
+
+// Exit codes of the command, by failure class, so a supervisor can tell a
+// failure worth retrying from one that needs an operator.
+const (
+	// ExitOK is a clean shutdown, or a one-shot check that succeeded.
+	ExitOK = 0
+	// ExitFailure is any failure without a code of its own.
+	ExitFailure = 1
+	// ExitConfig is a config that doesn't load or validate, or names domains
+	// or records the provider doesn't have. Retrying doesn't help.
+	ExitConfig = 2
+	// ExitAuth is a provider that rejected its api token.
+	ExitAuth = 3
+	// ExitUnreachable is a provider api that couldn't be reached at startup.
+	// Retrying later may help.
+	ExitUnreachable = 4
+	// ExitCheckFailed is a one-shot check that failed to detect the ip or to
+	// write some of the records.
+	ExitCheckFailed = 5
+	// ExitShutdownTimeout is a check that didn't finish its writes within
+	// DDNS_SHUTDOWN_TIMEOUT on shutdown.
+	ExitShutdownTimeout = 6
+	// ExitUnhealthy is the watchdog finding the run loop stuck, or cycles
+	// that keep panicking, so a supervisor restarts the process.
+	ExitUnhealthy = 7
+)
+
+// ErrCheckFailed is returned by RunOnce, wrapping the errors of the check,
+// when the check failed.
+var ErrCheckFailed = errors.New("check failed")
+
+// ExitCode returns the exit code for err, an error returned by Run or
+// RunOnce: ExitOK for nil and ExitFailure when it has no class of its own.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	// the errors of a failed check may wrap any of the others
+	case errors.Is(err, ErrCheckFailed):
+		return ExitCheckFailed
+	case errors.Is(err, ErrInvalidToken):
+		return ExitAuth
+	case errors.Is(err, ErrUnreachable):
+		return ExitUnreachable
+	case errors.Is(err, ErrZoneNotFound), errors.Is(err, ErrRecordNotFound):
+		return ExitConfig
+	default:
+		return ExitFailure
+	}
+}
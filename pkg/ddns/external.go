@@ -0,0 +1,169 @@
+package ddns
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// IPSourceExternal never detects the IP: it is pushed with POST /set-ip
+	// or written to DDNS_IP_FILE, and checks re-assert the last one.
+	IPSourceExternal = "external"
+	// IPSourceNone is accepted as an alias of IPSourceExternal.
+	IPSourceNone = "none"
+	// IPSourceFile reads the IP from DDNS_IP_FILE, written by another tool,
+	// e.g. a PPP up-script, and checks as soon as it changes.
+	IPSourceFile = "file"
+)
+
+// ipFilePoll is how often DDNS_IP_FILE is looked at for changes. A stat is
+// cheap enough to pick up a new address about as soon as it is written.
+const ipFilePoll = 1 * time.Second
+
+// readIPFile reads the addresses in path, one per line and at most one per
+// record type. Blank lines and lines starting with # are skipped.
+func readIPFile(path string) (map[string]net.IP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ips := map[string]net.IP{}
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ip := net.ParseIP(line)
+		if ip == nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, line)
+		}
+
+		recType := overrideType(ip)
+		if _, ok := ips[recType]; ok {
+			return nil, fmt.Errorf("line %d: a second address for %s records", n, recType)
+		}
+
+		ips[recType] = ip
+	}
+
+	return ips, scanner.Err()
+}
+
+// fileIP returns the address for recType in the ip file at path, for
+// IPSourceFile.
+func fileIP(path, recType string) (string, error) {
+	ips, err := readIPFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	ip := ips[recType]
+	if ip == nil {
+		return "", fmt.Errorf("%s has no address for an %s record", path, recType)
+	}
+
+	return ip.String(), nil
+}
+
+// externalIP handles recType in a check with IPSourceExternal: an address
+// written to the ip file since the last check is taken like a detected one,
+// otherwise the last known one is re-asserted on records that drifted from it.
+// Without either, e.g. while the ip file doesn't exist yet, the records are
+// left alone.
+func (d *DDNSUpdater) externalIP(ctx context.Context, recType string, tick time.Time) error {
+	ip := d.currentIPs[recType]
+
+	if d.ipFile != "" {
+		// nothing was written to it yet
+		ips, err := readIPFile(d.ipFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+
+		if err != nil {
+			err = fmt.Errorf("unable to read %s: %w", d.ipFile, err)
+			d.logger.Error("unable to read the ip file", "error", err)
+			d.cycle.addError(err)
+
+			return err
+		}
+
+		pushed := ips[recType]
+		if pushed != nil && !d.allowPrivate {
+			if err := validatePublic(pushed, d.allowReserved); err != nil {
+				d.logger.Error("invalid ip, skipping update", "type", recType, "error", err)
+				d.cycle.addError(err)
+
+				return err
+			}
+		}
+
+		if pushed != nil {
+			ip = pushed
+		}
+	}
+
+	if ip == nil {
+		d.logger.Debug("no ip pushed yet, leaving records alone", "type", recType)
+
+		return nil
+	}
+
+	d.cycle.IPs[recType] = ip.String()
+
+	if !d.currentIPs[recType].Equal(ip) {
+		return d.handleIP(ctx, recType, ip, tick)
+	}
+
+	d.logger.Debug("re-asserting the last pushed ip", "type", recType, "ip", ip.String())
+
+	return d.applyRecords(ctx, recType)
+}
+
+// watchIPFile requests a check whenever the ip file changes, until Shutdown.
+func (d *DDNSUpdater) watchIPFile() {
+	ticker := time.NewTicker(ipFilePoll)
+	defer ticker.Stop()
+
+	var last os.FileInfo
+	if info, err := os.Stat(d.ipFile); err == nil {
+		last = info
+	}
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(d.ipFile)
+		if err != nil || last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+
+		last = info
+
+		// d.logger belongs to the run loop, which reassigns it every cycle
+		slog.Info("ip file changed, checking every domain", "path", d.ipFile)
+
+		// a check that is already pending reads the file too
+		select {
+		case d.force <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ddns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchIPFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip")
+	if err := os.WriteFile(path, []byte("8.8.8.8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestUpdater(t, map[string]string{"DDNS_IP_SOURCE": IPSourceFile, "DDNS_IP_FILE": path}, newMemProvider())
+
+	go d.watchIPFile()
+	defer close(d.stop)
+
+	// once the watcher took note of the file
+	time.Sleep(ipFilePoll / 2)
+
+	if err := os.WriteFile(path, []byte("8.8.4.4\n2001:4860:4860::8888\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// cycles of the run loop go on while the watcher logs the change
+	deadline := time.After(5 * ipFilePoll)
+
+	for {
+		d.startCycle()
+		d.endCycle()
+
+		select {
+		case <-d.force:
+			return
+		case <-deadline:
+			t.Fatal("no check requested after the ip file changed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ddns
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Version is reported by -version and in the api User-Agent. The ddns command
+// sets it from its own version, set at build time with
+// -ldflags "-X main.version=...".
+var Version = "dev"
+
+// ErrVersion is returned by LoadConfig after -version printed the version.
+var ErrVersion = errors.New("version requested")
+
+// configKeys are the settings that can also be given as flags, named like the
+// variable without its DDNS_ prefix, e.g. -do-api-token for DDNS_DO_API_TOKEN.
+var configKeys = []string{
+	"DDNS_ADOPT_EXISTING", "DDNS_ALLOW_PRIVATE_IPS", "DDNS_ALLOW_RESERVED_IPS",
+	"DDNS_ALWAYS_FETCH_BEFORE_UPDATE", "DDNS_API_TOKEN", "DDNS_AUDIT_FILE", "DDNS_AUDIT_MAX_SIZE",
+	"DDNS_BIND_ADDRESS", "DDNS_BLOCKLIST_IPS", "DDNS_BREAKER_INTERVAL", "DDNS_BREAKER_THRESHOLD",
+	"DDNS_CF_API_TOKEN", "DDNS_CHECKIP_FORMAT", "DDNS_CHECKIP_IPV4_FIELD",
+	"DDNS_CHECKIP_IPV6_FIELD", "DDNS_CHECKIP_JSON_FIELD", "DDNS_CHECKIP_MAX_REDIRECTS",
+	"DDNS_CHECKIP_RETRIES", "DDNS_CHECKIP_TIMEOUT", "DDNS_CHECKIP_URLS", "DDNS_CHECK_REACHABILITY",
+	"DDNS_CONCURRENCY", "DDNS_CONFIG_FILE", "DDNS_CONSENSUS_CONCURRENCY", "DDNS_CONSENSUS_TIMEOUT",
+	"DDNS_CREATE_MISSING", "DDNS_CYCLE_RETRIES", "DDNS_DEBUG", "DDNS_DEBUG_ADDR", "DDNS_DOMAINS",
+	"DDNS_DOMAINS_FILE", "DDNS_DO_API_TOKEN", "DDNS_DO_API_TOKEN_FILE", "DDNS_DO_API_URL",
+	"DDNS_DO_TIMEOUT", "DDNS_DRY_RUN", "DDNS_FAILURE_ALERT_THRESHOLD", "DDNS_FORCE_SYNC_INTERVAL",
+	"DDNS_HEALTH_ADDR", "DDNS_HEARTBEAT_INTERVAL", "DDNS_HISTORY_FILE", "DDNS_HISTORY_SIZE",
+	"DDNS_INTERFACE", "DDNS_INTERVAL", "DDNS_INTERVAL_JITTER", "DDNS_IPV6_ADDRESS",
+	"DDNS_IPV6_OPTIONAL", "DDNS_IP_CONSENSUS", "DDNS_IP_FILE", "DDNS_IP_PROVIDER", "DDNS_IP_SOURCE",
+	"DDNS_LAZY_SYNC", "DDNS_LOG_FORMAT", "DDNS_LOG_LEVEL", "DDNS_LOG_ON_CHANGE_ONLY",
+	"DDNS_LOG_TIMEZONE", "DDNS_MANAGE_DATA_PATTERN", "DDNS_MAX_RETRIES", "DDNS_MAX_RUNTIME",
+	"DDNS_METRICS_ADDR", "DDNS_MIN_INTERVAL", "DDNS_MIN_TTL", "DDNS_NOTIFY", "DDNS_NOTIFY_THROTTLE",
+	"DDNS_ONE_SHOT", "DDNS_ON_CHANGE_CMD", "DDNS_ON_CHANGE_TIMEOUT", "DDNS_OUTPUT",
+	"DDNS_PANIC_EXIT_THRESHOLD", "DDNS_PRINT_CONFIG", "DDNS_PROVIDER", "DDNS_PROXY_URL",
+	"DDNS_READ_BEFORE_UPDATE", "DDNS_RECONCILE_INTERVAL", "DDNS_RECORD_TYPES",
+	"DDNS_RECREATE_DELETED", "DDNS_REQUIRE_ALL_DOMAINS", "DDNS_ROLLBACK_ON_PARTIAL",
+	"DDNS_SECRETS_DIR", "DDNS_SHUTDOWN_TIMEOUT", "DDNS_SKIP_OVERDUE", "DDNS_SLOW_CYCLE_WARN",
+	"DDNS_STATE_BACKEND", "DDNS_STATE_FILE", "DDNS_STATSD_ADDR", "DDNS_STATSD_PREFIX",
+	"DDNS_STATSD_TAGS", "DDNS_STATUS_ADDR", "DDNS_STUN_SERVER", "DDNS_TICK_GRANULARITY",
+	"DDNS_TIME_FORMAT", "DDNS_TTL", "DDNS_UPDATE_ALL_RECORDS", "DDNS_USER_AGENT",
+	"DDNS_VERIFY_AFTER_UPDATE", "DDNS_WATCHDOG", "DDNS_WEBHOOK_SECRET", "DDNS_WEBHOOK_TIMEOUT",
+	"DDNS_WEBHOOK_URL", "DDNS_ZONE_LOCK_COOLDOWN",
+}
+
+// boolKeys may be given as a bare flag, e.g. -debug for -debug=true.
+var boolKeys = map[string]bool{
+	"DDNS_ADOPT_EXISTING": true, "DDNS_ALLOW_PRIVATE_IPS": true, "DDNS_ALLOW_RESERVED_IPS": true,
+	"DDNS_ALWAYS_FETCH_BEFORE_UPDATE": true, "DDNS_CHECK_REACHABILITY": true,
+	"DDNS_CREATE_MISSING": true, "DDNS_DEBUG": true, "DDNS_DRY_RUN": true,
+	"DDNS_IPV6_OPTIONAL": true, "DDNS_IP_CONSENSUS": true, "DDNS_LAZY_SYNC": true,
+	"DDNS_LOG_ON_CHANGE_ONLY": true, "DDNS_ONE_SHOT": true, "DDNS_PRINT_CONFIG": true,
+	"DDNS_READ_BEFORE_UPDATE": true, "DDNS_RECREATE_DELETED": true,
+	"DDNS_REQUIRE_ALL_DOMAINS": true, "DDNS_ROLLBACK_ON_PARTIAL": true, "DDNS_SKIP_OVERDUE": true,
+	"DDNS_UPDATE_ALL_RECORDS": true, "DDNS_VERIFY_AFTER_UPDATE": true,
+}
+
+// flagAliases are shorter names for common flags.
+var flagAliases = map[string]string{
+	"once":  "DDNS_ONE_SHOT",
+	"token": "DDNS_DO_API_TOKEN",
+}
+
+// settingFlag collects a setting given on the command line.
+type settingFlag struct {
+	key    string
+	isBool bool
+	values map[string]string
+}
+
+func (f *settingFlag) String() string { return "" }
+
+func (f *settingFlag) Set(value string) error {
+	f.values[f.key] = value
+
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool { return f.isBool }
+
+// flagName returns the flag for the setting key.
+func flagName(key string) string {
+	return strings.ReplaceAll(secretFileName(key), "_", "-")
+}
+
+// parseFlags returns the settings given in args by variable name. It returns
+// flag.ErrHelp after printing the usage for -help and ErrVersion after
+// printing the version for -version.
+func parseFlags(args []string) (map[string]string, error) {
+	values := map[string]string{}
+
+	flags := flag.NewFlagSet("do-dynamic-dns-server", flag.ContinueOnError)
+	showVersion := flags.Bool("version", false, "print the version and exit")
+
+	for _, key := range configKeys {
+		flags.Var(&settingFlag{key: key, isBool: boolKeys[key], values: values}, flagName(key), "overrides "+key)
+	}
+
+	for alias, key := range flagAliases {
+		flags.Var(&settingFlag{key: key, isBool: boolKeys[key], values: values}, alias, "alias of -"+flagName(key))
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	if *showVersion {
+		fmt.Fprintln(os.Stdout, Version)
+
+		return nil, ErrVersion
+	}
+
+	return values, nil
+}
@@ -0,0 +1,97 @@
+package ddns
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HealthcheckTimeout bounds the request of the healthcheck subcommand.
+const HealthcheckTimeout = 3 * time.Second
+
+// ServeHealth runs the health server on addr: /healthz reports whether the
+// last check and its record updates succeeded within two intervals and /readyz whether the initial
+// record sync completed. It only returns on error.
+func (d *DDNSUpdater) ServeHealth(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", d.handleHealthz)
+	mux.HandleFunc("/readyz", d.handleReadyz)
+
+	return http.ListenAndServe(addr, mux)
+}
+
+func (d *DDNSUpdater) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	last := time.Unix(0, d.lastCheckTime.Load())
+
+	switch {
+	case d.lastCheckTime.Load() == 0:
+		http.Error(w, "no ip check completed yet", http.StatusServiceUnavailable)
+	case d.checkFailures.Load() > 0:
+		http.Error(w, fmt.Sprintf("ip check failed %d times in a row, last at %s", d.checkFailures.Load(), last.Format(time.RFC3339)), http.StatusServiceUnavailable)
+	case !d.lastCheckOK.Load():
+		http.Error(w, fmt.Sprintf("last check at %s failed", last.Format(time.RFC3339)), http.StatusServiceUnavailable)
+	case time.Since(last) > 2*time.Duration(d.checkWindow.Load()):
+		http.Error(w, fmt.Sprintf("no ip check since %s", last.Format(time.RFC3339)), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (d *DDNSUpdater) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !d.synced.Load() {
+		http.Error(w, "records not synced yet", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// Healthcheck requests /healthz from the health server at DDNS_HEALTH_ADDR, so
+// a Docker HEALTHCHECK needs no curl in the image, and prints its answer to w.
+// The address is looked up like LoadConfig does, from args, the secrets
+// directory, the environment and the config file. It returns an error unless
+// the server answers 200.
+func Healthcheck(w io.Writer, args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	addr := cfg.HealthAddr
+	if addr == "" {
+		return fmt.Errorf("DDNS_HEALTH_ADDR is required to run the healthcheck")
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("unable to parse DDNS_HEALTH_ADDR: %w", err)
+	}
+
+	// a server listening on every interface is reached over loopback
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+
+	client := &http.Client{Timeout: HealthcheckTimeout}
+
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/healthz")
+	if err != nil {
+		return fmt.Errorf("unable to reach the health server: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unhealthy (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	fmt.Fprint(w, string(body))
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package ddns
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealthcheck(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || !healthy.Load() {
+			http.Error(w, "no ip check completed yet", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	}))
+	t.Cleanup(srv.Close)
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	for key, value := range testEnv {
+		t.Setenv(key, value)
+	}
+
+	// an empty variable would hide the config file
+	t.Setenv("DDNS_HEALTH_ADDR", "")
+	os.Unsetenv("DDNS_HEALTH_ADDR")
+
+	if err := Healthcheck(&bytes.Buffer{}, nil); err == nil {
+		t.Errorf("Healthcheck without DDNS_HEALTH_ADDR succeeded")
+	}
+
+	// the address is only given as a flag
+	var out bytes.Buffer
+	if err := Healthcheck(&out, []string{"-health-addr", addr}); err != nil {
+		t.Fatalf("Healthcheck: %v", err)
+	}
+
+	if out.String() != "ok\n" {
+		t.Errorf("printed %q, want the answer of the health server", out.String())
+	}
+
+	// or in the config file
+	file := filepath.Join(t.TempDir(), "ddns.yaml")
+	if err := os.WriteFile(file, []byte("health_addr: "+addr+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DDNS_CONFIG_FILE", file)
+
+	if err := Healthcheck(&bytes.Buffer{}, nil); err != nil {
+		t.Errorf("Healthcheck with the address in the config file: %v", err)
+	}
+
+	healthy.Store(false)
+
+	if err := Healthcheck(&bytes.Buffer{}, nil); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Healthcheck of an unhealthy server error = %v, want the 503", err)
+	}
+}
@@ -0,0 +1,135 @@
+package ddns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// HistoryEntry is a single detected IP change.
+type HistoryEntry struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	OldIP string    `json:"old_ip"`
+	NewIP string    `json:"new_ip"`
+}
+
+// ipHistory is a ring buffer of the most recent IP changes, optionally
+// persisted to a file so it survives restarts.
+type ipHistory struct {
+	size    int
+	path    string
+	entries []HistoryEntry
+}
+
+// newIPHistory creates a history holding up to size entries and loads any
+// entries previously persisted to path.
+func newIPHistory(size int, path string) (*ipHistory, error) {
+	h := &ipHistory{size: size, path: path}
+
+	if path == "" {
+		return h, nil
+	}
+
+	entries, err := readHistoryFile(path)
+	if err != nil {
+		return h, err
+	}
+
+	for _, entry := range entries {
+		h.push(entry)
+	}
+
+	return h, nil
+}
+
+// Add records an IP change and persists the history when a path is configured.
+func (h *ipHistory) Add(ts time.Time, recType string, oldIP, newIP net.IP) error {
+	if h.size <= 0 {
+		return nil
+	}
+
+	entry := HistoryEntry{Time: ts, Type: recType, NewIP: newIP.String()}
+	if oldIP != nil {
+		entry.OldIP = oldIP.String()
+	}
+
+	h.push(entry)
+
+	if h.path == "" {
+		return nil
+	}
+
+	contents, err := json.Marshal(h.entries)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(h.path, contents, 0o644)
+}
+
+// Entries returns the recorded changes, oldest first.
+func (h *ipHistory) Entries() []HistoryEntry {
+	return append([]HistoryEntry{}, h.entries...)
+}
+
+func (h *ipHistory) push(entry HistoryEntry) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.entries = append(h.entries, entry)
+
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+}
+
+// readHistoryFile reads persisted history. A missing file is an empty history.
+func readHistoryFile(path string) ([]HistoryEntry, error) {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []HistoryEntry
+
+	err = json.Unmarshal(contents, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse history file %s: %w", path, err)
+	}
+
+	return entries, nil
+}
+
+// ExportHistory prints the history persisted to DDNS_HISTORY_FILE as JSON to
+// w. The file is looked up like LoadConfig does, from args, the secrets
+// directory, the environment and the config file.
+func ExportHistory(w io.Writer, args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.HistoryFile == "" {
+		return fmt.Errorf("DDNS_HISTORY_FILE is required to export history")
+	}
+
+	entries, err := readHistoryFile(cfg.HistoryFile)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(entries)
+}
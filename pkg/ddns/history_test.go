@@ -0,0 +1,97 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+
+	h, err := newIPHistory(10, path)
+	if err != nil {
+		t.Fatalf("newIPHistory: %v", err)
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := h.Add(ts, "A", net.ParseIP("8.8.4.4"), net.ParseIP("8.8.8.8")); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	for key, value := range testEnv {
+		t.Setenv(key, value)
+	}
+
+	// the file is only given as a flag
+	var out bytes.Buffer
+	if err := ExportHistory(&out, []string{"-history-file", path}); err != nil {
+		t.Fatalf("ExportHistory: %v", err)
+	}
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("exported history %q isn't JSON: %v", out.String(), err)
+	}
+
+	want := HistoryEntry{Time: ts, Type: "A", OldIP: "8.8.4.4", NewIP: "8.8.8.8"}
+	if len(entries) != 1 || entries[0] != want {
+		t.Errorf("exported %+v, want %+v", entries, want)
+	}
+
+	// or in the secrets directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "history_file"), []byte(path), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DDNS_SECRETS_DIR", dir)
+
+	out.Reset()
+	if err := ExportHistory(&out, nil); err != nil {
+		t.Fatalf("ExportHistory from the secrets directory: %v", err)
+	}
+
+	if out.Len() == 0 {
+		t.Errorf("exported nothing with the file from the secrets directory")
+	}
+
+	t.Setenv("DDNS_SECRETS_DIR", "")
+
+	if err := ExportHistory(&out, nil); err == nil {
+		t.Errorf("ExportHistory without a history file succeeded")
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	p := newMemProvider()
+	p.Add("example.com", "A", "home", "8.8.4.4")
+
+	ip, url := newTestIP(t, "8.8.8.8")
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_HISTORY_SIZE": "2"}, p)
+
+	if got := d.Snapshot().History; len(got) != 0 {
+		t.Errorf("history %+v before the first change, want it empty", got)
+	}
+
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"} {
+		ip.Set(addr)
+
+		if err := runTestCycle(d); err != nil {
+			t.Fatalf("cycle: %v", err)
+		}
+	}
+
+	history := d.Snapshot().History
+	if len(history) != 2 {
+		t.Fatalf("history %+v, want the last 2 changes", history)
+	}
+
+	if history[0].OldIP != "8.8.8.8" || history[0].NewIP != "1.1.1.1" || history[1].NewIP != "9.9.9.9" {
+		t.Errorf("history %+v, want 8.8.8.8 to 1.1.1.1 followed by 9.9.9.9", history)
+	}
+}
@@ -0,0 +1,57 @@
+package ddns
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// changeHook runs a command after every IP change. A nil hook does nothing,
+// so callers don't need to check whether a command is configured.
+type changeHook struct {
+	// program followed by its arguments, the old and new IP are appended
+	args    []string
+	timeout time.Duration
+}
+
+func newChangeHook(command string, timeout time.Duration) *changeHook {
+	return &changeHook{args: strings.Fields(command), timeout: timeout}
+}
+
+// Run runs the command for event and logs its output to logger. The command is
+// killed once the timeout passed, and a failure is only logged.
+func (h *changeHook) Run(ctx context.Context, logger *slog.Logger, event ipChangeEvent) {
+	if h == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	args := append(append([]string{}, h.args[1:]...), event.OldIP, event.NewIP)
+
+	cmd := exec.CommandContext(ctx, h.args[0], args...)
+	cmd.Env = append(os.Environ(),
+		"DDNS_RECORD_TYPE="+event.RecordType,
+		"DDNS_OLD_IP="+event.OldIP,
+		"DDNS_NEW_IP="+event.NewIP,
+		"DDNS_DOMAINS_UPDATED="+strings.Join(event.DomainsUpdated, ","),
+	)
+	// a child keeping the output open must not hold up the loop either
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	logger = logger.With("command", h.args[0], "type", event.RecordType, "output", strings.TrimSpace(string(output)))
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		logger.Warn("on change command timed out", "timeout", h.timeout)
+	case err != nil:
+		logger.Warn("on change command failed", "error", err)
+	default:
+		logger.Info("on change command finished")
+	}
+}
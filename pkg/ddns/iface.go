@@ -0,0 +1,178 @@
+package ddns
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// IPSourceHTTP reads the public IP from the ip providers.
+	IPSourceHTTP = "http"
+	// IPSourceInterface reads it from an address of a local network interface.
+	IPSourceInterface = "interface"
+	// IPSourceAuto tries the interface first and falls back to the ip providers.
+	IPSourceAuto = "auto"
+)
+
+const (
+	// IPv6AddressStable prefers the stable IPv6 address of an interface, an
+	// EUI-64 one first, over its temporary privacy addresses.
+	IPv6AddressStable = "stable"
+	// IPv6AddressPrivacy prefers the current temporary privacy address.
+	IPv6AddressPrivacy = "privacy"
+)
+
+// Address flags of /proc/net/if_inet6, from linux/if_addr.h.
+const (
+	ifaTemporary  = 0x01
+	ifaDADFailed  = 0x08
+	ifaDeprecated = 0x20
+	ifaTentative  = 0x40
+)
+
+// ifInet6Path lists the IPv6 addresses of all interfaces with their flags on
+// Linux.
+const ifInet6Path = "/proc/net/if_inet6"
+
+// ifaceAddr is an address of a network interface. The flags are only known
+// for IPv6 addresses on Linux, elsewhere every address counts as stable.
+type ifaceAddr struct {
+	ip net.IP
+	// a privacy address, rotated by the kernel
+	temporary bool
+	// no longer preferred for new connections, or not yet or never usable
+	// since duplicate address detection is pending or failed
+	deprecated bool
+}
+
+// interfaceIP returns the address of the interface name that fits recType:
+// the first global unicast IPv4 address for A records and for AAAA records the
+// global IPv6 address preferred by mode, IPv6AddressStable or
+// IPv6AddressPrivacy.
+func interfaceIP(name, recType, mode string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("unable to find interface %s: %w", name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("unable to list addresses of interface %s: %w", name, err)
+	}
+
+	// without the flags the addresses are still filtered by their prefix
+	flags, _ := readIfInet6(ifInet6Path, name)
+
+	candidates := make([]ifaceAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		flag := flags[ipNet.IP.String()]
+		candidates = append(candidates, ifaceAddr{
+			ip:         ipNet.IP,
+			temporary:  flag&ifaTemporary != 0,
+			deprecated: flag&(ifaDeprecated|ifaTentative|ifaDADFailed) != 0,
+		})
+	}
+
+	ip := pickInterfaceIP(candidates, recType, mode)
+	if ip == nil {
+		return "", fmt.Errorf("interface %s has no global unicast address for an %s record", name, recType)
+	}
+
+	return ip.String(), nil
+}
+
+// pickInterfaceIP returns the address of addrs for recType, or nil when none
+// fits. IPv6 addresses that are link-local (fe80::/10), unique local
+// (fc00::/7) or deprecated are never picked; of the rest mode decides between
+// a temporary and a stable address, falling back to the other kind, and an
+// EUI-64 address is the most stable. Ties keep the interface order.
+func pickInterfaceIP(addrs []ifaceAddr, recType, mode string) net.IP {
+	var best net.IP
+	bestRank := -1
+
+	for _, addr := range addrs {
+		if !addr.ip.IsGlobalUnicast() {
+			continue
+		}
+
+		if isV4 := addr.ip.To4() != nil; isV4 != (recType == "A") {
+			continue
+		}
+
+		if recType == "A" {
+			return addr.ip
+		}
+
+		if addr.ip.IsPrivate() || addr.deprecated {
+			continue
+		}
+
+		rank := 0
+		if addr.temporary == (mode == IPv6AddressPrivacy) {
+			rank += 2
+		}
+
+		if !addr.temporary && isEUI64(addr.ip) {
+			rank++
+		}
+
+		if rank > bestRank {
+			best, bestRank = addr.ip, rank
+		}
+	}
+
+	return best
+}
+
+// isEUI64 reports whether the interface identifier of ip was derived from a
+// MAC address, with ff:fe in its middle.
+func isEUI64(ip net.IP) bool {
+	ip = ip.To16()
+
+	return ip != nil && ip[11] == 0xff && ip[12] == 0xfe
+}
+
+// readIfInet6 returns the flags of the IPv6 addresses of the interface name
+// listed in path, keyed by address.
+func readIfInet6(path, name string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	flags := map[string]int64{}
+
+	// address, index, prefix length, scope, flags and name per line
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 6 || fields[5] != name {
+			continue
+		}
+
+		raw, err := hex.DecodeString(fields[0])
+		if err != nil || len(raw) != net.IPv6len {
+			continue
+		}
+
+		flag, err := strconv.ParseInt(fields[4], 16, 64)
+		if err != nil {
+			continue
+		}
+
+		flags[net.IP(raw).String()] = flag
+	}
+
+	return flags, scanner.Err()
+}
@@ -0,0 +1,118 @@
+package ddns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPickInterfaceIP(t *testing.T) {
+	var (
+		linkLocal    = ifaceAddr{ip: net.ParseIP("fe80::1")}
+		uniqueLocal  = ifaceAddr{ip: net.ParseIP("fd00::1")}
+		eui64        = ifaceAddr{ip: net.ParseIP("2001:4860:1::211:22ff:fe33:4455")}
+		stable       = ifaceAddr{ip: net.ParseIP("2001:4860:1::1234")}
+		privacy      = ifaceAddr{ip: net.ParseIP("2001:4860:1::abcd"), temporary: true}
+		deprecated   = ifaceAddr{ip: net.ParseIP("2001:4860:1::dead"), temporary: true, deprecated: true}
+		publicV4     = ifaceAddr{ip: net.ParseIP("8.8.8.8")}
+		secondV4     = ifaceAddr{ip: net.ParseIP("8.8.4.4")}
+		loopbackV4   = ifaceAddr{ip: net.ParseIP("127.0.0.1")}
+		deprecatedV6 = ifaceAddr{ip: net.ParseIP("2001:4860:1::beef"), deprecated: true}
+	)
+
+	tests := []struct {
+		name    string
+		addrs   []ifaceAddr
+		recType string
+		mode    string
+		want    string
+	}{
+		{name: "first ipv4", addrs: []ifaceAddr{loopbackV4, publicV4, secondV4, stable}, recType: "A", want: "8.8.8.8"},
+		{name: "stable over privacy", addrs: []ifaceAddr{linkLocal, privacy, stable}, recType: "AAAA", mode: IPv6AddressStable, want: "2001:4860:1::1234"},
+		{name: "eui-64 first", addrs: []ifaceAddr{stable, eui64, privacy}, recType: "AAAA", mode: IPv6AddressStable, want: "2001:4860:1::211:22ff:fe33:4455"},
+		{name: "privacy over stable", addrs: []ifaceAddr{eui64, stable, privacy}, recType: "AAAA", mode: IPv6AddressPrivacy, want: "2001:4860:1::abcd"},
+		{name: "privacy falls back to stable", addrs: []ifaceAddr{stable, eui64}, recType: "AAAA", mode: IPv6AddressPrivacy, want: "2001:4860:1::211:22ff:fe33:4455"},
+		{name: "stable falls back to privacy", addrs: []ifaceAddr{linkLocal, privacy}, recType: "AAAA", mode: IPv6AddressStable, want: "2001:4860:1::abcd"},
+		{name: "never deprecated", addrs: []ifaceAddr{deprecated, deprecatedV6, stable}, recType: "AAAA", mode: IPv6AddressPrivacy, want: "2001:4860:1::1234"},
+		{name: "ties keep the interface order", addrs: []ifaceAddr{stable, {ip: net.ParseIP("2001:4860:1::5678")}}, recType: "AAAA", mode: IPv6AddressStable, want: "2001:4860:1::1234"},
+		{name: "no global ipv6", addrs: []ifaceAddr{linkLocal, uniqueLocal, deprecated, publicV4}, recType: "AAAA", mode: IPv6AddressStable},
+		{name: "no ipv4", addrs: []ifaceAddr{loopbackV4, stable}, recType: "A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pickInterfaceIP(tt.addrs, tt.recType, tt.mode)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("pickInterfaceIP = %s, want none", got)
+				}
+
+				return
+			}
+
+			if !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("pickInterfaceIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEUI64(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "2001:4860:1::211:22ff:fe33:4455", want: true},
+		{ip: "fe80::211:22ff:fe33:4455", want: true},
+		{ip: "2001:4860:1::1234"},
+		{ip: "2001:4860:1:0:8d3c:ff12:ab45:9e01"},
+	}
+
+	for _, tt := range tests {
+		if got := isEUI64(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isEUI64(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestReadIfInet6(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "if_inet6")
+
+	// temporary, permanent, deprecated temporary and another interface
+	contents := "2001486000010000000000000000abcd 02 40 00 01     eth0\n" +
+		"20014860000100000000000000001234 02 40 00 80     eth0\n" +
+		"2001486000010000000000000000dead 02 40 00 21     eth0\n" +
+		"fe800000000000000000000000000001 02 40 20 80     eth0\n" +
+		"20014860000100000000000000009999 03 40 00 80    wlan0\n" +
+		"garbage\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := readIfInet6(path, "eth0")
+	if err != nil {
+		t.Fatalf("readIfInet6: %v", err)
+	}
+
+	want := map[string]int64{
+		"2001:4860:1::abcd": ifaTemporary,
+		"2001:4860:1::1234": 0x80,
+		"2001:4860:1::dead": ifaTemporary | ifaDeprecated,
+		"fe80::1":           0x80,
+	}
+
+	if len(flags) != len(want) {
+		t.Errorf("read %d addresses, want %d of eth0: %v", len(flags), len(want), flags)
+	}
+
+	for ip, flag := range want {
+		if flags[ip] != flag {
+			t.Errorf("flags of %s = %#x, want %#x", ip, flags[ip], flag)
+		}
+	}
+
+	if _, err := readIfInet6(filepath.Join(t.TempDir(), "missing"), "eth0"); err == nil {
+		t.Errorf("readIfInet6 of a missing file succeeded")
+	}
+}
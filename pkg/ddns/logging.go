@@ -0,0 +1,55 @@
+package ddns
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// timeFormats are the layouts DDNS_TIME_FORMAT accepts by name, besides a Go
+// layout.
+var timeFormats = map[string]string{
+	"rfc3339":  time.RFC3339,
+	"rfc1123":  time.RFC1123,
+	"datetime": time.DateTime,
+	"kitchen":  time.Kitchen,
+}
+
+// NewLogger creates a logger writing to w in format, LogFormatText or
+// LogFormatJSON, that discards messages below level. Timestamp fields are
+// written with layout in loc, RFC 3339 in the local timezone when they are
+// empty. The time of each message is only rewritten when either is set, and
+// keeps the handler's format otherwise.
+func NewLogger(w io.Writer, format string, level slog.Level, loc *time.Location, layout string) *slog.Logger {
+	custom := loc != nil || layout != ""
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() != slog.KindTime || !custom && a.Key == slog.TimeKey && len(groups) == 0 {
+				return a
+			}
+
+			t := a.Value.Time()
+			if loc != nil {
+				t = t.In(loc)
+			}
+
+			return slog.String(a.Key, t.Format(layout))
+		},
+	}
+
+	if format == LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,274 @@
+package ddns
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics exposes Prometheus metrics on their own registry. A nil *metrics
+// discards everything, so callers don't need to check whether metrics are
+// enabled.
+type metrics struct {
+	registry      *prometheus.Registry
+	ipChanges     prometheus.Counter
+	recordUpdates *prometheus.CounterVec
+	checkIPErrors prometheus.Counter
+	// per ip provider, labeled by its url
+	ipCheckDuration *prometheus.HistogramVec
+	ipChecks        *prometheus.CounterVec
+	cycleRetries    prometheus.Counter
+	cycleFailures   prometheus.Counter
+	panics          prometheus.Counter
+	verifications   *prometheus.CounterVec
+	updateSkips     *prometheus.CounterVec
+	lastUpdate      prometheus.Gauge
+	lastSuccess     prometheus.Gauge
+	cycleDuration   prometheus.Histogram
+	currentIP       *prometheus.GaugeVec
+	breakerState    *prometheus.GaugeVec
+	// unix time staleness counts from: the last success, startup before that
+	freshSince atomic.Int64
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		ipChanges: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ddns_ip_changes_total",
+			Help: "Detected public IP changes.",
+		}),
+		recordUpdates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ddns_record_updates_total",
+			Help: "Record writes by domain and result.",
+		}, []string{"domain", "result"}),
+		checkIPErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ddns_checkip_errors_total",
+			Help: "Failed public IP checks.",
+		}),
+		ipCheckDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "ddns_ip_check_duration_seconds",
+			Help: "Duration of requests to each ip provider, including their retries.",
+			// bounded by DDNS_CHECKIP_TIMEOUT per attempt
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"provider"}),
+		ipChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ddns_ip_check_total",
+			Help: "Requests to each ip provider by result: success, error or invalid for an answer that isn't an address of the checked family.",
+		}, []string{"provider", "result"}),
+		cycleRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ddns_cycle_retries_total",
+			Help: "Retries of failed cycles.",
+		}),
+		cycleFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ddns_cycle_failures_total",
+			Help: "Cycles that still failed after their retries.",
+		}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ddns_panics_total",
+			Help: "Panics recovered from cycles and their record workers.",
+		}),
+		verifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ddns_update_verifications_total",
+			Help: "Read-backs of updated records by result.",
+		}, []string{"result"}),
+		updateSkips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ddns_record_update_skips_total",
+			Help: "Record writes skipped because the record already held the value, by where that was seen.",
+		}, []string{"domain", "source"}),
+		lastUpdate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ddns_last_update_timestamp_seconds",
+			Help: "Unix time of the last detected IP change.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "ddns_last_success_timestamp_seconds",
+			Help: "Unix time of the last check after which every record held the current IP.",
+		}),
+		cycleDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "ddns_cycle_duration_seconds",
+			Help: "Duration of checks, from detecting the IP to the last record write.",
+			// a check is a handful of api requests, each bounded by a timeout
+			Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}),
+		currentIP: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ddns_current_ip_info",
+			Help: "Currently detected public IP, always 1.",
+		}, []string{"type", "ip"}),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ddns_breaker_state",
+			Help: "State of the failed cycle breaker, 1 for the current state and 0 for the others.",
+		}, []string{"state"}),
+	}
+
+	m.BreakerState(BreakerClosed)
+
+	m.freshSince.Store(time.Now().Unix())
+
+	staleness := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ddns_staleness_seconds",
+		Help: "Seconds since every record last held the current IP, counted from startup before that.",
+	}, func() float64 {
+		return float64(time.Now().Unix() - m.freshSince.Load())
+	})
+
+	m.registry.MustRegister(m.ipChanges, m.recordUpdates, m.checkIPErrors, m.ipCheckDuration, m.ipChecks, m.cycleRetries, m.cycleFailures, m.panics, m.verifications, m.updateSkips, m.lastUpdate, m.lastSuccess, staleness, m.cycleDuration, m.currentIP, m.breakerState)
+
+	return m
+}
+
+// serve runs the /metrics server on addr. It only returns on error.
+func (m *metrics) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	return http.ListenAndServe(addr, mux)
+}
+
+// ServeMetrics runs the /metrics server on addr. It only returns on error, or
+// at once when DDNS_METRICS_ADDR isn't set and no metrics are collected.
+func (d *DDNSUpdater) ServeMetrics(addr string) error {
+	if d.metrics == nil {
+		return errors.New("metrics are disabled, set DDNS_METRICS_ADDR")
+	}
+
+	return d.metrics.serve(addr)
+}
+
+// CycleDuration records a check that took elapsed.
+func (m *metrics) CycleDuration(elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.cycleDuration.Observe(elapsed.Seconds())
+}
+
+// IPChanged records a change of the recType address to ip at ts.
+func (m *metrics) IPChanged(recType, ip string, ts time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.ipChanges.Inc()
+	m.lastUpdate.Set(float64(ts.Unix()))
+
+	m.CurrentIP(recType, ip)
+}
+
+// CurrentIP reports ip as the current address of recType.
+func (m *metrics) CurrentIP(recType, ip string) {
+	if m == nil {
+		return
+	}
+
+	// only the current address of each type is reported
+	m.currentIP.DeletePartialMatch(prometheus.Labels{"type": recType})
+	m.currentIP.WithLabelValues(recType, ip).Set(1)
+}
+
+// RecordUpdate counts a record write for domain, result is "success" or "failure".
+func (m *metrics) RecordUpdate(domain, result string) {
+	if m == nil {
+		return
+	}
+
+	m.recordUpdates.WithLabelValues(domain, result).Inc()
+}
+
+// UpdateVerification counts a read-back of an updated record, result is "ok",
+// "mismatch" or "error".
+func (m *metrics) UpdateVerification(result string) {
+	if m == nil {
+		return
+	}
+
+	m.verifications.WithLabelValues(result).Inc()
+}
+
+// UpdateSkipped counts a write to a record of domain that was skipped because
+// it already held the value, source is "cache" or "live".
+func (m *metrics) UpdateSkipped(domain, source string) {
+	if m == nil {
+		return
+	}
+
+	m.updateSkips.WithLabelValues(domain, source).Inc()
+}
+
+// UpdateSucceeded records ts as the last time every record held the current
+// IP.
+func (m *metrics) UpdateSucceeded(ts time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.lastSuccess.Set(float64(ts.Unix()))
+	m.freshSince.Store(ts.Unix())
+}
+
+// BreakerState reports state as the state of the breaker.
+func (m *metrics) BreakerState(state string) {
+	if m == nil {
+		return
+	}
+
+	for _, s := range []string{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+
+		m.breakerState.WithLabelValues(s).Set(value)
+	}
+}
+
+// CheckIPError counts a failed public IP check.
+func (m *metrics) CheckIPError() {
+	if m == nil {
+		return
+	}
+
+	m.checkIPErrors.Inc()
+}
+
+// IPCheck records a request to the ip provider at u that took elapsed and
+// ended with result.
+func (m *metrics) IPCheck(u, result string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.ipCheckDuration.WithLabelValues(u).Observe(elapsed.Seconds())
+	m.ipChecks.WithLabelValues(u, result).Inc()
+}
+
+// CycleRetry counts a retry of a failed cycle.
+func (m *metrics) CycleRetry() {
+	if m == nil {
+		return
+	}
+
+	m.cycleRetries.Inc()
+}
+
+// CycleFailed counts a cycle that still failed after its retries.
+func (m *metrics) CycleFailed() {
+	if m == nil {
+		return
+	}
+
+	m.cycleFailures.Inc()
+}
+
+// Panic counts a panic recovered from a cycle.
+func (m *metrics) Panic() {
+	if m == nil {
+		return
+	}
+
+	m.panics.Inc()
+}
@@ -0,0 +1,84 @@
+package ddns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherMetric returns the samples of the metric family name registered
+// with m.
+func gatherMetric(t *testing.T, m *metrics, name string) []*dto.Metric {
+	t.Helper()
+
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()
+		}
+	}
+
+	return nil
+}
+
+// labels returns the label values of sample by name.
+func labels(sample *dto.Metric) map[string]string {
+	values := map[string]string{}
+	for _, label := range sample.GetLabel() {
+		values[label.GetName()] = label.GetValue()
+	}
+
+	return values
+}
+
+func TestIPCheckMetrics(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	invalid := ipServer(t, "<html>oops</html>").URL
+	working := ipServer(t, "8.8.8.8").URL
+
+	d := newTestUpdater(t, map[string]string{
+		"DDNS_CHECKIP_URLS":    failing.URL + "," + invalid + "," + working,
+		"DDNS_CHECKIP_RETRIES": "0",
+		"DDNS_METRICS_ADDR":    "127.0.0.1:0",
+	}, newMemProvider())
+
+	if _, err := d.CheckIP(context.Background(), "A"); err != nil {
+		t.Fatalf("CheckIP: %v", err)
+	}
+
+	want := map[string]string{failing.URL: "error", invalid: "invalid", working: "success"}
+
+	checks := gatherMetric(t, d.metrics, "ddns_ip_check_total")
+	if len(checks) != len(want) {
+		t.Fatalf("got %d ddns_ip_check_total samples, want one per provider", len(checks))
+	}
+
+	for _, sample := range checks {
+		l := labels(sample)
+		if want[l["provider"]] != l["result"] || sample.GetCounter().GetValue() != 1 {
+			t.Errorf("ddns_ip_check_total%v = %v, want result %s once", l, sample.GetCounter().GetValue(), want[l["provider"]])
+		}
+	}
+
+	durations := gatherMetric(t, d.metrics, "ddns_ip_check_duration_seconds")
+	if len(durations) != len(want) {
+		t.Fatalf("got %d ddns_ip_check_duration_seconds samples, want one per provider", len(durations))
+	}
+
+	for _, sample := range durations {
+		if got := sample.GetHistogram().GetSampleCount(); got != 1 {
+			t.Errorf("ddns_ip_check_duration_seconds%v observed %d requests, want 1", labels(sample), got)
+		}
+	}
+}
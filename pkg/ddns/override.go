@@ -0,0 +1,144 @@
+package ddns
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ipOverride is a request from POST /set-ip, handled by the run loop.
+type ipOverride struct {
+	ip     net.IP
+	result chan overrideResult
+}
+
+type overrideResult struct {
+	cycle CycleResult
+	err   error
+}
+
+// handleSetIP writes the ip in the JSON body, e.g. {"ip": "203.0.113.7"}, to
+// every record of its type at once. The caller must send the api token as a
+// bearer token.
+func (d *DDNSUpdater) handleSetIP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(d.apiToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+		return
+	}
+
+	var body struct {
+		IP string `json:"ip"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&body); err != nil {
+		http.Error(w, fmt.Sprintf("expected a JSON body like {\"ip\": \"203.0.113.7\"}: %v", err), http.StatusBadRequest)
+
+		return
+	}
+
+	ip, err := d.validateOverride(body.IP)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	override := ipOverride{ip: ip, result: make(chan overrideResult, 1)}
+
+	// the run loop picks it up between cycles
+	select {
+	case d.overrides <- override:
+	case <-d.stop:
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	result := <-override.result
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if result.err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	_ = json.NewEncoder(w).Encode(result.cycle)
+}
+
+// validateOverride parses raw as an address of a managed record type that may
+// be published.
+func (d *DDNSUpdater) validateOverride(raw string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSpace(raw))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", raw)
+	}
+
+	// a reload may replace the record types meanwhile
+	d.mu.Lock()
+	managed := slices.Contains(d.recordTypes, overrideType(ip))
+	d.mu.Unlock()
+
+	if !managed {
+		return nil, fmt.Errorf("no %s records are managed", overrideType(ip))
+	}
+
+	if !d.allowPrivate {
+		if err := validatePublic(ip, d.allowReserved); err != nil {
+			return nil, err
+		}
+	}
+
+	return ip, nil
+}
+
+// overrideType returns the record type holding ip.
+func overrideType(ip net.IP) string {
+	if ip.To4() != nil {
+		return "A"
+	}
+
+	return "AAAA"
+}
+
+// overrideIP takes ip as the current IP of its type and writes it to every
+// record of that type in a cycle of its own, returning the failed writes. The
+// next scheduled check detects the IP again and replaces it, unless the IP
+// source is IPSourceExternal and ip stays until the next one is pushed.
+func (d *DDNSUpdater) overrideIP(ctx context.Context, ip net.IP) error {
+	d.startCycle()
+	defer d.endCycle()
+
+	recType := overrideType(ip)
+
+	if d.ipSource == IPSourceExternal {
+		d.logger.Info("ip pushed", "type", recType, "ip", ip.String())
+	} else {
+		d.logger.Warn("manual ip override, detection resumes at the next check", "type", recType, "ip", ip.String(), "next_check", d.nextCheck)
+	}
+
+	d.cycle.IPs[recType] = ip.String()
+	delete(d.candidates, recType)
+
+	if d.currentIPs[recType].Equal(ip) {
+		return d.applyRecords(ctx, recType)
+	}
+
+	return d.updateRecords(ctx, recType, ip, d.cycle.Started)
+}
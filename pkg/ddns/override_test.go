@@ -0,0 +1,37 @@
+package ddns
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestValidateOverrideDuringReload(t *testing.T) {
+	p := newMemProvider()
+	p.Add("example.com", "A", "home", "8.8.4.4")
+
+	d := newTestUpdater(t, nil, p)
+	cfg := loadTestConfig(t, map[string]string{"DDNS_RECORD_TYPES": "A,AAAA"})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	// the status server validates overrides while the run loop reloads
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 50; i++ {
+			_, _ = d.validateOverride("8.8.8.8")
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		d.applyConfig(context.Background(), cfg)
+	}
+
+	wg.Wait()
+
+	if _, err := d.validateOverride("2001:4860::8888"); err != nil {
+		t.Errorf("validateOverride after adding AAAA records: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+)
+
+// errCyclePanic wraps a panic recovered from a cycle.
+var errCyclePanic = errors.New("cycle panicked")
+
+// recoverPanic is deferred by the code of a cycle, including its record
+// workers: it turns a panic of the calling goroutine into *err, logging the
+// stack and counting it, so one bad cycle doesn't take the process down.
+func (d *DDNSUpdater) recoverPanic(err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	d.logger.Error("recovered from panic", "panic", p, "stack", string(debug.Stack()))
+	d.statsd.Incr("panics")
+	d.metrics.Panic()
+
+	*err = fmt.Errorf("%w: %v", errCyclePanic, p)
+}
+
+// trackPanics counts the cycles in a row that panicked, given the error of the
+// last one, and exits once panicThreshold is reached so a supervisor restarts
+// the process.
+func (d *DDNSUpdater) trackPanics(err error) {
+	if !errors.Is(err, errCyclePanic) {
+		d.panics = 0
+
+		return
+	}
+
+	d.panics++
+
+	if d.panicThreshold > 0 && d.panics >= d.panicThreshold {
+		slog.Error("cycles keep panicking, exiting so the supervisor can restart the process", "panics", d.panics)
+
+		os.Exit(ExitUnhealthy)
+	}
+}
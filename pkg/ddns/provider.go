@@ -0,0 +1,191 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ProviderDigitalOcean = "digitalocean"
+	ProviderCloudflare   = "cloudflare"
+	ProviderRoute53      = "route53"
+)
+
+var (
+	// ErrRecordNotFound is returned by a Provider when a record doesn't exist.
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrZoneNotFound is returned by a Provider when a domain isn't a zone of
+	// its account, as opposed to a missing record in a zone it manages.
+	ErrZoneNotFound = errors.New("zone not found")
+	// ErrInvalidToken is returned by a Provider that rejected its credentials.
+	ErrInvalidToken = errors.New("invalid api token")
+	// ErrUnreachable is returned by a Provider whose api couldn't be reached.
+	ErrUnreachable = errors.New("api unreachable")
+	// ErrZoneLocked is returned while a zone is cooling down after a lock error,
+	// and by a Provider whose zone is locked.
+	ErrZoneLocked = errors.New("zone is locked")
+)
+
+// CredentialSet is a named provider account, so domains can be managed
+// through several accounts of a provider, or several providers, at once.
+type CredentialSet struct {
+	// Provider is the type of the account, e.g. ProviderDigitalOcean.
+	Provider string
+	// Token is the api token of a digitalocean or cloudflare account. route53
+	// takes its credentials from the AWS environment.
+	Token string
+}
+
+// recordLister is implemented by a Provider that can list every record of a
+// zone at once, so syncing several records of one zone takes a single listing.
+type recordLister interface {
+	// ListRecords returns every record of domain, of every type and name,
+	// lowest ID first, or an error wrapping ErrZoneNotFound when the account
+	// doesn't manage domain.
+	ListRecords(ctx context.Context, domain string) ([]Record, error)
+}
+
+// Record is a DNS record as seen by a Provider. Name is relative to the zone,
+// "@" for the zone apex.
+type Record struct {
+	ID   string
+	Type string
+	Name string
+	Data string
+	TTL  int
+}
+
+// Provider is a DNS backend records are managed through.
+type Provider interface {
+	// Validate confirms the credentials work, returning an error wrapping
+	// ErrInvalidToken or ErrUnreachable otherwise.
+	Validate(ctx context.Context) error
+	// FindRecords returns the records of recType with the relative name in
+	// domain, lowest ID first, or an error wrapping ErrRecordNotFound, or
+	// ErrZoneNotFound when the account doesn't manage domain.
+	FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error)
+	// UpdateRecord sets the data of the record with id to data and, unless ttl
+	// is 0, its TTL. Every other field is left as is. It returns the record as
+	// stored.
+	UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error)
+	// CreateRecord creates record in domain and returns it as stored.
+	CreateRecord(ctx context.Context, domain string, record Record) (Record, error)
+	// DeleteRecord deletes the record with id from domain.
+	DeleteRecord(ctx context.Context, domain, id string) error
+}
+
+// RateLimit is the api rate limit state last reported by a provider.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateReporter is implemented by providers that track their api rate limit.
+type RateReporter interface {
+	RateLimit() RateLimit
+}
+
+// NewProviders creates the default Provider selected by cfg.Provider and one
+// for every other provider or credential set a domain selects, keyed by its
+// name. In dry run mode every provider only logs its writes.
+func NewProviders(cfg *Config) (map[string]Provider, error) {
+	providers := map[string]Provider{}
+
+	names := []string{cfg.Provider}
+	for _, domain := range cfg.Domains {
+		if domain.Provider != "" {
+			names = append(names, domain.Provider)
+		}
+
+		if domain.Secondary != "" {
+			names = append(names, domain.Secondary)
+		}
+	}
+
+	for _, name := range names {
+		if _, ok := providers[name]; ok {
+			continue
+		}
+
+		provider, err := newProvider(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.DryRun {
+			provider = newDryRunProvider(provider)
+		}
+
+		providers[name] = provider
+	}
+
+	return providers, nil
+}
+
+// newProvider creates the Provider called name, a provider or a credential
+// set of cfg.
+func newProvider(name string, cfg *Config) (Provider, error) {
+	if set, ok := cfg.Credentials[name]; ok {
+		return newProviderOf(set.Provider, set.Token, cfg)
+	}
+
+	switch name {
+	case ProviderDigitalOcean:
+		return newProviderOf(name, cfg.DOToken, cfg)
+	case ProviderCloudflare:
+		return newProviderOf(name, cfg.CFToken, cfg)
+	default:
+		return newProviderOf(name, "", cfg)
+	}
+}
+
+// newProviderOf creates a Provider of the type kind using token.
+func newProviderOf(kind, token string, cfg *Config) (Provider, error) {
+	switch kind {
+	case ProviderDigitalOcean:
+		return newDigitalOceanProvider(token, cfg.UserAgent, newHTTPClient(cfg.DOTimeout, cfg.ProxyURL), cfg.DOAPIURL, cfg.MaxRetries)
+	case ProviderCloudflare:
+		return newCloudflareProvider(token, cfg.UserAgent, newHTTPClient(cfg.DOTimeout, cfg.ProxyURL)), nil
+	case ProviderRoute53:
+		return newRoute53Provider(cfg.UserAgent, newHTTPClient(cfg.DOTimeout, cfg.ProxyURL), cfg.MaxRetries)
+	default:
+		return nil, fmt.Errorf("unknown provider %q", kind)
+	}
+}
+
+// credentialTypes returns the provider type of every credential set of cfg by
+// name.
+func credentialTypes(cfg *Config) map[string]string {
+	types := map[string]string{}
+	for name, set := range cfg.Credentials {
+		types[name] = set.Provider
+	}
+
+	return types
+}
+
+// providerType returns the type of the provider or credential set name of
+// cfg, empty when there is none of that name.
+func (cfg *Config) providerType(name string) string {
+	if set, ok := cfg.Credentials[name]; ok {
+		return set.Provider
+	}
+
+	if isProvider(name) {
+		return name
+	}
+
+	return ""
+}
+
+// fqdn returns the fully qualified name of the relative record name in zone.
+func fqdn(zone, name string) string {
+	if name == "" || name == "@" {
+		return zone
+	}
+
+	return name + "." + zone
+}
@@ -0,0 +1,205 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// credentialsConfig writes a config file defining the credential sets work
+// and personal, managing a domain through each of them.
+func credentialsConfig(t *testing.T) string {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "personal-token")
+	if err := os.WriteFile(tokenFile, []byte("personal-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ddns.yaml")
+	contents := fmt.Sprintf(`credentials:
+  work:
+    provider: digitalocean
+    token: work-token
+  personal:
+    provider: digitalocean
+    token_file: %s
+domains:
+  - name: vpn.work.com
+    provider: work
+  - name: home.example.com
+    provider: personal
+  - name: nas.example.org
+`, tokenFile)
+
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// loadCredentialsConfig loads the config of credentialsConfig.
+func loadCredentialsConfig(t *testing.T, env map[string]string) *Config {
+	t.Helper()
+
+	for key, value := range testEnv {
+		t.Setenv(key, value)
+	}
+
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	t.Setenv("DDNS_CONFIG_FILE", credentialsConfig(t))
+
+	// the domains come from the config file
+	t.Setenv("DDNS_DOMAINS", "")
+	os.Unsetenv("DDNS_DOMAINS")
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	return cfg
+}
+
+func TestCredentialSetsConfig(t *testing.T) {
+	cfg := loadCredentialsConfig(t, nil)
+
+	want := map[string]CredentialSet{
+		"work":     {Provider: ProviderDigitalOcean, Token: "work-token"},
+		"personal": {Provider: ProviderDigitalOcean, Token: "personal-token"},
+	}
+
+	if len(cfg.Credentials) != len(want) {
+		t.Fatalf("credentials %+v, want %+v", cfg.Credentials, want)
+	}
+
+	for name, set := range want {
+		if cfg.Credentials[name] != set {
+			t.Errorf("credentials %s = %+v, want %+v", name, cfg.Credentials[name], set)
+		}
+	}
+
+	var out strings.Builder
+	if err := PrintConfig(&out, cfg); err != nil {
+		t.Fatalf("PrintConfig: %v", err)
+	}
+
+	if strings.Contains(out.String(), "work-token") || strings.Contains(out.String(), "personal-token") {
+		t.Errorf("printed config %s, want the credential tokens redacted", out.String())
+	}
+}
+
+func TestCredentialSetsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   string
+	}{
+		{name: "unknown set", change: func(cfg *Config) { cfg.Domains[0].Provider = "other" }, want: `domain vpn.work.com: unknown provider "other"`},
+		{name: "unknown provider", change: func(cfg *Config) { cfg.Credentials["work"] = CredentialSet{Provider: "bind", Token: "x"} }, want: `credentials work: unknown provider "bind"`},
+		{name: "missing token", change: func(cfg *Config) { cfg.Credentials["work"] = CredentialSet{Provider: ProviderDigitalOcean} }, want: "credentials work: token or token_file is required"},
+		{name: "provider name", change: func(cfg *Config) {
+			cfg.Credentials[ProviderCloudflare] = CredentialSet{Provider: ProviderCloudflare, Token: "x"}
+		}, want: "credentials cloudflare: the name of a provider"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadCredentialsConfig(t, nil)
+			tt.change(cfg)
+
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProvidersCredentialSets(t *testing.T) {
+	var mu sync.Mutex
+	tokens := []string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"account": {"status": "active"}}`)
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := loadCredentialsConfig(t, map[string]string{"DDNS_DO_API_URL": srv.URL + "/", "DDNS_DO_API_TOKEN": "default-token"})
+
+	providers, err := NewProviders(cfg)
+	if err != nil {
+		t.Fatalf("NewProviders: %v", err)
+	}
+
+	for _, name := range []string{ProviderDigitalOcean, "work", "personal"} {
+		p, ok := providers[name]
+		if !ok {
+			t.Fatalf("no provider %s, got %v", name, providers)
+		}
+
+		if err := p.Validate(context.Background()); err != nil {
+			t.Fatalf("Validate %s: %v", name, err)
+		}
+	}
+
+	if got := strings.Join(tokens, ","); got != "default-token,work-token,personal-token" {
+		t.Errorf("api requests made with tokens %s, want each provider's own", got)
+	}
+}
+
+func TestCredentialSetsRouteDomains(t *testing.T) {
+	cfg := loadCredentialsConfig(t, map[string]string{"DDNS_IP_PROVIDER": ipServer(t, "8.8.8.8").URL})
+
+	work, personal, fallback := newMemProvider(), newMemProvider(), newMemProvider()
+	vpn := work.Add("work.com", "A", "vpn", "8.8.4.4")
+	home := personal.Add("example.com", "A", "home", "8.8.4.4")
+	nas := fallback.Add("example.org", "A", "nas", "8.8.4.4")
+
+	d := NewDDNSUpdater(cfg, map[string]Provider{ProviderDigitalOcean: fallback, "work": work, "personal": personal})
+	t.Cleanup(d.cancel)
+
+	if err := d.start(d.ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	for _, tt := range []struct {
+		provider *memProvider
+		zone, id string
+	}{
+		{provider: work, zone: "work.com", id: vpn},
+		{provider: personal, zone: "example.com", id: home},
+		{provider: fallback, zone: "example.org", id: nas},
+	} {
+		if got := tt.provider.Data(tt.zone, tt.id); got != "8.8.8.8" {
+			t.Errorf("record in %s holds %s, want 8.8.8.8", tt.zone, got)
+		}
+
+		if got := tt.provider.Calls("UpdateRecord"); got != 1 {
+			t.Errorf("provider of %s made %d updates, want only its own record", tt.zone, got)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ddns
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// proxyFunc returns the proxy selection of every outbound http.Transport:
+// proxy when set, otherwise HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func proxyFunc(proxy *url.URL) func(*http.Request) (*url.URL, error) {
+	if proxy != nil {
+		return http.ProxyURL(proxy)
+	}
+
+	return http.ProxyFromEnvironment
+}
+
+// newHTTPClient returns an http.Client with timeout that goes through proxy,
+// or the proxy from the environment when proxy is nil.
+func newHTTPClient(timeout time.Duration, proxy *url.URL) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(proxy)
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// limitRedirects makes client follow at most max redirects, refusing any when
+// max is 0, and returns it.
+func limitRedirects(client *http.Client, max int) *http.Client {
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if max == 0 {
+			return fmt.Errorf("redirect to %s refused, DDNS_CHECKIP_MAX_REDIRECTS is 0", req.URL.Redacted())
+		}
+
+		if len(via) > max {
+			return fmt.Errorf("stopped after %d redirects", max)
+		}
+
+		return nil
+	}
+
+	return client
+}
@@ -0,0 +1,92 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// familyClient returns an http.Client whose connections only use the given
+// network, "tcp4" or "tcp6", going out from the local address when it isn't
+// nil. Through a proxy only the connection to the proxy is restricted.
+func familyClient(network string, timeout time.Duration, proxy *url.URL, local net.IP) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if local != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: local}
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			DisableKeepAlives: true,
+			Proxy:             proxyFunc(proxy),
+		},
+	}
+}
+
+// bindAddress returns the address of DDNS_BIND_ADDRESS for network, "tcp4" or
+// "tcp6", nil when none is configured.
+func bindAddress(addresses []net.IP, network string) net.IP {
+	for _, ip := range addresses {
+		if (ip.To4() != nil) == (network == "tcp4") {
+			return ip
+		}
+	}
+
+	return nil
+}
+
+// familyNetwork returns the network of the family of ip.
+func familyNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+
+	return "tcp6"
+}
+
+// checkReachability requests the IP provider over IPv4 and IPv6 transport
+// separately and logs which families reached it.
+func (d *DDNSUpdater) checkReachability(ctx context.Context) {
+	for _, network := range []string{"tcp4", "tcp6"} {
+		err := d.reach(ctx, d.familyClients[network])
+		if err != nil {
+			d.logger.Warn("reachability", "network", network, "result", "failed", "error", err)
+
+			continue
+		}
+
+		d.logger.Info("reachability", "network", network, "result", "ok")
+	}
+}
+
+func (d *DDNSUpdater) reach(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.checkIPURL, nil)
+	if err != nil {
+		return fmt.Errorf("error while forming request: %v", err)
+	}
+
+	req.Header.Set("User-Agent", d.userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("error from server (%d)", resp.StatusCode)
+	}
+
+	return nil
+}
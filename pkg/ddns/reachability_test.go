@@ -0,0 +1,118 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// listenTest starts an ip provider on address, skipping the test when the
+// family isn't available.
+func listenTest(t *testing.T, network, address string) *httptest.Server {
+	t.Helper()
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Skipf("no %s loopback: %v", network, err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "8.8.8.8")
+	}))
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestFamilyClient(t *testing.T) {
+	v4 := listenTest(t, "tcp4", "127.0.0.1:0")
+
+	tests := []struct {
+		network string
+		wantErr bool
+	}{
+		{network: "tcp4"},
+		// an IPv6 connection can't reach an IPv4 address
+		{network: "tcp6", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			resp, err := familyClient(tt.network, time.Second, nil, nil).Get(v4.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("request over %s error = %v, want error %v", tt.network, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFamilyClientIPv6(t *testing.T) {
+	v6 := listenTest(t, "tcp6", "[::1]:0")
+
+	resp, err := familyClient("tcp6", time.Second, nil, nil).Get(v6.URL)
+	if err != nil {
+		t.Fatalf("request over tcp6: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := familyClient("tcp4", time.Second, nil, nil).Get(v6.URL); err == nil {
+		t.Errorf("request to an IPv6 address over tcp4 succeeded")
+	}
+}
+
+func TestCheckReachability(t *testing.T) {
+	logs := captureLogs(t)
+
+	v4 := listenTest(t, "tcp4", "127.0.0.1:0")
+
+	d := newTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": v4.URL, "DDNS_CHECK_REACHABILITY": "true"}, newMemProvider())
+
+	if d.familyClients == nil {
+		t.Fatal("no family clients with DDNS_CHECK_REACHABILITY")
+	}
+
+	d.checkReachability(context.Background())
+
+	if got := logs.Count("reachability"); got != 2 {
+		t.Fatalf("logged reachability %d times, want once per family", got)
+	}
+
+	if logs.CountWith("reachability", "network=tcp4 result=ok") != 1 {
+		t.Errorf("tcp4 wasn't logged as reaching the provider")
+	}
+
+	if logs.CountWith("reachability", "network=tcp6 result=failed") != 1 {
+		t.Errorf("tcp6 wasn't logged as failing to reach an IPv4 provider")
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	addresses := []net.IP{net.ParseIP("192.0.2.10"), net.ParseIP("2001:db8::10")}
+
+	if got := bindAddress(addresses, "tcp4"); !got.Equal(addresses[0]) {
+		t.Errorf("bindAddress(tcp4) = %s, want %s", got, addresses[0])
+	}
+
+	if got := bindAddress(addresses, "tcp6"); !got.Equal(addresses[1]) {
+		t.Errorf("bindAddress(tcp6) = %s, want %s", got, addresses[1])
+	}
+
+	if got := bindAddress(addresses[:1], "tcp6"); got != nil {
+		t.Errorf("bindAddress(tcp6) without an IPv6 address = %s, want nil", got)
+	}
+
+	if familyNetwork(addresses[0]) != "tcp4" || familyNetwork(addresses[1]) != "tcp6" {
+		t.Errorf("familyNetwork picked the wrong family")
+	}
+}
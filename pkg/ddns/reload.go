@@ -0,0 +1,144 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Reload hands cfg to Run, which applies the hot-reloadable settings before
+// its next cycle. A reload that arrives while another is pending is dropped.
+func (d *DDNSUpdater) Reload(cfg *Config) error {
+	for _, domain := range cfg.Domains {
+		provider := domain.Provider
+		if provider == "" {
+			provider = cfg.Provider
+		}
+
+		if _, ok := d.providers[provider]; !ok {
+			return fmt.Errorf("domain %s uses provider %s, which requires a restart", domain.Name, provider)
+		}
+
+		if _, ok := d.providers[domain.Secondary]; domain.Secondary != "" && !ok {
+			return fmt.Errorf("domain %s uses secondary provider %s, which requires a restart", domain.Name, domain.Secondary)
+		}
+	}
+
+	select {
+	case d.reload <- cfg:
+		return nil
+	default:
+		return fmt.Errorf("a reload is already pending")
+	}
+}
+
+// applyConfig switches to the domains, record types, intervals, jitter and TTL
+// of cfg. Records of unchanged domains keep their cache, new ones are synced
+// and applied on the next cycle.
+func (d *DDNSUpdater) applyConfig(ctx context.Context, cfg *Config) {
+	recordMap, specs, recordTypes := domainRecords(cfg)
+
+	added := []recordKey{}
+
+	for key := range recordMap {
+		old, ok := d.specs[key.Name]
+
+		// the secondary record is looked up again, and written right away
+		if !ok || old.Secondary != specs[key.Name].Secondary || old.RecordName != specs[key.Name].RecordName || old.Apex != specs[key.Name].Apex {
+			delete(d.secondaryRecords, key)
+			delete(d.secondaryFailures, key)
+		}
+
+		if ok && specs[key.Name].Secondary != "" && old.Secondary != specs[key.Name].Secondary {
+			d.recheck[key] = true
+		}
+
+		if _, cached := d.recordMap[key]; cached && ok && old.RecordName == specs[key.Name].RecordName && old.Provider == specs[key.Name].Provider && old.Apex == specs[key.Name].Apex {
+			recordMap[key] = d.recordMap[key]
+
+			// a changed value or target is written without waiting for the ip to change
+			if old.Value != specs[key.Name].Value || old.Target != specs[key.Name].Target {
+				d.recheck[key] = true
+			}
+
+			continue
+		}
+
+		added = append(added, key)
+	}
+
+	for key := range d.recordMap {
+		if _, ok := recordMap[key]; !ok {
+			d.logger.Info("no longer managing record", "record", key.String())
+
+			delete(d.recheck, key)
+			delete(d.siblings, key)
+			delete(d.updatedAt, key)
+			delete(d.failures, key)
+			delete(d.lastErrors, key)
+			delete(d.unsynced, key)
+			delete(d.secondaryRecords, key)
+			delete(d.secondaryFailures, key)
+		}
+	}
+
+	intervals := map[string]time.Duration{}
+	for name := range d.specs {
+		intervals[name] = d.intervalFor(name)
+	}
+
+	jitterChanged := d.jitter != cfg.IntervalJitter
+
+	d.recordMap = recordMap
+	d.specs = specs
+
+	d.mu.Lock()
+	d.recordTypes = recordTypes
+	d.mu.Unlock()
+
+	d.defaultProvider = cfg.Provider
+	d.ttl = cfg.TTL
+	d.interval = cfg.Interval
+	d.jitter = cfg.IntervalJitter
+
+	// new domains are due right away, ones whose interval changed are rescheduled
+	now := time.Now()
+	for name := range d.domainNext {
+		if _, ok := specs[name]; !ok {
+			delete(d.domainNext, name)
+		}
+	}
+
+	for name, interval := range intervals {
+		if _, ok := specs[name]; ok && (jitterChanged || interval != d.intervalFor(name)) {
+			d.domainNext[name] = d.scheduleAfter(now, d.intervalFor(name))
+		}
+	}
+
+	d.updateNextCheck()
+	d.setCheckWindow()
+
+	d.logger.Info("next check", "next_check", d.nextCheck)
+
+	d.logDomainTable()
+
+	if d.lazySync {
+		for _, key := range added {
+			d.unsynced[key] = true
+		}
+	} else {
+		err := d.forEachRecord(added, func(key recordKey) error {
+			return d.syncRecord(ctx, key)
+		})
+		if err != nil {
+			d.logger.Error("unable to sync records", "error", err)
+		}
+	}
+
+	// new records get the current ip without waiting for it to change
+	for _, key := range added {
+		d.recheck[key] = true
+	}
+
+	d.logger.Info("config reloaded", "records", len(d.recordMap), "added", len(added))
+}
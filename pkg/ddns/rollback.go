@@ -0,0 +1,98 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// trackWrite remembers record, as it was before a successful write that gave
+// it the id id, so a partial update of its domain can be rolled back.
+func (d *DDNSUpdater) trackWrite(key recordKey, id string, record Record) {
+	record.ID = id
+
+	d.mu.Lock()
+	d.written[key] = append(d.written[key], record)
+	d.mu.Unlock()
+}
+
+// rollbackPartial looks for domains of which some record types were written in
+// this cycle while another failed, and logs each such partial update. With
+// rollbackOnPartial the written records are reverted to their previous data
+// and flagged for a re-check, so the domain keeps answering with one
+// consistent set of addresses until every type can be updated. It returns the
+// failed reverts.
+func (d *DDNSUpdater) rollbackPartial(ctx context.Context) error {
+	failed := map[string][]string{}
+	for key := range d.failed {
+		failed[key.Name] = append(failed[key.Name], key.Type)
+	}
+
+	keys := []recordKey{}
+	for key := range d.written {
+		if len(failed[key.Name]) > 0 && !d.failed[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	errs := []error{}
+
+	for _, key := range keys {
+		d.logger.Error("partial update, domain holds new and old addresses", "domain", key.Name, "updated_type", key.Type, "failed_types", failed[key.Name], "rollback", d.rollbackOnPartial)
+
+		if !d.rollbackOnPartial {
+			continue
+		}
+
+		for _, record := range d.written[key] {
+			errs = append(errs, d.revertRecord(ctx, key, record))
+		}
+
+		// a later cycle writes every type again, and a restart re-seeds them
+		d.recheck[key] = true
+		for _, recType := range failed[key.Name] {
+			d.recheck[recordKey{Name: key.Name, Type: recType}] = true
+		}
+
+		if d.confirmedIPs[key.Type] != nil {
+			delete(d.confirmedIPs, key.Type)
+			d.persistState(time.Now())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// revertRecord writes the previous data of record, a record of key written in
+// this cycle, back to it.
+func (d *DDNSUpdater) revertRecord(ctx context.Context, key recordKey, record Record) error {
+	domain, _, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return err
+	}
+
+	// the data written in this cycle, which is rolled back
+	written, _ := d.valueFor(key)
+
+	r, err := d.providerFor(key.Name).UpdateRecord(ctx, domain, record.ID, record.Data, record.TTL)
+	if err != nil {
+		err = fmt.Errorf("error while rolling back record %s: %v", key, err)
+		d.audit(key, d.providerName(key.Name), AuditFailed, record.ID, written, record.Data, err)
+		d.logger.Error("unable to roll back record", "record", key.String(), "record_id", record.ID, "error", err)
+		d.cycle.addError(err)
+
+		return err
+	}
+
+	d.logger.Warn("record rolled back", "record", key.String(), "record_id", record.ID, "data", record.Data)
+
+	d.audit(key, d.providerName(key.Name), AuditRolledBack, record.ID, written, r.Data, nil)
+
+	d.cacheRecord(key, record.ID, r)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package ddns
+
+import "net"
+
+// bogonNets are the reserved ranges no public address is in, besides the
+// private, loopback and link-local ones the net package knows: RFC 6890
+// special purpose blocks, documentation and benchmarking ranges, shared
+// CGNAT space and multicast.
+var bogonNets = parseNets(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.88.99.0/24",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"64:ff9b:1::/48",
+	"100::/64",
+	"2001:2::/48",
+	"2001:10::/28",
+	"2001:20::/28",
+	"2001:db8::/32",
+	"3fff::/20",
+	"fec0::/10",
+	"ff00::/8",
+)
+
+func parseNets(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		nets = append(nets, network)
+	}
+
+	return nets
+}
+
+// isPubliclyRoutable reports whether ip can be reached from the internet, so
+// it isn't private, loopback, link-local, unspecified or in a bogon range.
+func isPubliclyRoutable(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return false
+	}
+
+	return bogonNet(ip) == nil
+}
+
+// bogonNet returns the bogon range ip is in, nil if none.
+func bogonNet(ip net.IP) *net.IPNet {
+	for _, network := range bogonNets {
+		if network.Contains(ip) {
+			return network
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package ddns
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPubliclyRoutable(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "8.8.8.8", want: true},
+		{ip: "1.1.1.1", want: true},
+		{ip: "0.0.0.0"},
+		{ip: "0.255.255.255"},
+		{ip: "1.0.0.0", want: true},
+		{ip: "10.0.0.1"},
+		{ip: "100.63.255.255", want: true},
+		{ip: "100.64.0.0"},
+		{ip: "100.127.255.255"},
+		{ip: "100.128.0.0", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "169.254.1.1"},
+		{ip: "172.15.255.255", want: true},
+		{ip: "172.16.0.0"},
+		{ip: "172.31.255.255"},
+		{ip: "172.32.0.0", want: true},
+		{ip: "192.0.0.8"},
+		{ip: "192.0.2.1"},
+		{ip: "192.88.99.1"},
+		{ip: "192.168.1.1"},
+		{ip: "198.17.255.255", want: true},
+		{ip: "198.18.0.0"},
+		{ip: "198.19.255.255"},
+		{ip: "198.20.0.0", want: true},
+		{ip: "198.51.100.1"},
+		{ip: "203.0.112.255", want: true},
+		{ip: "203.0.113.1"},
+		{ip: "203.0.114.0", want: true},
+		{ip: "223.255.255.255", want: true},
+		{ip: "224.0.0.1"},
+		{ip: "240.0.0.1"},
+		{ip: "255.255.255.255"},
+		{ip: "2001:4860:4860::8888", want: true},
+		{ip: "2606:4700:4700::1111", want: true},
+		{ip: "::"},
+		{ip: "::1"},
+		{ip: "fe80::1"},
+		{ip: "fc00::1"},
+		{ip: "fd12:3456::1"},
+		{ip: "fec0::1"},
+		{ip: "ff02::1"},
+		{ip: "2001:db8::1"},
+		{ip: "2001:db7:ffff::1", want: true},
+		{ip: "2001:db9::1", want: true},
+		{ip: "100::1"},
+		{ip: "2001:2::1"},
+		{ip: "2001:10::1"},
+		{ip: "2001:20::1"},
+		{ip: "64:ff9b:1::1"},
+		{ip: "3fff::1"},
+	}
+
+	for _, tt := range tests {
+		if got := isPubliclyRoutable(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPubliclyRoutable(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePublic(t *testing.T) {
+	tests := []struct {
+		ip            string
+		allowReserved bool
+		wantErr       bool
+	}{
+		{ip: "8.8.8.8"},
+		{ip: "100.64.0.1", wantErr: true},
+		// the relaxed check still rejects private addresses
+		{ip: "100.64.0.1", allowReserved: true},
+		{ip: "2001:db8::1", allowReserved: true},
+		{ip: "192.168.1.1", allowReserved: true, wantErr: true},
+		{ip: "127.0.0.1", allowReserved: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validatePublic(net.ParseIP(tt.ip), tt.allowReserved)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validatePublic(%s, %v) = %v, want error %v", tt.ip, tt.allowReserved, err, tt.wantErr)
+		}
+	}
+}
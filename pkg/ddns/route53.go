@@ -0,0 +1,369 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+)
+
+// Route53DefaultTTL is the TTL of records created without one, Route53
+// requires every record set to have a TTL.
+const Route53DefaultTTL = 300
+
+// route53API is the part of the Route53 client the provider uses, so a fake
+// can stand in for the AWS api.
+type route53API interface {
+	ListHostedZones(ctx context.Context, params *route53.ListHostedZonesInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error)
+	ListHostedZonesByName(ctx context.Context, params *route53.ListHostedZonesByNameInput, optFns ...func(*route53.Options)) (*route53.ListHostedZonesByNameOutput, error)
+	ListResourceRecordSets(ctx context.Context, params *route53.ListResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
+	ChangeResourceRecordSets(ctx context.Context, params *route53.ChangeResourceRecordSetsInput, optFns ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error)
+}
+
+// route53Provider manages records through the AWS Route53 API. Route53 has no
+// record ids: a Record is a whole record set, identified by its type and fully
+// qualified name.
+type route53Provider struct {
+	client      route53API
+	credentials aws.CredentialsProvider
+	// zone name: hosted zone id
+	zoneIDs map[string]string
+	// id: last record set seen, so upserts can carry its TTL forward
+	records map[string]types.ResourceRecordSet
+	// guards zoneIDs and records, concurrent workers share the provider
+	mu sync.Mutex
+}
+
+// newRoute53Provider creates a provider with credentials from the standard AWS
+// chain: environment, shared config files and instance or task roles.
+func newRoute53Provider(userAgent string, client *http.Client, maxRetries int) (*route53Provider, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithHTTPClient(client),
+		// route53 is global, any region signs its requests
+		awsconfig.WithDefaultRegion("us-east-1"),
+		awsconfig.WithRetryMaxAttempts(maxRetries+1),
+		// the sdk keeps its own user agent and adds this as app/<id>
+		awsconfig.WithAppID(userAgent),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load aws config: %w", err)
+	}
+
+	return &route53Provider{
+		client:      route53.NewFromConfig(cfg),
+		credentials: cfg.Credentials,
+		zoneIDs:     map[string]string{},
+		records:     map[string]types.ResourceRecordSet{},
+	}, nil
+}
+
+func (p *route53Provider) Validate(ctx context.Context) error {
+	if p.credentials == nil {
+		return fmt.Errorf("%w: no aws credentials found", ErrInvalidToken)
+	}
+
+	_, err := p.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: unable to retrieve aws credentials: %v", ErrInvalidToken, err)
+	}
+
+	_, err = p.client.ListHostedZones(ctx, &route53.ListHostedZonesInput{MaxItems: aws.Int32(1)})
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+
+	return p.wrapError(err)
+}
+
+func (p *route53Provider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	set, err := p.lookup(ctx, domain, recType, fqdn(domain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	return []Record{p.remember(domain, set)}, nil
+}
+
+func (p *route53Provider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	recType, name, err := splitRoute53ID(id)
+	if err != nil {
+		return Record{}, err
+	}
+
+	current, ok := p.cached(id)
+	if !ok {
+		current, err = p.lookup(ctx, domain, recType, name)
+		if err != nil {
+			return Record{}, err
+		}
+	}
+
+	set := types.ResourceRecordSet{
+		Name:            aws.String(name),
+		Type:            types.RRType(recType),
+		TTL:             current.TTL,
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(route53Value(recType, data))}},
+	}
+
+	if ttl > 0 {
+		set.TTL = aws.Int64(int64(ttl))
+	}
+
+	// UPSERT replaces every value of the set with data
+	err = p.change(ctx, domain, types.ChangeActionUpsert, set)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return p.remember(domain, set), nil
+}
+
+func (p *route53Provider) CreateRecord(ctx context.Context, domain string, record Record) (Record, error) {
+	ttl := record.TTL
+	if ttl <= 0 {
+		ttl = Route53DefaultTTL
+	}
+
+	set := types.ResourceRecordSet{
+		Name:            aws.String(fqdn(domain, record.Name)),
+		Type:            types.RRType(record.Type),
+		TTL:             aws.Int64(int64(ttl)),
+		ResourceRecords: []types.ResourceRecord{{Value: aws.String(route53Value(record.Type, record.Data))}},
+	}
+
+	err := p.change(ctx, domain, types.ChangeActionCreate, set)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return p.remember(domain, set), nil
+}
+
+func (p *route53Provider) DeleteRecord(ctx context.Context, domain, id string) error {
+	recType, name, err := splitRoute53ID(id)
+	if err != nil {
+		return err
+	}
+
+	// a DELETE has to match the set exactly, so it always starts from the api
+	set, err := p.lookup(ctx, domain, recType, name)
+	if err != nil {
+		return err
+	}
+
+	err = p.change(ctx, domain, types.ChangeActionDelete, set)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.records, id)
+	p.mu.Unlock()
+
+	return nil
+}
+
+// lookup returns the record set of recType named name in the hosted zone of
+// domain. Alias and routing policy sets aren't managed and not returned.
+func (p *route53Provider) lookup(ctx context.Context, domain, recType, name string) (types.ResourceRecordSet, error) {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return types.ResourceRecordSet{}, err
+	}
+
+	out, err := p.client.ListResourceRecordSets(ctx, &route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(name),
+		StartRecordType: types.RRType(recType),
+	})
+	if err != nil {
+		return types.ResourceRecordSet{}, p.wrapError(err)
+	}
+
+	// the listing starts at name and type, and continues with the sets after it
+	for _, set := range out.ResourceRecordSets {
+		if route53Name(aws.ToString(set.Name)) != route53Name(name) || string(set.Type) != recType {
+			break
+		}
+
+		if set.AliasTarget == nil && set.SetIdentifier == nil && len(set.ResourceRecords) > 0 {
+			return set, nil
+		}
+	}
+
+	return types.ResourceRecordSet{}, fmt.Errorf("%w: no matching %s record for domain=%s name=%s", ErrRecordNotFound, recType, domain, name)
+}
+
+// change applies a single change to set in the hosted zone of domain.
+func (p *route53Provider) change(ctx context.Context, domain string, action types.ChangeAction, set types.ResourceRecordSet) error {
+	zoneID, err := p.zoneID(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Changes: []types.Change{{Action: action, ResourceRecordSet: &set}},
+		},
+	})
+	if err != nil {
+		return p.wrapError(err)
+	}
+
+	return nil
+}
+
+// zoneID looks up and caches the id of the hosted zone whose apex is domain,
+// preferring a public zone over a private one of the same name.
+func (p *route53Provider) zoneID(ctx context.Context, domain string) (string, error) {
+	p.mu.Lock()
+	id, ok := p.zoneIDs[domain]
+	p.mu.Unlock()
+
+	if ok {
+		return id, nil
+	}
+
+	out, err := p.client.ListHostedZonesByName(ctx, &route53.ListHostedZonesByNameInput{DNSName: aws.String(domain)})
+	if err != nil {
+		return "", p.wrapError(err)
+	}
+
+	for _, zone := range out.HostedZones {
+		if route53Name(aws.ToString(zone.Name)) != route53Name(domain) {
+			continue
+		}
+
+		private := zone.Config != nil && zone.Config.PrivateZone
+		if id == "" || !private {
+			id = strings.TrimPrefix(aws.ToString(zone.Id), "/hostedzone/")
+		}
+
+		if !private {
+			break
+		}
+	}
+
+	if id == "" {
+		return "", fmt.Errorf("%w: domain %s is not a hosted zone of this AWS account", ErrZoneNotFound, domain)
+	}
+
+	p.mu.Lock()
+	p.zoneIDs[domain] = id
+	p.mu.Unlock()
+
+	return id, nil
+}
+
+// remember caches set for later upserts and converts it to a Record with a
+// name relative to zone. The values of a set holding several are joined, so
+// it never matches and is collapsed to the single managed value.
+func (p *route53Provider) remember(zone string, set types.ResourceRecordSet) Record {
+	fullName := route53Name(aws.ToString(set.Name))
+	id := string(set.Type) + " " + fullName
+
+	p.mu.Lock()
+	p.records[id] = set
+	p.mu.Unlock()
+
+	values := make([]string, 0, len(set.ResourceRecords))
+	for _, rr := range set.ResourceRecords {
+		values = append(values, recordValue(string(set.Type), aws.ToString(rr.Value)))
+	}
+
+	name := strings.TrimSuffix(fullName, "."+zone)
+	if fullName == zone {
+		name = "@"
+	}
+
+	return Record{
+		ID:   id,
+		Type: string(set.Type),
+		Name: name,
+		Data: strings.Join(values, ","),
+		TTL:  int(aws.ToInt64(set.TTL)),
+	}
+}
+
+// cached returns the last record set seen with id.
+func (p *route53Provider) cached(id string) (types.ResourceRecordSet, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	set, ok := p.records[id]
+
+	return set, ok
+}
+
+// wrapError maps Route53 api errors onto the provider-neutral sentinels.
+func (p *route53Provider) wrapError(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.ErrorCode() {
+	case "AccessDenied", "AccessDeniedException", "InvalidClientTokenId", "SignatureDoesNotMatch", "ExpiredToken", "UnrecognizedClientException":
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	case "NoSuchHostedZone":
+		return fmt.Errorf("%w: %v", ErrRecordNotFound, err)
+	}
+
+	return err
+}
+
+// splitRoute53ID splits a record id into its type and fully qualified name.
+func splitRoute53ID(id string) (string, string, error) {
+	recType, name, ok := strings.Cut(id, " ")
+	if !ok || recType == "" || name == "" {
+		return "", "", fmt.Errorf("invalid route53 record id %q", id)
+	}
+
+	return recType, name, nil
+}
+
+// route53Name normalizes a name as returned by Route53: lower case, without
+// the trailing dot and with an escaped wildcard label restored.
+func route53Name(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	return strings.ReplaceAll(name, `\052`, "*")
+}
+
+// route53Value returns data in the presentation format Route53 expects for
+// recType, where TXT values are quoted.
+func route53Value(recType, data string) string {
+	if recType != "TXT" {
+		return data
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(data) + `"`
+}
+
+// recordValue reverses route53Value for a value read from Route53.
+func recordValue(recType, value string) string {
+	if recType != "TXT" {
+		return value
+	}
+
+	// values split into several strings are left as is and never match
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' || strings.Contains(value, `" "`) {
+		return value
+	}
+
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+}
@@ -0,0 +1,302 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/smithy-go"
+)
+
+// fakeRoute53 is an in-memory route53API.
+type fakeRoute53 struct {
+	mu    sync.Mutex
+	zones []types.HostedZone
+	// hosted zone id: record sets
+	sets map[string][]types.ResourceRecordSet
+	// change batches in the order they were made
+	changes []types.Change
+}
+
+func newFakeRoute53() *fakeRoute53 {
+	return &fakeRoute53{sets: map[string][]types.ResourceRecordSet{}}
+}
+
+// AddZone adds a hosted zone, private to a VPC when private is set.
+func (f *fakeRoute53) AddZone(id, name string, private bool) {
+	f.zones = append(f.zones, types.HostedZone{
+		Id:     aws.String("/hostedzone/" + id),
+		Name:   aws.String(name + "."),
+		Config: &types.HostedZoneConfig{PrivateZone: private},
+	})
+}
+
+// AddSet adds a record set with values to the zone with id.
+func (f *fakeRoute53) AddSet(zoneID, recType, name string, ttl int64, values ...string) {
+	set := types.ResourceRecordSet{Name: aws.String(name + "."), Type: types.RRType(recType), TTL: aws.Int64(ttl)}
+	for _, v := range values {
+		set.ResourceRecords = append(set.ResourceRecords, types.ResourceRecord{Value: aws.String(v)})
+	}
+
+	f.sets[zoneID] = append(f.sets[zoneID], set)
+}
+
+// Set returns the record set of recType named name in the zone with id.
+func (f *fakeRoute53) Set(zoneID, recType, name string) (types.ResourceRecordSet, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, set := range f.sets[zoneID] {
+		if route53Name(aws.ToString(set.Name)) == route53Name(name) && string(set.Type) == recType {
+			return set, true
+		}
+	}
+
+	return types.ResourceRecordSet{}, false
+}
+
+func (f *fakeRoute53) ListHostedZones(context.Context, *route53.ListHostedZonesInput, ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error) {
+	return &route53.ListHostedZonesOutput{HostedZones: f.zones}, nil
+}
+
+func (f *fakeRoute53) ListHostedZonesByName(_ context.Context, params *route53.ListHostedZonesByNameInput, _ ...func(*route53.Options)) (*route53.ListHostedZonesByNameOutput, error) {
+	return &route53.ListHostedZonesByNameOutput{HostedZones: f.zones}, nil
+}
+
+func (f *fakeRoute53) ListResourceRecordSets(_ context.Context, params *route53.ListResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sets, ok := f.sets[aws.ToString(params.HostedZoneId)]
+	if !ok {
+		return nil, &smithy.GenericAPIError{Code: "NoSuchHostedZone", Message: "no such hosted zone"}
+	}
+
+	// the listing starts at the requested name and type, followed by the rest
+	name := route53Name(aws.ToString(params.StartRecordName))
+	first := []types.ResourceRecordSet{}
+	rest := []types.ResourceRecordSet{}
+
+	for _, set := range sets {
+		if route53Name(aws.ToString(set.Name)) == name && set.Type == params.StartRecordType {
+			first = append(first, set)
+		} else {
+			rest = append(rest, set)
+		}
+	}
+
+	return &route53.ListResourceRecordSetsOutput{ResourceRecordSets: append(first, rest...)}, nil
+}
+
+func (f *fakeRoute53) ChangeResourceRecordSets(_ context.Context, params *route53.ChangeResourceRecordSetsInput, _ ...func(*route53.Options)) (*route53.ChangeResourceRecordSetsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	zoneID := aws.ToString(params.HostedZoneId)
+
+	for _, change := range params.ChangeBatch.Changes {
+		f.changes = append(f.changes, change)
+
+		set := *change.ResourceRecordSet
+		found := -1
+
+		for i, existing := range f.sets[zoneID] {
+			if route53Name(aws.ToString(existing.Name)) == route53Name(aws.ToString(set.Name)) && existing.Type == set.Type {
+				found = i
+			}
+		}
+
+		switch {
+		case change.Action == types.ChangeActionCreate && found >= 0:
+			return nil, &smithy.GenericAPIError{Code: "InvalidChangeBatch", Message: "record set already exists"}
+		case change.Action == types.ChangeActionDelete && found < 0:
+			return nil, &smithy.GenericAPIError{Code: "InvalidChangeBatch", Message: "record set not found"}
+		case change.Action == types.ChangeActionDelete:
+			f.sets[zoneID] = append(f.sets[zoneID][:found], f.sets[zoneID][found+1:]...)
+		case found >= 0:
+			f.sets[zoneID][found] = set
+		default:
+			f.sets[zoneID] = append(f.sets[zoneID], set)
+		}
+	}
+
+	return &route53.ChangeResourceRecordSetsOutput{}, nil
+}
+
+// newTestRoute53 returns a Route53 provider making its calls to api.
+func newTestRoute53(api route53API) *route53Provider {
+	return &route53Provider{
+		client: api,
+		credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+		zoneIDs: map[string]string{},
+		records: map[string]types.ResourceRecordSet{},
+	}
+}
+
+func TestRoute53FindRecords(t *testing.T) {
+	api := newFakeRoute53()
+	api.AddZone("PRIVATE", "example.com", true)
+	api.AddZone("PUBLIC", "example.com", false)
+	api.AddSet("PUBLIC", "A", "home.example.com", 120, "8.8.4.4")
+	api.AddSet("PUBLIC", "A", "example.com", 300, "8.8.8.8")
+	api.AddSet("PUBLIC", "A", `\052.example.com`, 300, "8.8.8.8")
+	api.AddSet("PRIVATE", "A", "home.example.com", 120, "10.0.0.2")
+
+	p := newTestRoute53(api)
+
+	tests := []struct {
+		name string
+		want Record
+	}{
+		{name: "home", want: Record{ID: "A home.example.com", Type: "A", Name: "home", Data: "8.8.4.4", TTL: 120}},
+		{name: "@", want: Record{ID: "A example.com", Type: "A", Name: "@", Data: "8.8.8.8", TTL: 300}},
+		{name: "*", want: Record{ID: "A *.example.com", Type: "A", Name: "*", Data: "8.8.8.8", TTL: 300}},
+	}
+
+	for _, tt := range tests {
+		found, err := p.FindRecords(context.Background(), "example.com", "A", tt.name)
+		if err != nil {
+			t.Fatalf("FindRecords(%s): %v", tt.name, err)
+		}
+
+		if len(found) != 1 || found[0] != tt.want {
+			t.Errorf("FindRecords(%s) = %+v, want %+v from the public zone", tt.name, found, tt.want)
+		}
+	}
+
+	_, err := p.FindRecords(context.Background(), "example.com", "AAAA", "home")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("FindRecords of a missing set error = %v, want ErrRecordNotFound", err)
+	}
+
+	_, err = p.FindRecords(context.Background(), "example.org", "A", "home")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("FindRecords outside the hosted zones error = %v, want ErrZoneNotFound", err)
+	}
+}
+
+func TestRoute53UpdateRecord(t *testing.T) {
+	api := newFakeRoute53()
+	api.AddZone("Z1", "example.com", false)
+	api.AddSet("Z1", "A", "home.example.com", 120, "8.8.4.4")
+
+	p := newTestRoute53(api)
+
+	found, err := p.FindRecords(context.Background(), "example.com", "A", "home")
+	if err != nil {
+		t.Fatalf("FindRecords: %v", err)
+	}
+
+	r, err := p.UpdateRecord(context.Background(), "example.com", found[0].ID, "8.8.8.8", 0)
+	if err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+
+	if r.Data != "8.8.8.8" || r.TTL != 120 {
+		t.Errorf("updated record %+v, want the new ip with the ttl kept", r)
+	}
+
+	if len(api.changes) != 1 || api.changes[0].Action != types.ChangeActionUpsert {
+		t.Fatalf("changes %+v, want a single UPSERT", api.changes)
+	}
+
+	set, _ := api.Set("Z1", "A", "home.example.com")
+	if len(set.ResourceRecords) != 1 || aws.ToString(set.ResourceRecords[0].Value) != "8.8.8.8" || aws.ToInt64(set.TTL) != 120 {
+		t.Errorf("record set %+v, want 8.8.8.8 with ttl 120", set)
+	}
+
+	// a configured ttl replaces the one of the set
+	if _, err := p.UpdateRecord(context.Background(), "example.com", found[0].ID, "8.8.8.8", 60); err != nil {
+		t.Fatalf("UpdateRecord: %v", err)
+	}
+
+	if set, _ := api.Set("Z1", "A", "home.example.com"); aws.ToInt64(set.TTL) != 60 {
+		t.Errorf("ttl = %d, want 60", aws.ToInt64(set.TTL))
+	}
+}
+
+func TestRoute53CreateAndDeleteRecord(t *testing.T) {
+	api := newFakeRoute53()
+	api.AddZone("Z1", "example.com", false)
+
+	p := newTestRoute53(api)
+
+	r, err := p.CreateRecord(context.Background(), "example.com", Record{Type: "TXT", Name: "home", Data: `say "hi"`})
+	if err != nil {
+		t.Fatalf("CreateRecord: %v", err)
+	}
+
+	set, ok := api.Set("Z1", "TXT", "home.example.com")
+	if !ok {
+		t.Fatalf("no record set created")
+	}
+
+	if got := aws.ToString(set.ResourceRecords[0].Value); got != `"say \"hi\""` {
+		t.Errorf("TXT value = %s, want it quoted and escaped", got)
+	}
+
+	if aws.ToInt64(set.TTL) != Route53DefaultTTL {
+		t.Errorf("ttl = %d, want the default %d", aws.ToInt64(set.TTL), Route53DefaultTTL)
+	}
+
+	if r.Data != `say "hi"` || r.Name != "home" {
+		t.Errorf("created record %+v, want the unquoted value", r)
+	}
+
+	if err := p.DeleteRecord(context.Background(), "example.com", r.ID); err != nil {
+		t.Fatalf("DeleteRecord: %v", err)
+	}
+
+	if _, ok := api.Set("Z1", "TXT", "home.example.com"); ok {
+		t.Errorf("record set still exists after DeleteRecord")
+	}
+}
+
+func TestRoute53Validate(t *testing.T) {
+	p := newTestRoute53(newFakeRoute53())
+	if err := p.Validate(context.Background()); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	p.credentials = nil
+	if err := p.Validate(context.Background()); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Validate without credentials error = %v, want ErrInvalidToken", err)
+	}
+
+	denied := &smithy.GenericAPIError{Code: "AccessDenied", Message: "not authorized"}
+	if err := p.wrapError(denied); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrapError(AccessDenied) = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRoute53Values(t *testing.T) {
+	tests := []struct {
+		recType string
+		data    string
+		value   string
+	}{
+		{recType: "A", data: "8.8.8.8", value: "8.8.8.8"},
+		{recType: "TXT", data: "v=spf1 -all", value: `"v=spf1 -all"`},
+		{recType: "TXT", data: `a "b" \c`, value: `"a \"b\" \\c"`},
+	}
+
+	for _, tt := range tests {
+		if got := route53Value(tt.recType, tt.data); got != tt.value {
+			t.Errorf("route53Value(%s, %s) = %s, want %s", tt.recType, tt.data, got, tt.value)
+		}
+
+		if got := recordValue(tt.recType, tt.value); got != tt.data {
+			t.Errorf("recordValue(%s, %s) = %s, want %s", tt.recType, tt.value, got, tt.data)
+		}
+	}
+
+	if got := route53Name(`\052.Example.COM.`); got != "*.example.com" {
+		t.Errorf("route53Name = %s, want *.example.com", got)
+	}
+}
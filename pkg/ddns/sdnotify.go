@@ -0,0 +1,66 @@
+package ddns
+
+import (
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+)
+
+// sdNotify sends state, e.g. "READY=1", to the systemd notification socket.
+// Outside of a Type=notify unit NOTIFY_SOCKET is unset and nothing is sent.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+
+	// a leading @ names a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
+
+// sdWatchdogEnabled reports whether systemd expects watchdog keep-alives from
+// this process, i.e. the unit sets WatchdogSec.
+func sdWatchdogEnabled() bool {
+	if os.Getenv("WATCHDOG_USEC") == "" {
+		return false
+	}
+
+	// set when the keep-alives are expected from a specific process
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" {
+		return pid == strconv.Itoa(os.Getpid())
+	}
+
+	return true
+}
+
+// notifyReady tells systemd the initial sync is done.
+func notifyReady() {
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("unable to notify systemd", "state", "READY=1", "error", err)
+	}
+}
+
+// notifyWatchdog sends a watchdog keep-alive after a successful cycle.
+func notifyWatchdog() {
+	if !sdWatchdogEnabled() {
+		return
+	}
+
+	if err := sdNotify("WATCHDOG=1"); err != nil {
+		slog.Warn("unable to notify systemd", "state", "WATCHDOG=1", "error", err)
+	}
+}
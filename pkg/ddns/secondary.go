@@ -0,0 +1,163 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// mirrorSecondary writes value, the data just applied to the records of key,
+// to the record of the secondary provider of its domain, if it has one. It is
+// best effort: a failure is logged and alerted on, but never fails the cycle.
+// The secondary record is looked up on its first write and cached after.
+func (d *DDNSUpdater) mirrorSecondary(ctx context.Context, key recordKey, value string) {
+	name := d.specs[key.Name].Secondary
+	if name == "" {
+		return
+	}
+
+	provider := d.providers[name]
+
+	domain, subdomain, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return
+	}
+
+	if subdomain == "" {
+		subdomain = "@"
+	}
+
+	d.mu.Lock()
+	record, cached := d.secondaryRecords[key]
+	d.mu.Unlock()
+
+	if !cached {
+		record, err = d.findSecondary(ctx, provider, key, domain, subdomain, value)
+		if err != nil {
+			d.secondaryFailed(key, name, err)
+
+			return
+		}
+	}
+
+	// only a configured ttl is mirrored, DDNS_MIN_TTL is left to the primary
+	ttl := d.ttlFor(key.Name)
+	if ttl == record.TTL {
+		ttl = 0
+	}
+
+	if record.Data == value && ttl == 0 {
+		d.secondaryRecovered(key, name)
+
+		return
+	}
+
+	r, err := provider.UpdateRecord(ctx, domain, record.ID, value, ttl)
+	if err != nil {
+		d.audit(key, name, AuditFailed, record.ID, record.Data, value, err)
+
+		// looked up again on the next write
+		d.mu.Lock()
+		delete(d.secondaryRecords, key)
+		d.mu.Unlock()
+
+		d.secondaryFailed(key, name, fmt.Errorf("error while updating secondary record: %v", err))
+
+		return
+	}
+
+	d.logger.Info("secondary record updated", "provider", name, "domain", domain, "name", subdomain, "record_id", r.ID, "old_ip", record.Data, "new_ip", r.Data)
+
+	d.audit(key, name, AuditUpdated, r.ID, record.Data, r.Data, nil)
+
+	d.mu.Lock()
+	d.secondaryRecords[key] = r
+	d.mu.Unlock()
+
+	d.secondaryRecovered(key, name)
+}
+
+// findSecondary looks up the record of key at the secondary provider, creating
+// it with value when DDNS_CREATE_MISSING is set and it doesn't exist.
+func (d *DDNSUpdater) findSecondary(ctx context.Context, provider Provider, key recordKey, domain, subdomain, value string) (Record, error) {
+	records, err := provider.FindRecords(ctx, domain, key.Type, subdomain)
+	if err == nil {
+		return records[0], nil
+	}
+
+	if !errors.Is(err, ErrRecordNotFound) || !d.createMissing {
+		return Record{}, fmt.Errorf("unable to fetch secondary records. domain=%s name=%s: %v", domain, subdomain, err)
+	}
+
+	created, err := provider.CreateRecord(ctx, domain, Record{Type: key.Type, Name: subdomain, Data: value, TTL: d.ttlFor(key.Name)})
+	if err != nil {
+		err = fmt.Errorf("error while creating secondary record: %v", err)
+		d.audit(key, d.specs[key.Name].Secondary, AuditFailed, "", "", value, err)
+
+		return Record{}, err
+	}
+
+	d.logger.Info("secondary record created", "domain", domain, "name", subdomain, "record_id", created.ID, "new_ip", created.Data)
+
+	d.audit(key, d.specs[key.Name].Secondary, AuditCreated, created.ID, "", created.Data, nil)
+
+	d.mu.Lock()
+	d.secondaryRecords[key] = created
+	d.mu.Unlock()
+
+	return created, nil
+}
+
+// secondaryFailed logs a failed write of the secondary record of key at the
+// provider name, flags key so the next check retries it, and alerts once it
+// failed the failure threshold of times in a row.
+func (d *DDNSUpdater) secondaryFailed(key recordKey, name string, err error) {
+	d.mu.Lock()
+	d.secondaryFailures[key]++
+	count := d.secondaryFailures[key]
+	d.recheck[key] = true
+	d.mu.Unlock()
+
+	d.logger.Warn("unable to update secondary record, primary is unaffected", "record", key.String(), "provider", name, "failures", count, "error", err)
+
+	if d.failureThreshold <= 0 || count != d.failureThreshold {
+		return
+	}
+
+	d.notifyFailure(failureEvent{
+		Event:      FailureEventFailing,
+		Domain:     key.Name,
+		RecordType: key.Type,
+		Provider:   name,
+		Failures:   count,
+		LastError:  err.Error(),
+		Timestamp:  time.Now(),
+	})
+}
+
+// secondaryRecovered resets the failure count of the secondary record of key,
+// reporting the recovery when an alert was sent for the streak.
+func (d *DDNSUpdater) secondaryRecovered(key recordKey, name string) {
+	d.mu.Lock()
+	count := d.secondaryFailures[key]
+	delete(d.secondaryFailures, key)
+	d.mu.Unlock()
+
+	if count > 0 {
+		d.logger.Info("secondary record recovered", "record", key.String(), "provider", name, "failures", count)
+	}
+
+	if d.failureThreshold <= 0 || count < d.failureThreshold {
+		return
+	}
+
+	d.notifyFailure(failureEvent{
+		Event:      FailureEventRecovered,
+		Domain:     key.Name,
+		RecordType: key.Type,
+		Provider:   name,
+		Failures:   count,
+		Timestamp:  time.Now(),
+	})
+}
@@ -0,0 +1,209 @@
+package ddns
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// SourcePenaltyHalfLife is how long it takes the penalty of a failure to
+	// halve, so a source that recovered moves back up over time.
+	SourcePenaltyHalfLife = 10 * time.Minute
+
+	// sourcePenaltyFloor is the penalty below which a source counts as
+	// healthy again and falls back to its configured position.
+	sourcePenaltyFloor = 0.1
+)
+
+// SourceScore is the health of an ip provider for a record type, as served at
+// /status.
+type SourceScore struct {
+	URL string `json:"url"`
+	// grows by one with every failure and decays with SourcePenaltyHalfLife,
+	// zero for a healthy source
+	Penalty float64 `json:"penalty"`
+}
+
+// sourceScorer orders the ip providers by how reliable they have been lately:
+// every failure adds to a penalty that decays over time and is halved by a
+// success, and sources are tried from the lowest penalty up, falling back to
+// the configured order between equals. It is safe for concurrent use.
+type sourceScorer struct {
+	mu sync.Mutex
+	// record type: url: penalty as of updated
+	penalties map[string]map[string]float64
+	updated   map[string]map[string]time.Time
+}
+
+func newSourceScorer() *sourceScorer {
+	return &sourceScorer{
+		penalties: map[string]map[string]float64{},
+		updated:   map[string]map[string]time.Time{},
+	}
+}
+
+// penalty returns the decayed penalty of u for recType as of now. It is called
+// with mu held.
+func (s *sourceScorer) penalty(recType, u string, now time.Time) float64 {
+	p := s.penalties[recType][u]
+	if p == 0 {
+		return 0
+	}
+
+	p *= math.Pow(0.5, float64(now.Sub(s.updated[recType][u]))/float64(SourcePenaltyHalfLife))
+	if p < sourcePenaltyFloor {
+		return 0
+	}
+
+	return p
+}
+
+func (s *sourceScorer) set(recType, u string, penalty float64, now time.Time) {
+	if s.penalties[recType] == nil {
+		s.penalties[recType] = map[string]float64{}
+		s.updated[recType] = map[string]time.Time{}
+	}
+
+	s.penalties[recType][u] = penalty
+	s.updated[recType][u] = now
+}
+
+// Order returns urls sorted by their penalty for recType, without modifying
+// urls.
+func (s *sourceScorer) Order(recType string, urls []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	penalties := make(map[string]float64, len(urls))
+
+	for _, u := range urls {
+		penalties[u] = s.penalty(recType, u, now)
+	}
+
+	ordered := append([]string{}, urls...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return penalties[ordered[i]] < penalties[ordered[j]]
+	})
+
+	return ordered
+}
+
+// Succeeded halves the penalty of u for recType.
+func (s *sourceScorer) Succeeded(recType, u string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.set(recType, u, s.penalty(recType, u, now)/2, now)
+}
+
+// Failed adds one to the penalty of u for recType.
+func (s *sourceScorer) Failed(recType, u string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.set(recType, u, s.penalty(recType, u, now)+1, now)
+}
+
+// Scores returns the current order of urls for every record type with a
+// penalized source, for the status endpoint.
+func (s *sourceScorer) Scores(urls []string) map[string][]SourceScore {
+	s.mu.Lock()
+	recTypes := make([]string, 0, len(s.penalties))
+	for recType := range s.penalties {
+		recTypes = append(recTypes, recType)
+	}
+	s.mu.Unlock()
+
+	scores := map[string][]SourceScore{}
+
+	for _, recType := range recTypes {
+		ordered := s.Order(recType, urls)
+
+		s.mu.Lock()
+		now := time.Now()
+		for _, u := range ordered {
+			scores[recType] = append(scores[recType], SourceScore{URL: u, Penalty: math.Round(s.penalty(recType, u, now)*100) / 100})
+		}
+		s.mu.Unlock()
+	}
+
+	return scores
+}
+
+// dualAnswers keeps the address of the record type not asked for from the
+// responses of dual ip providers, by url, so the check of that type later in
+// the same cycle uses it instead of requesting the provider again. It is safe
+// for concurrent use.
+type dualAnswers struct {
+	mu    sync.Mutex
+	cycle string
+	// url: record type: address
+	answers map[string]map[string]string
+}
+
+// Store keeps address as the answer of u for recType in cycle.
+func (a *dualAnswers) Store(cycle, u, recType, address string) {
+	if cycle == "" {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.cycle != cycle {
+		a.cycle = cycle
+		a.answers = map[string]map[string]string{}
+	}
+
+	if a.answers[u] == nil {
+		a.answers[u] = map[string]string{}
+	}
+
+	a.answers[u][recType] = address
+}
+
+// Take returns and forgets the answer of u for recType kept in cycle.
+func (a *dualAnswers) Take(cycle, u, recType string) (string, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if cycle == "" || a.cycle != cycle {
+		return "", false
+	}
+
+	address, ok := a.answers[u][recType]
+	delete(a.answers[u], recType)
+
+	return address, ok
+}
+
+// dualField returns the address of recType from the JSON response body of the
+// dual ip provider at u, and keeps that of the other type for the rest of the
+// cycle.
+func (d *DDNSUpdater) dualField(body []byte, recType, u string) (string, error) {
+	other := "AAAA"
+	if recType == "AAAA" {
+		other = "A"
+	}
+
+	// a provider without an address of the other type fails its own check
+	if address, err := jsonField(body, d.dualFields[other]); err == nil {
+		d.dual.Store(d.cycleID(), u, other, address)
+	}
+
+	return jsonField(body, d.dualFields[recType])
+}
+
+// cycleID returns the id of the cycle in progress, empty outside of one.
+func (d *DDNSUpdater) cycleID() string {
+	if d.cycle == nil {
+		return ""
+	}
+
+	return d.cycle.CycleID
+}
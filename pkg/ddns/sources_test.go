@@ -0,0 +1,133 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dualServer serves body as the JSON answer of a dual ip provider and counts
+// the requests.
+func dualServer(t *testing.T, body string) (*atomic.Int32, string) {
+	t.Helper()
+
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+
+	return &requests, srv.URL
+}
+
+func TestDualFormat(t *testing.T) {
+	p := newMemProvider()
+	a := p.Add("example.com", "A", "home", "8.8.4.4")
+	aaaa := p.Add("example.com", "AAAA", "home", "2001:4860::8844")
+
+	// the provider only listens on IPv4, so the AAAA address comes from the A check
+	requests, url := dualServer(t, `{"ipv4": "8.8.8.8", "ipv6": "2001:4860::8888"}`)
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_RECORD_TYPES": "A,AAAA", "DDNS_CHECKIP_FORMAT": "dual"}, p)
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := p.Data("example.com", a); got != "8.8.8.8" {
+		t.Errorf("A record holds %s, want 8.8.8.8", got)
+	}
+
+	if got := p.Data("example.com", aaaa); got != "2001:4860::8888" {
+		t.Errorf("AAAA record holds %s, want 2001:4860::8888", got)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("made %d requests to the ip provider, want 1 for both types", got)
+	}
+
+	// the next cycle asks again
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("made %d requests to the ip provider after two cycles, want 2", got)
+	}
+}
+
+func TestDualFormatFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		env     map[string]string
+		recType string
+		want    string
+		wantErr string
+	}{
+		{name: "ipv4", body: `{"ipv4": "8.8.8.8", "ipv6": "2001:4860::8888"}`, recType: "A", want: "8.8.8.8"},
+		{name: "custom fields", body: `{"client": {"v4": "8.8.8.8", "v6": "2001:4860::8888"}}`, env: map[string]string{"DDNS_CHECKIP_IPV4_FIELD": "client.v4", "DDNS_CHECKIP_IPV6_FIELD": "client.v6"}, recType: "A", want: "8.8.8.8"},
+		{name: "ipv4 field of the wrong family", body: `{"ipv4": "2001:4860::8888", "ipv6": "2001:4860::8888"}`, recType: "A", wantErr: "all ip providers failed"},
+		{name: "missing ipv4 field", body: `{"ipv6": "2001:4860::8888"}`, recType: "A", wantErr: `field "ipv4" not found`},
+		{name: "null ipv4 field", body: `{"ipv4": null, "ipv6": "2001:4860::8888"}`, recType: "A", wantErr: `field "ipv4" of response is not a string`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, url := dualServer(t, tt.body)
+
+			env := map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_CHECKIP_FORMAT": "dual", "DDNS_CHECKIP_RETRIES": "0"}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+
+			d := newTestUpdater(t, env, newMemProvider())
+
+			got, err := d.CheckIP(context.Background(), tt.recType)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("CheckIP error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("CheckIP: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("CheckIP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDualFormatWrongFamily(t *testing.T) {
+	p := newMemProvider()
+	a := p.Add("example.com", "A", "home", "8.8.4.4")
+	aaaa := p.Add("example.com", "AAAA", "home", "2001:4860::8844")
+
+	// an IPv4 address in the ipv6 field fails the AAAA check only
+	_, url := dualServer(t, `{"ipv4": "8.8.8.8", "ipv6": "8.8.8.8"}`)
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": url, "DDNS_RECORD_TYPES": "A,AAAA", "DDNS_CHECKIP_FORMAT": "dual", "DDNS_CHECKIP_RETRIES": "0"}, p)
+
+	err := runTestCycle(d)
+	if err == nil || !strings.Contains(err.Error(), "all ip providers failed") {
+		t.Errorf("cycle error = %v, want the AAAA check to fail", err)
+	}
+
+	if got := p.Data("example.com", a); got != "8.8.8.8" {
+		t.Errorf("A record holds %s, want 8.8.8.8", got)
+	}
+
+	if got := p.Data("example.com", aaaa); got != "2001:4860::8844" {
+		t.Errorf("AAAA record holds %s, want it left as is", got)
+	}
+}
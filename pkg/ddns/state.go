@@ -0,0 +1,160 @@
+package ddns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StateStore persists the last confirmed IP of each record type, selected by
+// DDNS_STATE_BACKEND.
+type StateStore interface {
+	// Load returns the last confirmed IPs by record type, none without prior
+	// state.
+	Load() (map[string]net.IP, error)
+	// Save replaces them by ips, confirmed at ts.
+	Save(ips map[string]net.IP, ts time.Time) error
+}
+
+// newBoltStateStore opens the bolt database at path, only set in builds with
+// the bolt tag.
+var newBoltStateStore func(path string) (StateStore, error)
+
+// newStateStore returns the store of cfg.StateBackend, nil for the JSON
+// default without a DDNS_STATE_FILE.
+func newStateStore(cfg *Config) (StateStore, error) {
+	switch cfg.StateBackend {
+	case StateBackendMemory:
+		return &memoryStateStore{ips: map[string]net.IP{}}, nil
+	case StateBackendBolt:
+		if newBoltStateStore == nil {
+			return nil, fmt.Errorf("DDNS_STATE_BACKEND=bolt requires a build with the bolt tag")
+		}
+
+		return newBoltStateStore(cfg.StateFile)
+	}
+
+	if cfg.StateFile == "" {
+		return nil, nil
+	}
+
+	return jsonStateStore{path: cfg.StateFile}, nil
+}
+
+// jsonStateStore keeps the state in a JSON file.
+type jsonStateStore struct {
+	path string
+}
+
+func (s jsonStateStore) Load() (map[string]net.IP, error) { return readStateFile(s.path) }
+
+func (s jsonStateStore) Save(ips map[string]net.IP, ts time.Time) error {
+	return writeStateFile(s.path, ips, ts)
+}
+
+// memoryStateStore keeps the state for the lifetime of the process only.
+type memoryStateStore struct {
+	mu  sync.Mutex
+	ips map[string]net.IP
+}
+
+func (s *memoryStateStore) Load() (map[string]net.IP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return maps.Clone(s.ips), nil
+}
+
+func (s *memoryStateStore) Save(ips map[string]net.IP, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ips = maps.Clone(ips)
+
+	return nil
+}
+
+// savedState is the last confirmed IP of each record type, persisted so a
+// restart doesn't rewrite records that already hold it.
+type savedState struct {
+	IPs     map[string]string `json:"ips"`
+	Updated time.Time         `json:"updated"`
+}
+
+// readStateFile reads the last confirmed IPs by record type. A missing file
+// is no prior state.
+func readStateFile(path string) (map[string]net.IP, error) {
+	ips := map[string]net.IP{}
+
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ips, nil
+	}
+
+	if err != nil {
+		return ips, err
+	}
+
+	var state savedState
+
+	err = json.Unmarshal(contents, &state)
+	if err != nil {
+		return ips, fmt.Errorf("unable to parse state file %s: %w", path, err)
+	}
+
+	for recType, address := range state.IPs {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return map[string]net.IP{}, fmt.Errorf("invalid %s address %q in state file %s", recType, address, path)
+		}
+
+		ips[recType] = ip
+	}
+
+	return ips, nil
+}
+
+// writeStateFile persists ips as the last confirmed IPs at ts. The state is
+// written to a temporary file next to path and renamed over it, so a crash
+// mid-write keeps the previous state.
+func writeStateFile(path string, ips map[string]net.IP, ts time.Time) error {
+	state := savedState{IPs: map[string]string{}, Updated: ts}
+	for recType, ip := range ips {
+		state.IPs[recType] = ip.String()
+	}
+
+	contents, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	// a no-op once renamed
+	defer os.Remove(f.Name())
+
+	// CreateTemp makes it readable by the owner only
+	err = f.Chmod(0o644)
+	if err == nil {
+		_, err = f.Write(contents)
+	}
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err := errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,101 @@
+package ddns
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateBackends(t *testing.T) {
+	tests := []struct {
+		name string
+		env  func(t *testing.T) map[string]string
+		// whether a new updater starts from the confirmed ip
+		persisted bool
+	}{
+		{name: "json", env: func(t *testing.T) map[string]string {
+			return map[string]string{"DDNS_STATE_FILE": filepath.Join(t.TempDir(), "state.json")}
+		}, persisted: true},
+		{name: "memory", env: func(t *testing.T) map[string]string {
+			return map[string]string{"DDNS_STATE_BACKEND": StateBackendMemory}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newMemProvider()
+			p.Add("example.com", "A", "home", "8.8.4.4")
+
+			_, url := newTestIP(t, "8.8.8.8")
+			env := tt.env(t)
+			env["DDNS_IP_PROVIDER"] = url
+
+			d := startTestUpdater(t, env, p)
+
+			if err := runTestCycle(d); err != nil {
+				t.Fatalf("cycle: %v", err)
+			}
+
+			saved, err := d.state.Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+
+			if got := saved["A"].String(); got != "8.8.8.8" {
+				t.Errorf("stored A address = %s, want 8.8.8.8", got)
+			}
+
+			restarted := newTestUpdater(t, env, p)
+
+			got := restarted.currentIPs["A"]
+			if tt.persisted && got.String() != "8.8.8.8" {
+				t.Errorf("restarted with A address %v, want 8.8.8.8", got)
+			}
+
+			if !tt.persisted && got != nil {
+				t.Errorf("restarted with A address %v, want none kept across restarts", got)
+			}
+		})
+	}
+}
+
+func TestWriteStateFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, ip := range []string{"8.8.4.4", "8.8.8.8"} {
+		if err := writeStateFile(path, map[string]net.IP{"A": net.ParseIP(ip)}, time.Now()); err != nil {
+			t.Fatalf("writeStateFile: %v", err)
+		}
+	}
+
+	saved, err := readStateFile(path)
+	if err != nil {
+		t.Fatalf("readStateFile: %v", err)
+	}
+
+	if got := saved["A"].String(); got != "8.8.8.8" {
+		t.Errorf("stored A address = %s, want the last one written, 8.8.8.8", got)
+	}
+
+	// the temporary file was renamed over the state
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("state dir holds %v, want only state.json", entries)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("state file mode = %v, want 0644", mode)
+	}
+}
@@ -0,0 +1,44 @@
+package ddns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// statsdClient emits counters to a StatsD or DogStatsD endpoint over UDP.
+// A nil client discards everything, so callers don't need to check whether
+// StatsD is configured.
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	tags   []string
+}
+
+// newStatsdClient connects to addr. Tags are "key:value" pairs sent with every
+// metric using the DogStatsD tag extension.
+func newStatsdClient(addr, prefix string, tags []string) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to statsd at %s: %w", addr, err)
+	}
+
+	return &statsdClient{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// Incr increments a counter. Extra tags are added to the configured ones.
+func (s *statsdClient) Incr(name string, tags ...string) {
+	if s == nil {
+		return
+	}
+
+	packet := s.prefix + name + ":1|c"
+
+	all := append(append([]string{}, s.tags...), tags...)
+	if len(all) > 0 {
+		packet += "|#" + strings.Join(all, ",")
+	}
+
+	// UDP is fire-and-forget; a missing listener must never block a cycle
+	_, _ = s.conn.Write([]byte(packet))
+}
@@ -0,0 +1,135 @@
+package ddns
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/digitalocean/godo"
+)
+
+// listenStatsd starts a UDP listener standing in for a StatsD server.
+func listenStatsd(t *testing.T) net.PacketConn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// readPackets returns the packets received by conn until none arrived for a
+// moment.
+func readPackets(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+
+	packets := []string{}
+	buf := make([]byte, 1500)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func TestStatsdIncr(t *testing.T) {
+	conn := listenStatsd(t)
+
+	client, err := newStatsdClient(conn.LocalAddr().String(), "ddns.", []string{"env:home"})
+	if err != nil {
+		t.Fatalf("newStatsdClient: %v", err)
+	}
+
+	client.Incr("checks")
+	client.Incr("record_updates", "result:success")
+
+	got := readPackets(t, conn)
+	want := []string{"ddns.checks:1|c|#env:home", "ddns.record_updates:1|c|#env:home,result:success"}
+
+	if len(got) != len(want) {
+		t.Fatalf("packets %q, want %q", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("packet %q, want %q", got[i], want[i])
+		}
+	}
+}
+
+func TestStatsdWithoutTags(t *testing.T) {
+	conn := listenStatsd(t)
+
+	client, err := newStatsdClient(conn.LocalAddr().String(), "", nil)
+	if err != nil {
+		t.Fatalf("newStatsdClient: %v", err)
+	}
+
+	client.Incr("checks")
+
+	if got := readPackets(t, conn); len(got) != 1 || got[0] != "checks:1|c" {
+		t.Errorf("packets %q, want checks:1|c", got)
+	}
+}
+
+func TestStatsdNil(t *testing.T) {
+	var client *statsdClient
+
+	// discards without a configured endpoint
+	client.Incr("checks")
+}
+
+func TestStatsdWithoutListener(t *testing.T) {
+	conn := listenStatsd(t)
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	client, err := newStatsdClient(addr, "ddns.", nil)
+	if err != nil {
+		t.Fatalf("newStatsdClient: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		client.Incr("checks")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("emitting to a missing listener took %s, want it never to block", elapsed)
+	}
+}
+
+func TestStatsdCycle(t *testing.T) {
+	conn := listenStatsd(t)
+
+	domains := newFakeDomains(godo.DomainRecord{ID: 1, Type: "A", Name: "home", Data: "8.8.4.4"})
+
+	_, ipURL := newTestIP(t, "8.8.8.8")
+
+	d := startTestUpdater(t, map[string]string{"DDNS_IP_PROVIDER": ipURL, "DDNS_STATSD_ADDR": conn.LocalAddr().String(), "DDNS_STATSD_TAGS": "host:nas"}, newOfflineDO(domains))
+
+	if err := runTestCycle(d); err != nil {
+		t.Fatalf("cycle: %v", err)
+	}
+
+	got := readPackets(t, conn)
+	sort.Strings(got)
+
+	want := []string{"ddns.checks:1|c|#host:nas", "ddns.record_updates:1|c|#host:nas,result:success"}
+	for _, packet := range want {
+		i := sort.SearchStrings(got, packet)
+		if i == len(got) || got[i] != packet {
+			t.Errorf("no packet %q in %q", packet, got)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ddns
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Status is a snapshot of what the updater currently believes, served at
+// /status.
+type Status struct {
+	// record type: current ip
+	IPs map[string]string `json:"ips"`
+	// when a detected ip was last written to the records, even if some
+	// writes failed, zero before that
+	LastSet time.Time `json:"last_set"`
+	// end of the last check after which every record held the current ip,
+	// zero before that
+	LastSuccess time.Time `json:"last_success"`
+	// seconds since LastSuccess, or since startup before the first success,
+	// as of the request
+	StalenessSeconds float64   `json:"staleness_seconds"`
+	LastCheck        time.Time `json:"last_check"`
+	// how long the last check took, from detecting the ip to the last
+	// record write, 0 before the first check
+	LastCheckDurationSeconds float64   `json:"last_check_duration_seconds"`
+	NextCheck                time.Time `json:"next_check"`
+	// when DDNS_RECONCILE_INTERVAL last re-synced the records, zero before
+	// that or when reconciling is off
+	LastReconcile time.Time `json:"last_reconcile"`
+	// nil before the first cycle
+	LastCycle *CycleResult   `json:"last_cycle"`
+	Records   []RecordStatus `json:"records"`
+	// state of the failed cycle breaker, see DDNS_BREAKER_THRESHOLD
+	Breaker string `json:"breaker"`
+	// when an open breaker probes, omitted unless it is open
+	BreakerUntil *time.Time `json:"breaker_until,omitempty"`
+	// record type: ip providers in the order they are tried next, omitted
+	// before the first check
+	IPSources map[string][]SourceScore `json:"ip_sources,omitempty"`
+	// detected ip changes, oldest first, up to DDNS_HISTORY_SIZE
+	History []HistoryEntry `json:"history"`
+}
+
+// RecordStatus is the state of the records managed for a domain and type.
+type RecordStatus struct {
+	Domain string `json:"domain"`
+	Type   string `json:"type"`
+	// empty until a record was synced
+	IDs     []string  `json:"ids"`
+	Data    string    `json:"data"`
+	Updated time.Time `json:"updated,omitempty"`
+	// error of the last failed write, empty once a write succeeds
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Snapshot returns the status published after the latest cycle. It is safe to
+// call from any goroutine.
+func (d *DDNSUpdater) Snapshot() Status {
+	if status := d.status.Load(); status != nil {
+		snapshot := *status
+		snapshot.StalenessSeconds = d.staleness(snapshot.LastSuccess).Seconds()
+
+		return snapshot
+	}
+
+	return Status{IPs: map[string]string{}, Records: []RecordStatus{}, History: []HistoryEntry{}, Breaker: BreakerClosed, StalenessSeconds: d.staleness(time.Time{}).Seconds()}
+}
+
+// staleness returns how long ago lastSuccess was, or how long the updater
+// has run when it is zero.
+func (d *DDNSUpdater) staleness(lastSuccess time.Time) time.Duration {
+	if lastSuccess.IsZero() {
+		lastSuccess = d.started
+	}
+
+	return time.Since(lastSuccess).Truncate(time.Second)
+}
+
+// publishStatus takes a new snapshot for Snapshot. It runs on the run loop,
+// which owns the state it reads.
+func (d *DDNSUpdater) publishStatus() {
+	status := &Status{
+		IPs:                      map[string]string{},
+		LastSet:                  d.lastSet,
+		LastSuccess:              d.lastSuccess,
+		LastCheckDurationSeconds: d.lastCheckDuration.Seconds(),
+		NextCheck:                d.nextCheck,
+		Records:                  []RecordStatus{},
+		IPSources:                d.sources.Scores(d.checkIPURLs),
+		Breaker:                  d.breakerState,
+		History:                  d.history.Entries(),
+	}
+
+	if d.breakerState == BreakerOpen {
+		until := d.breakerUntil
+		status.BreakerUntil = &until
+	}
+
+	for recType, ip := range d.currentIPs {
+		status.IPs[recType] = ip.String()
+	}
+
+	if last := d.lastCheckTime.Load(); last != 0 {
+		status.LastCheck = time.Unix(0, last)
+	}
+
+	if d.cycle != nil {
+		cycle := *d.cycle
+		status.LastCycle = &cycle
+	}
+
+	// workers write records and their update times under mu
+	d.mu.Lock()
+	status.LastReconcile = d.lastReconcile
+
+	for key, record := range d.recordMap {
+		r := RecordStatus{Domain: key.Name, Type: key.Type, IDs: []string{}, Data: record.Data, Updated: d.updatedAt[key], LastError: d.lastErrors[key]}
+
+		if record.ID != "" {
+			r.IDs = append(r.IDs, record.ID)
+		}
+
+		for _, sibling := range d.siblings[key] {
+			r.IDs = append(r.IDs, sibling.ID)
+		}
+
+		status.Records = append(status.Records, r)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(status.Records, func(i, j int) bool {
+		a, b := status.Records[i], status.Records[j]
+
+		return a.Domain < b.Domain || a.Domain == b.Domain && a.Type < b.Type
+	})
+
+	d.status.Store(status)
+}
+
+// ServeStatus runs the status server on addr. It only returns on error.
+func (d *DDNSUpdater) ServeStatus(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", d.handleStatus)
+	mux.HandleFunc("/check", d.handleCheck)
+
+	if d.apiToken != "" {
+		mux.HandleFunc("/set-ip", d.handleSetIP)
+	}
+
+	return http.ListenAndServe(addr, mux)
+}
+
+func (d *DDNSUpdater) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(d.Snapshot())
+}
+
+// handleCheck makes the run loop check every domain right away.
+func (d *DDNSUpdater) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	// a check that is already pending covers this request too
+	select {
+	case d.force <- struct{}{}:
+	default:
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,201 @@
+package ddns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// IPSourceSTUN reads the public IP from a STUN binding request.
+	IPSourceSTUN = "stun"
+
+	// DefaultSTUNServer is used when DDNS_STUN_SERVER is unset.
+	DefaultSTUNServer = "stun.l.google.com:19302"
+	// STUNDefaultPort is used for a STUN server given without a port.
+	STUNDefaultPort = "3478"
+
+	// stunMagicCookie is part of every RFC 5389 message header, and the key
+	// XOR-MAPPED-ADDRESS values are obfuscated with.
+	stunMagicCookie = 0x2112A442
+
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXORMappedAddress = 0x0020
+)
+
+// stunIP asks server for the reflexive address of a binding request sent over
+// the family of recType, so behind a NAT it sees the outermost public address.
+func stunIP(ctx context.Context, server, recType string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	network := "udp4"
+	if recType == "AAAA" {
+		network = "udp6"
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return "", fmt.Errorf("error while connecting to stun server %s: %v", server, err)
+	}
+
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+
+	_, err = rand.Read(request[8:20])
+	if err != nil {
+		return "", err
+	}
+
+	_, err = conn.Write(request)
+	if err != nil {
+		return "", fmt.Errorf("error while sending stun request to %s: %v", server, err)
+	}
+
+	response := make([]byte, 1500)
+
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return "", fmt.Errorf("error while reading stun response from %s: %v", server, err)
+		}
+
+		// a stray datagram that doesn't answer this request is ignored
+		if n < 20 || string(response[8:20]) != string(request[8:20]) {
+			continue
+		}
+
+		ip, err := parseSTUNResponse(response[:n])
+		if err != nil {
+			return "", fmt.Errorf("invalid stun response from %s: %w", server, err)
+		}
+
+		return ip.String(), nil
+	}
+}
+
+// parseSTUNResponse returns the mapped address of a binding response,
+// preferring XOR-MAPPED-ADDRESS over the MAPPED-ADDRESS of older servers.
+func parseSTUNResponse(msg []byte) (net.IP, error) {
+	if binary.BigEndian.Uint16(msg[0:2]) != stunBindingResponse {
+		return nil, fmt.Errorf("unexpected message type 0x%04x", binary.BigEndian.Uint16(msg[0:2]))
+	}
+
+	length := int(binary.BigEndian.Uint16(msg[2:4]))
+	if 20+length > len(msg) {
+		return nil, errors.New("truncated message")
+	}
+
+	var mapped net.IP
+
+	attrs := msg[20 : 20+length]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+
+		if 4+attrLen > len(attrs) {
+			return nil, errors.New("truncated attribute")
+		}
+
+		value := attrs[4 : 4+attrLen]
+
+		switch attrType {
+		case stunAttrXORMappedAddress:
+			ip, err := stunAddress(value)
+			if err != nil {
+				return nil, err
+			}
+
+			// the address is xored with the magic cookie followed by the
+			// transaction id
+			key := msg[4:20]
+			for i := range ip {
+				ip[i] ^= key[i]
+			}
+
+			return ip, nil
+		case stunAttrMappedAddress:
+			ip, err := stunAddress(value)
+			if err != nil {
+				return nil, err
+			}
+
+			mapped = ip
+		}
+
+		// attributes are padded to a multiple of 4 bytes
+		next := 4 + (attrLen+3)&^3
+		if next > len(attrs) {
+			break
+		}
+
+		attrs = attrs[next:]
+	}
+
+	if mapped == nil {
+		return nil, errors.New("no mapped address")
+	}
+
+	return mapped, nil
+}
+
+// stunAddress decodes the address of a (XOR-)MAPPED-ADDRESS value: a reserved
+// byte, the family, the port and the address.
+func stunAddress(value []byte) (net.IP, error) {
+	if len(value) < 4 {
+		return nil, errors.New("truncated address")
+	}
+
+	size := 0
+
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil, fmt.Errorf("unknown address family 0x%02x", value[1])
+	}
+
+	if len(value) < 4+size {
+		return nil, errors.New("truncated address")
+	}
+
+	return append(net.IP{}, value[4:4+size]...), nil
+}
+
+// parseSTUNServer validates a STUN server as host or host:port and adds the
+// default port when it has none.
+func parseSTUNServer(raw string) (string, error) {
+	host, port, err := net.SplitHostPort(raw)
+	if err != nil {
+		host, port = raw, STUNDefaultPort
+	}
+
+	if host == "" || strings.ContainsAny(host, "[]/ ") {
+		return "", fmt.Errorf("expected host or host:port, got %q", raw)
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("expected a port between 1 and 65535, got %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
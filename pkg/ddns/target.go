@@ -0,0 +1,166 @@
+package ddns
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ipTarget derives the address written to the A or AAAA records of a domain
+// from the detected IP of their type.
+type ipTarget interface {
+	Resolve(detected net.IP) (net.IP, error)
+}
+
+// staticTarget always resolves to the same address.
+type staticTarget struct {
+	ip net.IP
+}
+
+func (s staticTarget) Resolve(net.IP) (net.IP, error) {
+	return s.ip, nil
+}
+
+func (s staticTarget) String() string { return "static:" + s.ip.String() }
+
+// offsetTarget adds a signed offset to the detected IP, e.g. +1 for the next
+// address of a routed block.
+type offsetTarget struct {
+	offset int64
+}
+
+func (o offsetTarget) Resolve(detected net.IP) (net.IP, error) {
+	ip := detected.To4()
+	if ip == nil {
+		ip = detected.To16()
+	}
+
+	n := new(big.Int).SetBytes(ip)
+	n.Add(n, big.NewInt(o.offset))
+
+	if n.Sign() < 0 || n.BitLen() > len(ip)*8 {
+		return nil, fmt.Errorf("offset %+d leaves the address space from %s", o.offset, detected)
+	}
+
+	return n.FillBytes(make(net.IP, len(ip))), nil
+}
+
+func (o offsetTarget) String() string { return fmt.Sprintf("offset:%+d", o.offset) }
+
+// hostTarget keeps the network prefix of the detected IP and replaces the
+// host bits, e.g. ::10/64 for a fixed interface id in a delegated prefix.
+type hostTarget struct {
+	host net.IP
+	mask net.IPMask
+}
+
+func (h hostTarget) Resolve(detected net.IP) (net.IP, error) {
+	ip := detected.To4()
+	if ip == nil {
+		ip = detected.To16()
+	}
+
+	if len(ip) != len(h.host) {
+		return nil, fmt.Errorf("host %s is not of the family of %s", h.host, detected)
+	}
+
+	resolved := make(net.IP, len(ip))
+	for i := range ip {
+		resolved[i] = ip[i]&h.mask[i] | h.host[i]&^h.mask[i]
+	}
+
+	return resolved, nil
+}
+
+func (h hostTarget) String() string {
+	ones, _ := h.mask.Size()
+
+	return fmt.Sprintf("host:%s/%d", h.host, ones)
+}
+
+// parseTargets parses the target option of a domain: either "detected", the
+// default of writing the detected IP, or ";" separated rules, each applying to
+// the record types it names an address of:
+//
+//	static:192.0.2.10    the address itself
+//	offset:+1            the detected IP plus the offset, for A and AAAA
+//	host:::10/64         the first 64 bits of the detected IP, the rest of ::10
+//
+// It returns the rule of every record type with one.
+func parseTargets(raw string) (map[string]ipTarget, error) {
+	targets := map[string]ipTarget{}
+
+	if strings.TrimSpace(raw) == "detected" {
+		return targets, nil
+	}
+
+	for _, rule := range strings.Split(raw, ";") {
+		kind, value, _ := strings.Cut(strings.TrimSpace(rule), ":")
+
+		var target ipTarget
+
+		recTypes := []string{}
+
+		switch kind {
+		case "static":
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("static: expected an address, got %q", value)
+			}
+
+			target = staticTarget{ip: ip}
+			recTypes = append(recTypes, overrideType(ip))
+		case "offset":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || offset == 0 {
+				return nil, fmt.Errorf("offset: expected a non-zero number, got %q", value)
+			}
+
+			target = offsetTarget{offset: offset}
+			recTypes = append(recTypes, "A", "AAAA")
+		case "host":
+			ip, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("host: expected an address with a prefix length, e.g. ::10/64, got %q", value)
+			}
+
+			host := ip.To4()
+			if host == nil {
+				host = ip.To16()
+			}
+
+			target = hostTarget{host: host, mask: network.Mask}
+			recTypes = append(recTypes, overrideType(ip))
+		default:
+			return nil, fmt.Errorf("unknown target %q, expected detected, static:<ip>, offset:<n> or host:<ip>/<bits>", rule)
+		}
+
+		for _, recType := range recTypes {
+			if targets[recType] != nil {
+				return nil, fmt.Errorf("%s records have two targets, %s and %s", recType, targets[recType], target)
+			}
+
+			targets[recType] = target
+		}
+	}
+
+	return targets, nil
+}
+
+// targetIP returns the address the recType records of the domain name hold
+// when ip is detected: ip itself unless the domain has a target for recType.
+func (d *DDNSUpdater) targetIP(name, recType string, ip net.IP) (net.IP, error) {
+	target := d.specs[name].targets[recType]
+	if target == nil || ip == nil {
+		return ip, nil
+	}
+
+	resolved, err := target.Resolve(ip)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve the target of %s/%s: %w", name, recType, err)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,184 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Validate checks cfg as a whole: the credentials of every provider in use,
+// the domains, intervals and record types, the webhook and the options that
+// depend on or exclude each other. LoadConfig only rejects values it can't
+// parse, so every problem found here is reported at once, joined into one
+// error.
+func (cfg *Config) Validate() error {
+	errs := []error{}
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	providers := map[string]bool{}
+
+	if !isProvider(cfg.Provider) {
+		add("DDNS_PROVIDER: unknown provider %q", cfg.Provider)
+	} else {
+		providers[cfg.Provider] = true
+	}
+
+	if cfg.Interval <= 0 {
+		add("DDNS_INTERVAL: expected a positive duration, got %s", cfg.Interval)
+	} else if cfg.Interval < cfg.MinInterval {
+		add("DDNS_INTERVAL of %s is below the minimum of %s, lower DDNS_MIN_INTERVAL to allow it", cfg.Interval, cfg.MinInterval)
+	}
+
+	if cfg.IntervalJitter < 0 || cfg.IntervalJitter > cfg.Interval {
+		add("DDNS_INTERVAL_JITTER of %s is not between 0 and the interval", cfg.IntervalJitter)
+	}
+
+	for _, recType := range cfg.RecordTypes {
+		if !isIPType(recType) {
+			add("DDNS_RECORD_TYPES: unsupported record type %q", recType)
+		}
+	}
+
+	if len(cfg.Domains) == 0 {
+		add("DDNS_DOMAINS or DDNS_DOMAINS_FILE is required")
+	}
+
+	for _, spec := range cfg.Domains {
+		if strings.TrimSpace(spec.Name) == "" {
+			add("DDNS_DOMAINS: a domain has no name")
+
+			continue
+		}
+
+		if spec.Interval < 0 || spec.Interval > 0 && spec.Interval < cfg.MinInterval {
+			add("domain %s: interval of %s is below the minimum of %s, lower DDNS_MIN_INTERVAL to allow it", spec.Name, spec.Interval, cfg.MinInterval)
+		}
+
+		for _, recType := range spec.Types {
+			if !isIPType(recType) && recType != "TXT" && recType != "CNAME" {
+				add("domain %s: unsupported record type %q", spec.Name, recType)
+			}
+		}
+
+		provider := cfg.Provider
+		if spec.Provider != "" {
+			provider = spec.Provider
+		}
+
+		if cfg.providerType(provider) == "" {
+			add("domain %s: unknown provider %q", spec.Name, provider)
+		} else {
+			providers[provider] = true
+		}
+
+		switch {
+		case spec.Secondary == "":
+		case cfg.providerType(spec.Secondary) == "":
+			add("domain %s: unknown secondary provider %q", spec.Name, spec.Secondary)
+		case spec.Secondary == provider:
+			add("domain %s: secondary provider %s is its primary provider", spec.Name, spec.Secondary)
+		default:
+			providers[spec.Secondary] = true
+		}
+	}
+
+	names := []string{}
+	for name := range cfg.Credentials {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		set := cfg.Credentials[name]
+
+		switch {
+		case isProvider(name):
+			add("credentials %s: the name of a provider can't name a credential set", name)
+		case !isProvider(set.Provider):
+			add("credentials %s: unknown provider %q", name, set.Provider)
+		case set.Provider != ProviderRoute53 && set.Token == "" && providers[name]:
+			add("credentials %s: token or token_file is required by the %s provider", name, set.Provider)
+		}
+	}
+
+	// route53 takes its credentials from the AWS environment
+	if providers[ProviderDigitalOcean] && cfg.DOToken == "" {
+		add("DDNS_DO_API_TOKEN or DDNS_DO_API_TOKEN_FILE is required by the digitalocean provider")
+	}
+
+	if providers[ProviderCloudflare] && cfg.CFToken == "" {
+		add("DDNS_CF_API_TOKEN is required by the cloudflare provider")
+	}
+
+	if cfg.WebhookURL != "" {
+		if u, err := url.Parse(cfg.WebhookURL); err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			add("DDNS_WEBHOOK_URL: expected an http:// or https:// URL")
+		}
+	}
+
+	if cfg.Notify != NotifyWebhook && cfg.Notify != NotifySlack && cfg.Notify != NotifyDiscord {
+		add("DDNS_NOTIFY: unsupported format %q, expected %q, %q or %q", cfg.Notify, NotifyWebhook, NotifySlack, NotifyDiscord)
+	} else if cfg.Notify != NotifyWebhook && cfg.WebhookURL == "" {
+		add("DDNS_NOTIFY=%s requires DDNS_WEBHOOK_URL", cfg.Notify)
+	}
+
+	if cfg.WebhookSecret != "" && cfg.WebhookURL == "" {
+		add("DDNS_WEBHOOK_SECRET requires DDNS_WEBHOOK_URL")
+	}
+
+	if cfg.IPConsensus && len(cfg.CheckIPURLs) < 2 {
+		add("DDNS_IP_CONSENSUS requires at least two ip providers in DDNS_CHECKIP_URLS")
+	}
+
+	if (cfg.IPSource == IPSourceInterface || cfg.IPSource == IPSourceAuto) && cfg.Interface == "" {
+		add("DDNS_IP_SOURCE=%s requires DDNS_INTERFACE", cfg.IPSource)
+	}
+
+	if cfg.IPSource == IPSourceExternal && cfg.IPFile == "" && cfg.APIToken == "" {
+		add("DDNS_IP_SOURCE=external requires DDNS_IP_FILE or DDNS_API_TOKEN to push the ip with")
+	}
+
+	if cfg.IPSource == IPSourceFile && cfg.IPFile == "" {
+		add("DDNS_IP_SOURCE=file requires DDNS_IP_FILE")
+	}
+
+	if cfg.IPSource == IPSourceExternal && cfg.CheckReachability {
+		add("DDNS_CHECK_REACHABILITY can't be combined with DDNS_IP_SOURCE=external, which never requests the ip providers")
+	}
+
+	if cfg.StateBackend == StateBackendBolt && cfg.StateFile == "" {
+		add("DDNS_STATE_BACKEND=bolt requires DDNS_STATE_FILE")
+	}
+
+	if cfg.StateBackend == StateBackendBolt && newBoltStateStore == nil {
+		add("DDNS_STATE_BACKEND=bolt requires a build with the bolt tag")
+	}
+
+	if cfg.StateBackend == StateBackendMemory && cfg.StateFile != "" {
+		add("DDNS_STATE_FILE can't be combined with DDNS_STATE_BACKEND=memory, which keeps no file")
+	}
+
+	if cfg.LazySync && cfg.RequireAllDomains {
+		add("DDNS_LAZY_SYNC can't be combined with DDNS_REQUIRE_ALL_DOMAINS, which needs the initial sync")
+	}
+
+	if cfg.BreakerThreshold > 0 && cfg.BreakerInterval <= cfg.Interval {
+		add("DDNS_BREAKER_INTERVAL of %s must be longer than DDNS_INTERVAL to slow down checks", cfg.BreakerInterval)
+	}
+
+	if cfg.APIToken != "" && cfg.StatusAddr == "" {
+		add("DDNS_API_TOKEN needs DDNS_STATUS_ADDR, which serves POST /set-ip")
+	}
+
+	return errors.Join(errs...)
+}
+
+// isProvider reports whether name is a supported provider.
+func isProvider(name string) bool {
+	return name == ProviderDigitalOcean || name == ProviderCloudflare || name == ProviderRoute53
+}
@@ -0,0 +1,19 @@
+//go:build !bolt
+// +build !bolt
+
+package ddns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateBoltWithoutTag(t *testing.T) {
+	cfg := loadTestConfig(t, nil)
+	cfg.StateBackend = StateBackendBolt
+	cfg.StateFile = "state.db"
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "requires a build with the bolt tag") {
+		t.Errorf("Validate error = %v, want the bolt tag to be required", err)
+	}
+}
@@ -0,0 +1,87 @@
+package ddns
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   string
+	}{
+		{name: "valid", change: func(cfg *Config) {}},
+		{name: "no token", change: func(cfg *Config) { cfg.DOToken = "" }, want: "DDNS_DO_API_TOKEN or DDNS_DO_API_TOKEN_FILE is required"},
+		{name: "route53 needs no token", change: func(cfg *Config) { cfg.DOToken = ""; cfg.Provider = ProviderRoute53 }},
+		{name: "cloudflare token", change: func(cfg *Config) { cfg.Provider = ProviderCloudflare }, want: "DDNS_CF_API_TOKEN is required"},
+		{name: "token of a domain's provider", change: func(cfg *Config) { cfg.Domains[0].Provider = ProviderCloudflare }, want: "DDNS_CF_API_TOKEN is required"},
+		{name: "no domains", change: func(cfg *Config) { cfg.Domains = nil }, want: "DDNS_DOMAINS or DDNS_DOMAINS_FILE is required"},
+		{name: "blank domain", change: func(cfg *Config) { cfg.Domains = []DomainSpec{{Name: " "}} }, want: "a domain has no name"},
+		{name: "no interval", change: func(cfg *Config) { cfg.Interval = 0 }, want: "DDNS_INTERVAL: expected a positive duration"},
+		{name: "interval below the minimum", change: func(cfg *Config) { cfg.Interval = time.Second }, want: "is below the minimum"},
+		{name: "domain interval below the minimum", change: func(cfg *Config) { cfg.Domains[0].Interval = time.Second }, want: "domain home.example.com: interval of 1s is below the minimum"},
+		{name: "jitter above the interval", change: func(cfg *Config) { cfg.IntervalJitter = time.Hour }, want: "DDNS_INTERVAL_JITTER"},
+		{name: "record type", change: func(cfg *Config) { cfg.RecordTypes = []string{"MX"} }, want: `unsupported record type "MX"`},
+		{name: "domain record type", change: func(cfg *Config) { cfg.Domains[0].Types = []string{"SRV"} }, want: `domain home.example.com: unsupported record type "SRV"`},
+		{name: "provider", change: func(cfg *Config) { cfg.Provider = "bind" }, want: `DDNS_PROVIDER: unknown provider "bind"`},
+		{name: "secondary provider", change: func(cfg *Config) { cfg.Domains[0].Secondary = ProviderDigitalOcean }, want: "is its primary provider"},
+		{name: "webhook url", change: func(cfg *Config) { cfg.WebhookURL = "hooks.example.com/ddns" }, want: "DDNS_WEBHOOK_URL: expected an http:// or https:// URL"},
+		{name: "notify format", change: func(cfg *Config) { cfg.Notify = "teams" }, want: `DDNS_NOTIFY: unsupported format "teams"`},
+		{name: "notify without webhook", change: func(cfg *Config) { cfg.Notify = NotifySlack }, want: "DDNS_NOTIFY=slack requires DDNS_WEBHOOK_URL"},
+		{name: "webhook secret without webhook", change: func(cfg *Config) { cfg.WebhookSecret = "s" }, want: "DDNS_WEBHOOK_SECRET requires DDNS_WEBHOOK_URL"},
+		{name: "consensus of one provider", change: func(cfg *Config) { cfg.IPConsensus = true }, want: "DDNS_IP_CONSENSUS requires at least two"},
+		{name: "interface source", change: func(cfg *Config) { cfg.IPSource = IPSourceInterface }, want: "DDNS_IP_SOURCE=interface requires DDNS_INTERFACE"},
+		{name: "file source", change: func(cfg *Config) { cfg.IPSource = IPSourceFile }, want: "DDNS_IP_SOURCE=file requires DDNS_IP_FILE"},
+		{name: "external source", change: func(cfg *Config) { cfg.IPSource = IPSourceExternal }, want: "DDNS_IP_SOURCE=external requires DDNS_IP_FILE or DDNS_API_TOKEN"},
+		{name: "bolt without a state file", change: func(cfg *Config) { cfg.StateBackend = StateBackendBolt }, want: "DDNS_STATE_BACKEND=bolt requires DDNS_STATE_FILE"},
+		{name: "memory with a state file", change: func(cfg *Config) { cfg.StateBackend = StateBackendMemory; cfg.StateFile = "state.json" }, want: "DDNS_STATE_FILE can't be combined with DDNS_STATE_BACKEND=memory"},
+		{name: "lazy sync of required domains", change: func(cfg *Config) { cfg.LazySync = true; cfg.RequireAllDomains = true }, want: "DDNS_LAZY_SYNC can't be combined with DDNS_REQUIRE_ALL_DOMAINS"},
+		{name: "breaker interval", change: func(cfg *Config) { cfg.BreakerThreshold = 3; cfg.BreakerInterval = time.Minute }, want: "DDNS_BREAKER_INTERVAL of 1m0s must be longer"},
+		{name: "api token without status server", change: func(cfg *Config) { cfg.APIToken = "s"; cfg.StatusAddr = "" }, want: "DDNS_API_TOKEN needs DDNS_STATUS_ADDR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadTestConfig(t, nil)
+			tt.change(cfg)
+
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := loadTestConfig(t, nil)
+	cfg.DOToken = ""
+	cfg.Interval = 0
+	cfg.RecordTypes = []string{"MX"}
+	cfg.WebhookURL = "not a url"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid config")
+	}
+
+	for _, want := range []string{"DDNS_DO_API_TOKEN", "DDNS_INTERVAL", "DDNS_RECORD_TYPES", "DDNS_WEBHOOK_URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error %q doesn't report %s", err, want)
+		}
+	}
+
+	if got := len(strings.Split(err.Error(), "\n")); got != 4 {
+		t.Errorf("Validate reported %d problems, want 4 on their own lines", got)
+	}
+}
@@ -0,0 +1,126 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// valueData is what the value template of a TXT or CNAME record is rendered
+// with. Addresses that weren't detected are empty.
+type valueData struct {
+	IPv4 string
+	IPv6 string
+}
+
+// isIPType reports whether records of recType hold the detected IP itself
+// rather than a value derived from it.
+func isIPType(recType string) bool {
+	return recType == "A" || recType == "AAAA"
+}
+
+// parseValueTemplate parses the value template of a TXT or CNAME record.
+func parseValueTemplate(raw string) (*template.Template, error) {
+	tmpl, err := template.New("value").Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// catches references to fields that don't exist before the first cycle does
+	err = tmpl.Execute(io.Discard, valueData{})
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// valueFor returns the data the records of key should hold: the current IP
+// of their type as resolved by the domain's target, or the domain's rendered
+// value template.
+func (d *DDNSUpdater) valueFor(key recordKey) (string, error) {
+	if isIPType(key.Type) {
+		ip, err := d.targetIP(key.Name, key.Type, d.currentIPs[key.Type])
+		if err != nil {
+			return "", err
+		}
+
+		return ip.String(), nil
+	}
+
+	tmpl := d.specs[key.Name].valueTemplate
+	if tmpl == nil {
+		return "", fmt.Errorf("no value configured for %s", key.String())
+	}
+
+	var data valueData
+
+	if ip := d.currentIPs["A"]; ip != nil {
+		data.IPv4 = ip.String()
+	}
+
+	if ip := d.currentIPs["AAAA"]; ip != nil {
+		data.IPv6 = ip.String()
+	}
+
+	var value strings.Builder
+
+	err := tmpl.Execute(&value, data)
+	if err != nil {
+		return "", fmt.Errorf("unable to render the value of %s: %w", key.String(), err)
+	}
+
+	if value.Len() == 0 {
+		return "", fmt.Errorf("the value of %s rendered empty", key.String())
+	}
+
+	return value.String(), nil
+}
+
+// derivedTypes returns the managed record types whose data is derived from the
+// detected IPs, i.e. TXT and CNAME.
+func (d *DDNSUpdater) derivedTypes() []string {
+	seen := map[string]bool{}
+	types := []string{}
+
+	for key := range d.recordMap {
+		if !isIPType(key.Type) && !seen[key.Type] {
+			seen[key.Type] = true
+			types = append(types, key.Type)
+		}
+	}
+
+	sort.Strings(types)
+
+	return types
+}
+
+// applyDerived writes the rendered values of TXT and CNAME records after the
+// IPs they are derived from changed, or when they are flagged for a re-check.
+// It returns the failed writes.
+func (d *DDNSUpdater) applyDerived(ctx context.Context, changed bool) error {
+	// nothing to render until an ip was detected
+	if len(d.currentIPs) == 0 {
+		return nil
+	}
+
+	errs := []error{}
+
+	for _, recType := range d.derivedTypes() {
+		if !changed && !d.needsRecheck(recType) {
+			continue
+		}
+
+		if changed {
+			d.deferUndue(recType)
+		}
+
+		errs = append(errs, d.applyRecords(ctx, recType))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// liveRecord looks up the record of key with id at the provider.
+func (d *DDNSUpdater) liveRecord(ctx context.Context, key recordKey, id string) (Record, error) {
+	domain, subdomain, _, err := splitDomain(d.specs[key.Name])
+	if err != nil {
+		return Record{}, err
+	}
+
+	records, err := d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+	if err != nil {
+		return Record{}, err
+	}
+
+	for _, r := range records {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+
+	return Record{}, fmt.Errorf("%w: no record with id %s", ErrRecordNotFound, id)
+}
+
+// verification is an acknowledged write of value to the record of key with id,
+// waiting to be read back.
+type verification struct {
+	key               recordKey
+	domain, subdomain string
+	id, value         string
+}
+
+// queueVerification reads the write of value to the record of key with id back
+// once applyRecords wrote every record, rather than holding up other writes.
+func (d *DDNSUpdater) queueVerification(key recordKey, domain, subdomain, id, value string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.unverified = append(d.unverified, verification{key: key, domain: domain, subdomain: subdomain, id: id, value: value})
+}
+
+// verifyQueued verifies the queued writes, up to d.concurrency at once, and
+// fails the records whose write didn't stick.
+func (d *DDNSUpdater) verifyQueued(ctx context.Context) error {
+	d.mu.Lock()
+	queued := d.unverified
+	d.unverified = nil
+	d.mu.Unlock()
+
+	sem := make(chan struct{}, max(d.concurrency, 1))
+	errs := make([]error, len(queued))
+
+	var wg sync.WaitGroup
+
+	for i, v := range queued {
+		wg.Add(1)
+
+		sem <- struct{}{}
+
+		go func(i int, v verification) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			defer d.recoverPanic(&errs[i])
+
+			errs[i] = d.verifyRecord(ctx, v.key, v.domain, v.subdomain, v.id, v.value)
+			if errs[i] != nil {
+				d.recordFailed(v.key, "unable to verify record update", errs[i], "record_id", v.id)
+			}
+		}(i, v)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// verifyRecord re-fetches the record with id after it was updated to value,
+// and returns an error unless the provider now serves value for it. It catches
+// writes the api acknowledged that didn't stick.
+func (d *DDNSUpdater) verifyRecord(ctx context.Context, key recordKey, domain, subdomain, id, value string) error {
+	records, err := d.providerFor(key.Name).FindRecords(ctx, domain, key.Type, subdomain)
+	if err != nil {
+		d.statsd.Incr("update_verifications", "result:error")
+		d.metrics.UpdateVerification("error")
+
+		return fmt.Errorf("unable to verify the update of record %s id=%s: %w", key.String(), id, err)
+	}
+
+	for _, r := range records {
+		if r.ID != id {
+			continue
+		}
+
+		if r.Data != value {
+			break
+		}
+
+		d.logger.Debug("record update verified", "record", key.String(), "record_id", id)
+		d.statsd.Incr("update_verifications", "result:ok")
+		d.metrics.UpdateVerification("ok")
+
+		return nil
+	}
+
+	d.statsd.Incr("update_verifications", "result:mismatch")
+	d.metrics.UpdateVerification("mismatch")
+
+	// the next cycle writes it again
+	d.mu.Lock()
+	d.recheck[key] = true
+	d.mu.Unlock()
+
+	return fmt.Errorf("record %s id=%s doesn't hold %s after its update was acknowledged", key.String(), id, value)
+}
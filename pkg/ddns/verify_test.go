@@ -0,0 +1,81 @@
+package ddns
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// staleProvider acknowledges every update but serves the old data of the
+// records in stale afterwards, and logs the order of updates and lookups.
+type staleProvider struct {
+	*memProvider
+
+	mu    sync.Mutex
+	stale map[string]bool
+	log   []string
+}
+
+func (p *staleProvider) FindRecords(ctx context.Context, domain, recType, name string) ([]Record, error) {
+	found, err := p.memProvider.FindRecords(ctx, domain, recType, name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.log = append(p.log, "find")
+
+	for i, r := range found {
+		if p.stale[r.ID] {
+			found[i].Data = "8.8.4.4"
+		}
+	}
+
+	return found, err
+}
+
+func (p *staleProvider) UpdateRecord(ctx context.Context, domain, id, data string, ttl int) (Record, error) {
+	p.mu.Lock()
+	p.log = append(p.log, "update")
+	p.mu.Unlock()
+
+	return p.memProvider.UpdateRecord(ctx, domain, id, data, ttl)
+}
+
+func TestVerifyAfterUpdate(t *testing.T) {
+	p := &staleProvider{memProvider: newMemProvider(), stale: map[string]bool{}}
+	p.Add("example.com", "A", "home", "8.8.4.4")
+	p.stale[p.Add("example.com", "A", "nas", "8.8.4.4")] = true
+	p.Add("example.com", "A", "vpn", "8.8.4.4")
+
+	_, url := newTestIP(t, "8.8.8.8")
+	d := startTestUpdater(t, map[string]string{
+		"DDNS_IP_PROVIDER":         url,
+		"DDNS_DOMAINS":             "home.example.com,nas.example.com,vpn.example.com",
+		"DDNS_VERIFY_AFTER_UPDATE": "true",
+	}, p)
+
+	p.mu.Lock()
+	p.log = nil
+	p.mu.Unlock()
+
+	err := runTestCycle(d)
+	if err == nil || !strings.Contains(err.Error(), "nas.example.com") {
+		t.Fatalf("cycle error = %v, want the update of nas.example.com unverified", err)
+	}
+
+	// the writes aren't held up by reading back the ones before
+	if got := strings.Join(p.log, ","); got != "update,update,update,find,find,find" {
+		t.Errorf("provider calls %s, want every update before the verifications", got)
+	}
+
+	if !d.failed[key("nas.example.com")] || !d.recheck[key("nas.example.com")] {
+		t.Errorf("unverified record isn't failed and rechecked")
+	}
+
+	for _, name := range []string{"home.example.com", "vpn.example.com"} {
+		if d.failed[key(name)] || d.recheck[key(name)] {
+			t.Errorf("verified record %s is failed or rechecked", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ddns
+
+import (
+	"log/slog"
+	"os"
+	"runtime/pprof"
+	"time"
+)
+
+const (
+	// WatchdogOff disables the watchdog.
+	WatchdogOff = "off"
+	// WatchdogLog logs an error and a goroutine dump when the loop is stuck.
+	WatchdogLog = "log"
+	// WatchdogExit additionally exits non-zero so a supervisor restarts the process.
+	WatchdogExit = "exit"
+
+	// watchdogMultiple is how many intervals may pass without a completed
+	// cycle before the loop is considered stuck.
+	watchdogMultiple = 3
+)
+
+// runWatchdog periodically verifies that cycles keep completing and reports a
+// wedged run loop, e.g. one blocked on a hung API call.
+func (d *DDNSUpdater) runWatchdog() {
+	ticker := time.NewTicker(time.Duration(d.checkWindow.Load()))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		// read every time, a reload may change the intervals
+		limit := watchdogMultiple * time.Duration(d.checkWindow.Load())
+
+		last := time.Unix(0, d.lastCycle.Load())
+		if time.Since(last) < limit {
+			continue
+		}
+
+		// d.logger belongs to the run loop, which is the one that's stuck
+		slog.Error("watchdog: no cycle completed, run loop appears stuck", "last_cycle", last, "limit", limit)
+
+		_ = pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+
+		if d.watchdog == WatchdogExit {
+			slog.Error("watchdog: exiting so the supervisor can restart the process")
+
+			os.Exit(ExitUnhealthy)
+		}
+	}
+}
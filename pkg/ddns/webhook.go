@@ -0,0 +1,239 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the body when a
+// webhook secret is configured.
+const WebhookSignatureHeader = "X-DDNS-Signature"
+
+// ipChangeEvent is the body posted to the webhook after an IP change.
+type ipChangeEvent struct {
+	RecordType     string    `json:"record_type"`
+	OldIP          string    `json:"old_ip"`
+	NewIP          string    `json:"new_ip"`
+	Timestamp      time.Time `json:"timestamp"`
+	DomainsUpdated []string  `json:"domains_updated"`
+}
+
+// String summarizes e as a chat message.
+func (e ipChangeEvent) String() string {
+	if e.OldIP == "" {
+		return fmt.Sprintf("%s records set to %s: %s", e.RecordType, e.NewIP, strings.Join(e.DomainsUpdated, ", "))
+	}
+
+	return fmt.Sprintf("%s records changed from %s to %s: %s", e.RecordType, e.OldIP, e.NewIP, strings.Join(e.DomainsUpdated, ", "))
+}
+
+// alert is an event about a condition that starts and later clears, e.g. a
+// record failing to update. Alerts of the same condition are throttled with
+// DDNS_NOTIFY_THROTTLE.
+type alert interface {
+	fmt.Stringer
+	// alertKey identifies the condition, e.g. the failing record
+	alertKey() string
+	// alertTime is when the event happened
+	alertTime() time.Time
+	// withSuppressed returns the event noting n alerts of its condition that
+	// weren't sent since the last one that was
+	withSuppressed(n int) alert
+}
+
+// alertState is what the throttle knows about a condition.
+type alertState struct {
+	// when an alert of the condition was last sent
+	sent time.Time
+	// the latest alert held back, sent once the throttle is over
+	pending alert
+	// alerts held back since the last one sent
+	suppressed int
+}
+
+// webhookNotifier posts events to a webhook. A nil notifier discards
+// everything, so callers don't need to check whether a webhook is configured.
+type webhookNotifier struct {
+	url    string
+	secret string
+	// NotifyWebhook, NotifySlack or NotifyDiscord
+	format    string
+	userAgent string
+	client    *http.Client
+
+	// shortest time between two alerts of a condition, 0 sends every alert
+	throttle time.Duration
+	// alerts are sent from record workers too
+	mu sync.Mutex
+	// alert key: state
+	alerts map[string]*alertState
+}
+
+func newWebhookNotifier(url, secret, format, userAgent string, client *http.Client, throttle time.Duration) *webhookNotifier {
+	return &webhookNotifier{url: url, secret: secret, format: format, userAgent: userAgent, client: client, throttle: throttle, alerts: map[string]*alertState{}}
+}
+
+// Notify posts event as JSON, or as a Slack or Discord message summarizing it,
+// signing the body when a secret is configured. An alert following another
+// one of its condition within the throttle is held back instead: only the
+// latest is sent by Flush once the throttle is over, noting how many were
+// suppressed, so a condition that clears meanwhile ends with its resolution.
+func (w *webhookNotifier) Notify(ctx context.Context, event fmt.Stringer) error {
+	if w == nil {
+		return nil
+	}
+
+	if a, ok := event.(alert); ok && w.throttle > 0 {
+		a, ok = w.admit(a)
+		if !ok {
+			return nil
+		}
+
+		event = a
+	}
+
+	return w.send(ctx, event)
+}
+
+// admit returns a, noting the alerts suppressed before it, when it may be
+// sent right away, and holds it back otherwise.
+func (w *webhookNotifier) admit(a alert) (alert, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state, ok := w.alerts[a.alertKey()]
+	if !ok {
+		state = &alertState{}
+		w.alerts[a.alertKey()] = state
+	}
+
+	if !state.sent.IsZero() && a.alertTime().Sub(state.sent) < w.throttle {
+		state.pending = a
+		state.suppressed++
+
+		return nil, false
+	}
+
+	suppressed := state.suppressed
+
+	state.sent = a.alertTime()
+	state.pending = nil
+	state.suppressed = 0
+
+	if suppressed > 0 {
+		a = a.withSuppressed(suppressed)
+	}
+
+	return a, true
+}
+
+// Flush sends the alerts held back whose throttle is over at now, and forgets
+// conditions that were quiet for that long.
+func (w *webhookNotifier) Flush(ctx context.Context, now time.Time) error {
+	if w == nil || w.throttle <= 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+
+	keys := []string{}
+	for key := range w.alerts {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	due := []alert{}
+
+	for _, key := range keys {
+		state := w.alerts[key]
+		if now.Sub(state.sent) < w.throttle {
+			continue
+		}
+
+		if state.pending == nil {
+			delete(w.alerts, key)
+
+			continue
+		}
+
+		// the pending alert itself is sent, the ones before it weren't
+		a := state.pending
+		if state.suppressed > 1 {
+			a = a.withSuppressed(state.suppressed - 1)
+		}
+
+		due = append(due, a)
+
+		state.sent = now
+		state.pending = nil
+		state.suppressed = 0
+	}
+
+	w.mu.Unlock()
+
+	errs := []error{}
+	for _, a := range due {
+		errs = append(errs, w.send(ctx, a))
+	}
+
+	return errors.Join(errs...)
+}
+
+// send posts event right away.
+func (w *webhookNotifier) send(ctx context.Context, event fmt.Stringer) error {
+	var payload interface{} = event
+
+	switch w.format {
+	case NotifySlack:
+		payload = map[string]string{"text": event.String()}
+	case NotifyDiscord:
+		payload = map[string]string{"content": event.String()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error while forming webhook request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", w.userAgent)
+
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while delivering webhook: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		contents, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+		return fmt.Errorf("error from webhook (%d) body: \"%s\"", resp.StatusCode, contents)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer collects the failure events posted to it.
+type webhookServer struct {
+	mu     sync.Mutex
+	events []failureEvent
+}
+
+func newWebhookServer(t *testing.T) (*webhookServer, string) {
+	t.Helper()
+
+	s := &webhookServer{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event failureEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		s.mu.Lock()
+		s.events = append(s.events, event)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	return s, srv.URL
+}
+
+// Events returns the events received so far.
+func (s *webhookServer) Events() []failureEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]failureEvent{}, s.events...)
+}
+
+func TestNotifyThrottle(t *testing.T) {
+	server, url := newWebhookServer(t)
+	w := newWebhookNotifier(url, "", NotifyWebhook, "test", http.DefaultClient, time.Hour)
+
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	event := func(name, kind string, at time.Duration) failureEvent {
+		return failureEvent{Event: kind, Domain: name, RecordType: "A", Failures: 3, Timestamp: start.Add(at)}
+	}
+
+	ctx := context.Background()
+
+	// the record flaps during an outage
+	for _, e := range []failureEvent{
+		event("home.example.com", FailureEventFailing, 0),
+		event("home.example.com", FailureEventRecovered, time.Minute),
+		event("home.example.com", FailureEventFailing, 2*time.Minute),
+		event("home.example.com", FailureEventRecovered, 3*time.Minute),
+		// other records aren't throttled by it
+		event("nas.example.com", FailureEventFailing, 3*time.Minute),
+	} {
+		if err := w.Notify(ctx, e); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	events := server.Events()
+	if len(events) != 2 || events[0].Domain != "home.example.com" || events[1].Domain != "nas.example.com" {
+		t.Fatalf("sent %+v, want the first alert of each record", events)
+	}
+
+	// nothing is due before the throttle is over
+	if err := w.Flush(ctx, start.Add(30*time.Minute)); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if got := len(server.Events()); got != 2 {
+		t.Fatalf("sent %d events before the throttle was over, want 2", got)
+	}
+
+	if err := w.Flush(ctx, start.Add(time.Hour)); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	events = server.Events()
+	if len(events) != 3 {
+		t.Fatalf("sent %d events after the throttle, want a single resolution", len(events))
+	}
+
+	resolution := events[2]
+	if resolution.Event != FailureEventRecovered || resolution.Domain != "home.example.com" || resolution.Suppressed != 2 {
+		t.Errorf("sent %+v, want home.example.com recovered with 2 alerts suppressed", resolution)
+	}
+
+	// a later alert is sent right away
+	if err := w.Notify(ctx, event("home.example.com", FailureEventFailing, 3*time.Hour)); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if events := server.Events(); len(events) != 4 || events[3].Suppressed != 0 {
+		t.Errorf("sent %+v, want the new alert without suppressed ones", events)
+	}
+}
+
+func TestNotifyWithoutThrottle(t *testing.T) {
+	server, url := newWebhookServer(t)
+	w := newWebhookNotifier(url, "", NotifyWebhook, "test", http.DefaultClient, 0)
+
+	now := time.Now()
+
+	for _, kind := range []string{FailureEventFailing, FailureEventRecovered, FailureEventFailing} {
+		if err := w.Notify(context.Background(), failureEvent{Event: kind, Domain: "home.example.com", RecordType: "A", Timestamp: now}); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	if got := len(server.Events()); got != 3 {
+		t.Errorf("sent %d events, want every one without a throttle", got)
+	}
+}
+
+func TestSuppressedMessage(t *testing.T) {
+	e := failureEvent{Event: FailureEventRecovered, Domain: "home.example.com", RecordType: "A", Failures: 3, Suppressed: 2}
+
+	if got, want := e.String(), "home.example.com/A recovered after 3 failed updates (2 similar alerts suppressed)"; got != want {
+		t.Errorf("message = %q, want %q", got, want)
+	}
+}